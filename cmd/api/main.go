@@ -6,20 +6,30 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/dnawand/go-membershipapi/internal/auth"
+	"github.com/dnawand/go-membershipapi/internal/database"
+	"github.com/dnawand/go-membershipapi/internal/events"
+	"github.com/dnawand/go-membershipapi/internal/grpcapi"
 	"github.com/dnawand/go-membershipapi/internal/handlers"
+	"github.com/dnawand/go-membershipapi/internal/jobs"
+	"github.com/dnawand/go-membershipapi/internal/migrations"
+	"github.com/dnawand/go-membershipapi/internal/notifications"
 	"github.com/dnawand/go-membershipapi/internal/storage"
+	"github.com/dnawand/go-membershipapi/internal/webhooks"
 	"github.com/dnawand/go-membershipapi/pkg/app"
 	"github.com/dnawand/go-membershipapi/pkg/domain"
+	membershipv1 "github.com/dnawand/go-membershipapi/pkg/pb/membership/v1"
 	"github.com/dnawand/go-membershipapi/pkg/repositories"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"gorm.io/driver/sqlite"
+	"google.golang.org/grpc"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -27,7 +37,24 @@ import (
 //go:embed swagger
 var swagger embed.FS
 
+const (
+	priceMigrationInterval    = time.Hour
+	idempotencyPurgeInterval  = time.Hour
+	lifecycleInterval         = time.Hour
+	eventRelayInterval        = 5 * time.Second
+	webhookDispatchInterval   = 10 * time.Second
+	notificationInterval      = 10 * time.Second
+	eventPurgeInterval        = time.Hour
+	notificationPurgeInterval = time.Hour
+	writeTimeout              = 5 * time.Second
+	grpcAddr                  = ":9090"
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrate(os.Args[2:]))
+	}
+
 	logger := zapConfig()
 	defer logger.Sync()
 
@@ -38,25 +65,157 @@ func main() {
 		os.Exit(1)
 	}
 
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		logger.Error("could not initialize authentication configuration", zap.Error(err))
+		logger.Sync()
+		os.Exit(1)
+	}
+	if len(authConfig.APIKeys) == 0 && len(authConfig.HMACSecret) == 0 && authConfig.RSAPublicKey == nil {
+		logger.Warn("no API keys or JWT keys configured, every request will be rejected")
+	}
+
+	notifier, err := notifications.NewNotifier(notifications.ConfigFromEnv(), logger)
+	if err != nil {
+		logger.Error("could not initialize notifications configuration", zap.Error(err))
+		logger.Sync()
+		os.Exit(1)
+	}
+	templates, err := notifications.NewTemplates()
+	if err != nil {
+		logger.Error("could not load notification templates", zap.Error(err))
+		logger.Sync()
+		os.Exit(1)
+	}
+
 	voucherStorage := loadVouchers()
 	userRepository := repositories.NewUserRepository(dbConfig)
 	productRepository := repositories.NewProductRepository(dbConfig)
 	subscriptionRespository := repositories.NewSubscriptionRepository(dbConfig, voucherStorage)
-
-	userService := app.NewUserService(userRepository)
-	productService := app.NewProductService(productRepository)
+	priceMigrationRepository := repositories.NewPriceMigrationRepository(dbConfig)
+	usageRepository := repositories.NewUsageRepository(dbConfig)
+	memberRepository := repositories.NewMemberRepository(dbConfig)
+	idempotencyRepository := repositories.NewIdempotencyRepository(dbConfig)
+	outboxRepository := repositories.NewOutboxRepository(dbConfig)
+	webhookRepository := repositories.NewWebhookRepository(dbConfig)
+	webhookDeliveryRepository := repositories.NewWebhookDeliveryRepository(dbConfig)
+	notificationRepository := repositories.NewNotificationRepository(dbConfig)
+	unitOfWork := repositories.NewUnitOfWork(dbConfig)
+
+	userService := app.NewUserService(
+		userRepository, subscriptionRespository, memberRepository, usageRepository, notificationRepository, unitOfWork,
+	)
+	productService := app.NewProductService(productRepository, unitOfWork)
 	discountService := app.NewDiscountService()
 	subscriptionService := app.NewSubscriptionService(
-		subscriptionRespository, userRepository, productRepository, voucherStorage, discountService,
+		subscriptionRespository, userRepository, productRepository, voucherStorage, discountService, unitOfWork,
 	)
+	memberService := app.NewMemberService(memberRepository, subscriptionRespository, userRepository, unitOfWork)
+	entitlementService := app.NewEntitlementService(
+		userRepository, subscriptionRespository, productRepository, memberRepository,
+	)
+	usageService := app.NewUsageService(usageRepository, subscriptionRespository, productRepository)
+	priceMigrationService := app.NewPriceMigrationService(
+		priceMigrationRepository, subscriptionRespository, productRepository, voucherStorage, discountService, unitOfWork,
+	)
+	idempotencyService := app.NewIdempotencyService(idempotencyRepository)
+	webhookService := app.NewWebhookService(webhookRepository, webhookDeliveryRepository, webhooks.NewSender())
+	notificationService := app.NewNotificationService(
+		notificationRepository, userRepository, subscriptionRespository, templates, notifier,
+	)
+	eventRelay := app.NewEventRelay(outboxRepository, events.NewLogSink(logger), webhookService, notificationService)
 
 	userHandler := handlers.NewUserHandler(logger, userService)
 	productHandler := handlers.NewProductHandler(logger, productService)
 	subscriptionHandler := handlers.NewSubscriptionHandler(logger, subscriptionService)
+	priceMigrationHandler := handlers.NewPriceMigrationHandler(logger, priceMigrationService)
+	usageHandler := handlers.NewUsageHandler(logger, usageService)
+	memberHandler := handlers.NewMemberHandler(logger, memberService)
+	entitlementHandler := handlers.NewEntitlementHandler(logger, entitlementService)
+	idempotencyHandler := handlers.NewIdempotencyHandler(logger, idempotencyService)
+	webhookHandler := handlers.NewWebhookHandler(logger, webhookService)
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	go jobs.Run(jobsCtx, logger, "price migration", priceMigrationInterval, func(ctx context.Context, now time.Time) error {
+		migrated, err := priceMigrationService.Apply(ctx, now)
+		if migrated > 0 {
+			logger.Info("subscriptions migrated to new price", zap.Int("migrated", migrated))
+		}
+		return err
+	})
+	go jobs.Run(jobsCtx, logger, "idempotency keys", idempotencyPurgeInterval, func(ctx context.Context, now time.Time) error {
+		purged, err := idempotencyService.Purge(ctx, now)
+		if purged > 0 {
+			logger.Info("expired idempotency keys purged", zap.Int64("purged", purged))
+		}
+		return err
+	})
+	go jobs.Run(jobsCtx, logger, "subscription lifecycle", lifecycleInterval, func(ctx context.Context, now time.Time) error {
+		notified, err := subscriptionService.NotifyTrialEnding(ctx, now)
+		if notified > 0 {
+			logger.Info("ending trials notified", zap.Int("notified", notified))
+		}
+		if err != nil {
+			return err
+		}
 
-	router := configRouter(userHandler, productHandler, subscriptionHandler)
+		renewed, err := subscriptionService.Renew(ctx, now)
+		if renewed > 0 {
+			logger.Info("subscriptions renewed", zap.Int("renewed", renewed))
+		}
+		return err
+	})
+	go jobs.Run(jobsCtx, logger, "event relay", eventRelayInterval, func(ctx context.Context, now time.Time) error {
+		_, err := eventRelay.Relay(ctx)
+		return err
+	})
+	go jobs.Run(jobsCtx, logger, "webhook dispatch", webhookDispatchInterval, func(ctx context.Context, now time.Time) error {
+		_, err := webhookService.Dispatch(ctx, now)
+		return err
+	})
+	go jobs.Run(jobsCtx, logger, "notifications", notificationInterval, func(ctx context.Context, now time.Time) error {
+		_, err := notificationService.Dispatch(ctx, now)
+		return err
+	})
+	go jobs.Run(jobsCtx, logger, "event purge", eventPurgeInterval, func(ctx context.Context, now time.Time) error {
+		purged, err := eventRelay.Purge(ctx, now)
+		if purged > 0 {
+			logger.Info("published events purged", zap.Int64("purged", purged))
+		}
+		return err
+	})
+	go jobs.Run(jobsCtx, logger, "notification purge", notificationPurgeInterval, func(ctx context.Context, now time.Time) error {
+		purged, err := notificationService.Purge(ctx, now)
+		if purged > 0 {
+			logger.Info("finished notifications purged", zap.Int64("purged", purged))
+		}
+		return err
+	})
+
+	authenticator := auth.NewAuthenticator(authConfig)
+	router := configRouter(
+		logger,
+		authenticator,
+		userHandler,
+		productHandler,
+		subscriptionHandler,
+		priceMigrationHandler,
+		usageHandler,
+		memberHandler,
+		entitlementHandler,
+		idempotencyHandler,
+		webhookHandler,
+	)
+	grpcServer := configGRPCServer(
+		logger,
+		authenticator,
+		grpcapi.NewUserServer(userService),
+		grpcapi.NewProductServer(productService),
+		grpcapi.NewSubscriptionServer(subscriptionService),
+	)
 	server, fileServer := serverConfig(router)
-	ok := gracefulRun(server, fileServer, logger)
+	ok := gracefulRun(server, fileServer, grpcServer, logger)
+	stopJobs()
 	if !ok {
 		logger.Info("server forced to shutdown")
 		logger.Sync()
@@ -67,31 +226,103 @@ func main() {
 }
 
 func configRouter(
+	logger *zap.Logger,
+	authenticator auth.Authenticator,
 	userHandler *handlers.UserHandler,
 	productHandler *handlers.ProductHandler,
 	subscriptionHandler *handlers.SubscriptionHandler,
+	priceMigrationHandler *handlers.PriceMigrationHandler,
+	usageHandler *handlers.UsageHandler,
+	memberHandler *handlers.MemberHandler,
+	entitlementHandler *handlers.EntitlementHandler,
+	idempotencyHandler *handlers.IdempotencyHandler,
+	webhookHandler *handlers.WebhookHandler,
 ) *gin.Engine {
 	router := gin.Default()
+	router.Use(handlers.Timeout(writeTimeout), handlers.ErrorHandler(logger), auth.Middleware(authenticator))
 
 	router.POST("/users", userHandler.Create)
-	router.GET("/users/:user-id", userHandler.Fetch)
-	router.POST("/products", productHandler.Create)
 	router.GET("/products/:product-id", productHandler.Fetch)
 	router.GET("/products", productHandler.List)
-	router.POST("/users/:user-id/subscriptions", subscriptionHandler.Create)
-	router.GET("/users/:user-id/subscriptions/:subscription-id", subscriptionHandler.Fetch)
-	router.GET("/users/:user-id/subscriptions", subscriptionHandler.List)
-	router.PATCH("/users/:user-id/subscriptions/:subscription-id", subscriptionHandler.Action)
+
+	user := router.Group("/users/:user-id", auth.RequireUser("user-id"))
+	user.GET("", userHandler.Fetch)
+	user.PATCH("", userHandler.Update)
+	user.DELETE("", userHandler.Delete)
+	user.POST("/erase", userHandler.Erase)
+	user.GET("/export", userHandler.Export)
+	user.POST("/subscriptions", idempotencyHandler.Handle, subscriptionHandler.Create)
+	user.GET("/subscriptions/:subscription-id", subscriptionHandler.Fetch)
+	user.GET("/subscriptions", subscriptionHandler.List)
+	user.PATCH("/subscriptions/:subscription-id", idempotencyHandler.Handle, subscriptionHandler.Action)
+	user.POST("/subscriptions/:subscription-id/usage", usageHandler.Report)
+	user.GET("/subscriptions/:subscription-id/usage", usageHandler.Summary)
+	user.POST("/subscriptions/:subscription-id/members", memberHandler.Invite)
+	user.GET("/subscriptions/:subscription-id/members", memberHandler.List)
+	user.DELETE("/subscriptions/:subscription-id/members/:member-id", memberHandler.Remove)
+	user.GET("/memberships", memberHandler.Memberships)
+	user.POST("/memberships/:member-id/accept", memberHandler.Accept)
+	user.GET("/entitlements", entitlementHandler.List)
+
+	support := router.Group("", auth.RequireRole(auth.RoleSupport))
+	support.GET("/price-migrations/:migration-id", priceMigrationHandler.Fetch)
+	support.GET("/price-migrations/:migration-id/preview", priceMigrationHandler.Preview)
+
+	admin := router.Group("", auth.RequireRole(auth.RoleAdmin))
+	admin.POST("/products", productHandler.Create)
+	admin.PATCH("/products/:product-id", productHandler.Update)
+	admin.POST("/products/:product-id/archive", productHandler.Archive)
+	admin.POST("/products/:product-id/plans", productHandler.AddPlan)
+	admin.PATCH("/products/:product-id/plans/:plan-id", productHandler.UpdatePlan)
+	admin.DELETE("/products/:product-id/plans/:plan-id", productHandler.RetirePlan)
+	admin.POST("/products/:product-id/add-ons", productHandler.AddAddOn)
+	admin.POST("/products/:product-id/entitlements", productHandler.AddEntitlement)
+	admin.POST("/price-migrations", priceMigrationHandler.Create)
+	admin.DELETE("/price-migrations/:migration-id", priceMigrationHandler.Cancel)
+	admin.GET("/admin/subscriptions", subscriptionHandler.Search)
+	admin.POST("/webhooks", webhookHandler.Create)
+	admin.GET("/webhooks", webhookHandler.List)
+	admin.GET("/webhooks/:webhook-id", webhookHandler.Fetch)
+	admin.PATCH("/webhooks/:webhook-id", webhookHandler.Update)
+	admin.DELETE("/webhooks/:webhook-id", webhookHandler.Delete)
+	admin.GET("/webhooks/:webhook-id/deliveries", webhookHandler.Deliveries)
+	admin.POST("/webhooks/:webhook-id/deliveries/:delivery-id/replay", webhookHandler.Replay)
 
 	return router
 }
 
+// configGRPCServer serves the users, products and subscriptions over gRPC, with the access rules of
+// the REST API: calls about a user require access to it, and changes of products the admin role.
+func configGRPCServer(
+	logger *zap.Logger,
+	authenticator auth.Authenticator,
+	userServer *grpcapi.UserServer,
+	productServer *grpcapi.ProductServer,
+	subscriptionServer *grpcapi.SubscriptionServer,
+) *grpc.Server {
+	methodRoles := map[string][]auth.Role{
+		membershipv1.ProductService_CreateProduct_FullMethodName: {auth.RoleAdmin},
+		membershipv1.ProductService_UpdateProduct_FullMethodName: {auth.RoleAdmin},
+	}
+
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		grpcapi.Timeout(writeTimeout),
+		grpcapi.Errors(logger),
+		auth.UnaryInterceptor(authenticator, methodRoles),
+	))
+	membershipv1.RegisterUserServiceServer(server, userServer)
+	membershipv1.RegisterProductServiceServer(server, productServer)
+	membershipv1.RegisterSubscriptionServiceServer(server, subscriptionServer)
+
+	return server
+}
+
 func serverConfig(router *gin.Engine) (server *http.Server, fileServer *http.Server) {
 	server = &http.Server{
 		Addr:         ":8080",
 		Handler:      router,
 		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 5 * time.Second,
+		WriteTimeout: writeTimeout,
 	}
 
 	mux := http.NewServeMux()
@@ -116,28 +347,48 @@ func zapConfig() *zap.Logger {
 	return logger
 }
 
+// dbConfig opens the database, refusing to use a schema with pending migrations. In memory databases
+// can't be migrated beforehand, so they are migrated when opened.
 func dbConfig() (*gorm.DB, error) {
-	cfg := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Error),
+	db, dbCfg, err := openDB()
+	if err != nil {
+		return nil, err
+	}
+
+	if dbCfg.InMemory() {
+		if _, err := migrations.Up(db); err != nil {
+			return nil, fmt.Errorf("could not migrate database: %w", err)
+		}
+		return db, nil
 	}
-	db, err := gorm.Open(sqlite.Open(":memory:"), cfg)
 
+	if err := migrations.Check(db); err != nil {
+		return nil, fmt.Errorf("%w, run the migrate up command", err)
+	}
+
+	return db, nil
+}
+
+func openDB() (*gorm.DB, database.Config, error) {
+	dbCfg, err := database.ConfigFromEnv()
 	if err != nil {
-		return nil, err
+		return nil, database.Config{}, err
 	}
 
-	err = db.AutoMigrate(
-		domain.User{},
-		domain.ProductPlan{},
-		domain.SubscriptionPlan{},
-		domain.Product{},
-		domain.Subscription{},
-	)
+	cfg := &gorm.Config{
+		Logger: logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+			SlowThreshold:             200 * time.Millisecond,
+			LogLevel:                  logger.Error,
+			IgnoreRecordNotFoundError: true,
+			Colorful:                  true,
+		}),
+	}
+	db, err := database.Open(dbCfg, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("could not migrate models: %w", err)
+		return nil, database.Config{}, err
 	}
 
-	return db, err
+	return db, dbCfg, nil
 }
 
 func loadVouchers() *storage.Store {
@@ -175,7 +426,7 @@ func loadVouchers() *storage.Store {
 	return voucherStorage
 }
 
-func gracefulRun(server *http.Server, fileServer *http.Server, logger *zap.Logger) (ok bool) {
+func gracefulRun(server *http.Server, fileServer *http.Server, grpcServer *grpc.Server, logger *zap.Logger) (ok bool) {
 	ok = true
 
 	go func() {
@@ -194,6 +445,19 @@ func gracefulRun(server *http.Server, fileServer *http.Server, logger *zap.Logge
 		}
 	}()
 
+	go func() {
+		logger.Info(fmt.Sprintf("starting gRPC server on %s", grpcAddr))
+
+		listener, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			logger.Error("could not start the gRPC server", zap.Error(err))
+			return
+		}
+		if err := grpcServer.Serve(listener); err != nil {
+			logger.Error("could not start the gRPC server", zap.Error(err))
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -209,10 +473,24 @@ func gracefulRun(server *http.Server, fileServer *http.Server, logger *zap.Logge
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("server need to be forced to shutdown", zap.Error(err))
 		ok = false
 	}
 
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		logger.Error("gRPC server need to be forced to shutdown", zap.Error(ctx.Err()))
+		grpcServer.Stop()
+		ok = false
+	}
+
 	return ok
 }
@@ -1,23 +1,52 @@
 package main
 
 import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/dnawand/go-membershipapi/internal/auth"
+	"github.com/dnawand/go-membershipapi/internal/database"
+	"github.com/dnawand/go-membershipapi/internal/events"
+	"github.com/dnawand/go-membershipapi/internal/grpcapi"
 	"github.com/dnawand/go-membershipapi/internal/handlers"
+	"github.com/dnawand/go-membershipapi/internal/migrations"
 	"github.com/dnawand/go-membershipapi/internal/mocks"
+	"github.com/dnawand/go-membershipapi/internal/notifications"
 	"github.com/dnawand/go-membershipapi/internal/storage"
+	"github.com/dnawand/go-membershipapi/internal/webhooks"
 	"github.com/dnawand/go-membershipapi/pkg/app"
 	"github.com/dnawand/go-membershipapi/pkg/domain"
+	membershipv1 "github.com/dnawand/go-membershipapi/pkg/pb/membership/v1"
 	"github.com/dnawand/go-membershipapi/pkg/repositories"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 	"gorm.io/gorm"
 )
 
@@ -28,15 +57,28 @@ var voucherStorage *storage.Store
 var userRepository domain.UserRepository
 var productRepository domain.ProductRepository
 var subscriptionRespository domain.SubscriptionRepository
+var unitOfWork domain.UnitOfWork
+
+// allowAll authenticates every request, for tests not covering authentication.
+type allowAll struct{}
+
+func (allowAll) Authenticate(*http.Request) (auth.Principal, error) {
+	return auth.Principal{Subject: "tester", Kind: auth.PrincipalClient, Roles: []auth.Role{auth.RoleAdmin}}, nil
+}
 
 func initContext() {
 	once.Do(func() {
 		zapLogger, _ = zap.NewDevelopment()
-		db, _ = dbConfig()
+		var err error
+		db, err = dbConfig()
+		if err != nil {
+			panic(fmt.Sprintf("could not initialize test database: %v", err))
+		}
 		voucherStorage = loadVouchers()
 		userRepository = repositories.NewUserRepository(db)
 		productRepository = repositories.NewProductRepository(db)
 		subscriptionRespository = repositories.NewSubscriptionRepository(db, voucherStorage)
+		unitOfWork = repositories.NewUnitOfWork(db)
 	})
 }
 
@@ -54,341 +96,920 @@ func RunTestIsolated(f func()) {
 	f()
 }
 
-func TestListProducts(t *testing.T) {
+func TestCreateUser(t *testing.T) {
 	RunTestIsolated(func() {
-		createdProducts := createProducts()
-
 		router := configRouter(
-			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
+			zapLogger,
+			allowAll{},
+			handlers.NewUserHandler(zapLogger, app.NewUserService(userRepository, nil, nil, nil, nil, nil)),
+			&handlers.ProductHandler{},
 			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
 		)
-		req, _ := http.NewRequest(http.MethodGet, "/products", nil)
+
+		req, _ := http.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name": " Tester ", "email": "tester@email.com"}`))
 		rr := httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
 
-		assert.Equal(t, http.StatusOK, rr.Code)
+		var user domain.User
+		err := json.Unmarshal(rr.Body.Bytes(), &user)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, user.ID)
+		assert.Equal(t, "Tester", user.Name)
 
-		var products []domain.Product
-		json.Unmarshal(rr.Body.Bytes(), &products)
+		req, _ = http.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name": "Copy", "email": "tester@email.com"}`))
+		rr = httptest.NewRecorder()
 
-		assert.Equal(t, len(createdProducts), len(products))
-	})
-}
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
 
-func TestFetchSingleProduct(t *testing.T) {
-	RunTestIsolated(func() {
-		createdProducts := createProducts()
-		expectedProduct := createdProducts[0]
+		var problem handlers.Problem
+		err = json.Unmarshal(rr.Body.Bytes(), &problem)
+		assert.NoError(t, err)
+		assert.Equal(t, handlers.CodeConflict, problem.Code)
+		assert.Equal(t, http.StatusConflict, problem.Status)
+		assert.Equal(t, "/users", problem.Instance)
+		assert.Equal(t, []handlers.InvalidField{{Field: "email", Reason: "taken"}}, problem.Errors)
 
-		router := configRouter(
-			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
-			&handlers.SubscriptionHandler{},
-		)
-		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/products/%s", expectedProduct.ID), nil)
-		rr := httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name": "Invalid", "email": "not-an-email"}`))
+		rr = httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
 
-		assert.Equal(t, http.StatusOK, rr.Code)
+		problem = handlers.Problem{}
+		err = json.Unmarshal(rr.Body.Bytes(), &problem)
+		assert.NoError(t, err)
+		assert.Equal(t, handlers.CodeInvalidArgument, problem.Code)
+		assert.Equal(t, []handlers.InvalidField{{Field: "email", Reason: "invalid"}}, problem.Errors)
 
-		var product domain.Product
-		json.Unmarshal(rr.Body.Bytes(), &product)
+		req, _ = http.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name": "", "email": "empty@email.com"}`))
+		rr = httptest.NewRecorder()
 
-		assert.Equal(t, expectedProduct.ID, product.ID)
-		assert.Equal(t, expectedProduct.Name, product.Name)
-		assert.Equal(t, len(expectedProduct.ProductPlans), len(product.ProductPlans))
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		var count int64
+		db.Model(&domain.User{}).Count(&count)
+		assert.Equal(t, int64(1), count)
 	})
 }
 
-func TestSubscriptionNoVoucher(t *testing.T) {
+func TestProblemResponses(t *testing.T) {
 	RunTestIsolated(func() {
 		user := createUser()
-		createdProducts := createProducts()
-		product := createdProducts[0]
-		productPlan := product.ProductPlans[0]
-
 		router := configRouter(
+			zapLogger,
+			allowAll{},
 			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
+			&handlers.ProductHandler{},
 			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
 				subscriptionRespository,
 				userRepository,
 				productRepository,
 				voucherStorage,
 				&app.DiscountService{},
+				unitOfWork,
 			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
 		)
 
-		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
-		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
-		rr := httptest.NewRecorder()
-
-		router.ServeHTTP(rr, req)
+		tests := []struct {
+			name   string
+			body   string
+			status int
+			code   string
+			errors []handlers.InvalidField
+		}{
+			{
+				name:   "malformed body",
+				body:   `{"productId": `,
+				status: http.StatusBadRequest,
+				code:   handlers.CodeInvalidRequest,
+			},
+			{
+				name:   "missing fields",
+				body:   `{"voucherId": "b86b4903-2043-4f71-b154-efec19fbc55a"}`,
+				status: http.StatusBadRequest,
+				code:   handlers.CodeInvalidRequest,
+				errors: []handlers.InvalidField{
+					{Field: "productId", Reason: "required"},
+					{Field: "planId", Reason: "required"},
+				},
+			},
+			{
+				name:   "unknown product",
+				body:   `{"productId": "4e6b2a38-7a4d-4a36-9a8b-0c4f3c7c2d11", "planId": "4e6b2a38-7a4d-4a36-9a8b-0c4f3c7c2d11"}`,
+				status: http.StatusNotFound,
+				code:   "product_not_found",
+			},
+		}
 
-		assert.Equal(t, http.StatusCreated, rr.Code)
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				path := fmt.Sprintf("/users/%s/subscriptions", user.ID)
+				req, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(tt.body))
+				rr := httptest.NewRecorder()
 
-		var subscription domain.Subscription
-		json.Unmarshal(rr.Body.Bytes(), &subscription)
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, tt.status, rr.Code)
+				assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
 
-		assert.NotEmpty(t, subscription.ID)
-		assert.Equal(t, product.ID, subscription.Product.ID)
-		assert.NotEqual(t, productPlan.ID, subscription.SubscriptionPlan.ID)
-		assert.Equal(t, productPlan.Length, subscription.SubscriptionPlan.Length)
-		assert.Equal(t, productPlan.Price.Code, subscription.SubscriptionPlan.Price.Code)
-		assert.Equal(t, productPlan.Price.Number, subscription.SubscriptionPlan.Price.Number)
+				var problem handlers.Problem
+				err := json.Unmarshal(rr.Body.Bytes(), &problem)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.status, problem.Status)
+				assert.Equal(t, tt.code, problem.Code)
+				assert.Equal(t, path, problem.Instance)
+				assert.NotEmpty(t, problem.Type)
+				assert.Equal(t, tt.errors, problem.Errors)
+			})
+		}
 	})
 }
 
-func TestFetchSubscription(t *testing.T) {
+func TestUserLifecycle(t *testing.T) {
 	RunTestIsolated(func() {
 		user := createUser()
+		other, _ := userRepository.Save(context.Background(), domain.User{Name: "Other", Email: "other@email.com"})
 		createdProducts := createProducts()
-		product := createdProducts[0]
-		productPlan := product.ProductPlans[0]
+		memberRepository := repositories.NewMemberRepository(db)
+		subscriptionService := app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
 
 		router := configRouter(
-			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
-			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
-				subscriptionRespository,
+			zapLogger,
+			allowAll{},
+			handlers.NewUserHandler(zapLogger, app.NewUserService(
 				userRepository,
-				productRepository,
-				voucherStorage,
-				&app.DiscountService{},
+				subscriptionRespository,
+				memberRepository,
+				repositories.NewUsageRepository(db),
+				repositories.NewNotificationRepository(db),
+				unitOfWork,
 			)),
+			&handlers.ProductHandler{},
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
 		)
 
-		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
-		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		subscription, _, err := subscriptionService.Subscribe(
+			context.Background(), user.ID, createdProducts[0].ID, createdProducts[0].ProductPlans[0].ID, "", 0,
+		)
+		assert.NoError(t, err)
+
+		userPath := fmt.Sprintf("/users/%s", user.ID)
+		req, _ := http.NewRequest(http.MethodPatch, userPath, strings.NewReader(`{"email": "other@email.com"}`))
 		rr := httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
-		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, http.StatusConflict, rr.Code)
 
-		var subscription domain.Subscription
-		json.Unmarshal(rr.Body.Bytes(), &subscription)
+		req, _ = http.NewRequest(http.MethodPatch, userPath, strings.NewReader(`{"name": "Renamed", "email": "renamed@email.com"}`))
+		rr = httptest.NewRecorder()
 
-		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), nil)
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var updated domain.User
+		err = json.Unmarshal(rr.Body.Bytes(), &updated)
+		assert.NoError(t, err)
+		assert.Equal(t, "Renamed", updated.Name)
+		assert.Equal(t, "renamed@email.com", updated.Email)
+
+		req, _ = http.NewRequest(http.MethodGet, userPath+"/export", nil)
 		rr = httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
 		assert.Equal(t, http.StatusOK, rr.Code)
 
-		json.Unmarshal(rr.Body.Bytes(), &subscription)
+		var export domain.UserExport
+		err = json.Unmarshal(rr.Body.Bytes(), &export)
+		assert.NoError(t, err)
+		assert.Equal(t, "renamed@email.com", export.User.Email)
+		assert.Len(t, export.User.Subscriptions, 1)
+		assert.Empty(t, export.Memberships)
 
-		assert.NotEmpty(t, subscription.ID)
-		assert.Equal(t, product.ID, subscription.Product.ID)
-		assert.NotEqual(t, productPlan.ID, subscription.SubscriptionPlan.ID)
-		assert.Equal(t, productPlan.Length, subscription.SubscriptionPlan.Length)
-		assert.Equal(t, productPlan.Price.Code, subscription.SubscriptionPlan.Price.Code)
-		assert.Equal(t, productPlan.Price.Number, subscription.SubscriptionPlan.Price.Number)
-	})
-}
+		req, _ = http.NewRequest(http.MethodDelete, userPath, nil)
+		rr = httptest.NewRecorder()
 
-func TestSubscriptionPauseDuringTrial(t *testing.T) {
-	RunTestIsolated(func() {
-		user := createUser()
-		createdProducts := createProducts()
-		product := createdProducts[0]
-		productPlan := product.ProductPlans[0]
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
 
-		router := configRouter(
-			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
-			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
-				subscriptionRespository,
-				userRepository,
-				productRepository,
-				voucherStorage,
-				&app.DiscountService{},
-			)),
-		)
+		canceled, _ := subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.False(t, canceled.IsActive)
+		assert.NotNil(t, canceled.CancelDate)
 
-		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
-		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
-		rr := httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodGet, userPath+"/export", nil)
+		rr = httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
-		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
 
-		var subscription domain.Subscription
-		json.Unmarshal(rr.Body.Bytes(), &subscription)
+		req, _ = http.NewRequest(http.MethodPost, userPath+"/erase", nil)
+		rr = httptest.NewRecorder()
 
-		jsonBody = `{"action": "pause"}`
-		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		var erased domain.User
+		db.Unscoped().First(&erased, "id = ?", user.ID)
+		assert.Empty(t, erased.Name)
+		assert.NotContains(t, erased.Email, "@")
+		assert.NotNil(t, erased.ErasedAt)
+
+		retained, _ := subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.Equal(t, subscription.ID, retained.ID)
+
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/erase", other.ID), nil)
 		rr = httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
-		assert.Equal(t, http.StatusLocked, rr.Code)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, "/users/4e6b2a38-7a4d-4a36-9a8b-0c4f3c7c2d11/erase", nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
 }
 
-func TestSubscriptionPauseAfterTrial(t *testing.T) {
+func TestResourcesNotFound(t *testing.T) {
 	RunTestIsolated(func() {
 		user := createUser()
-		createdProducts := createProducts()
-		product := createdProducts[0]
-		productPlan := product.ProductPlans[0]
+		product := createProducts()[0]
+		memberRepository := repositories.NewMemberRepository(db)
+		usageRepository := repositories.NewUsageRepository(db)
+		discountService := &app.DiscountService{}
 
 		router := configRouter(
-			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
+			zapLogger,
+			allowAll{},
+			handlers.NewUserHandler(zapLogger, app.NewUserService(
+				userRepository, subscriptionRespository, memberRepository, usageRepository,
+				repositories.NewNotificationRepository(db), unitOfWork,
+			)),
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
 			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
-				repositoryAllowPauseOnTrial(),
-				userRepository,
+				subscriptionRespository, userRepository, productRepository, voucherStorage, discountService, unitOfWork,
+			)),
+			handlers.NewPriceMigrationHandler(zapLogger, app.NewPriceMigrationService(
+				repositories.NewPriceMigrationRepository(db),
+				subscriptionRespository,
 				productRepository,
 				voucherStorage,
-				&app.DiscountService{},
+				discountService,
+				unitOfWork,
+			)),
+			handlers.NewUsageHandler(zapLogger, app.NewUsageService(
+				usageRepository, subscriptionRespository, productRepository,
+			)),
+			handlers.NewMemberHandler(zapLogger, app.NewMemberService(
+				memberRepository, subscriptionRespository, userRepository, unitOfWork,
+			)),
+			handlers.NewEntitlementHandler(zapLogger, app.NewEntitlementService(
+				userRepository, subscriptionRespository, productRepository, memberRepository,
 			)),
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
 		)
 
-		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
-		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
-		rr := httptest.NewRecorder()
+		const unknownID = "4e6b2a38-7a4d-4a36-9a8b-0c4f3c7c2d11"
+		userPath := fmt.Sprintf("/users/%s", unknownID)
+		productPath := fmt.Sprintf("/products/%s", unknownID)
+		subscriptionPath := fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, unknownID)
+		subscribeBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, product.ProductPlans[0].ID)
 
-		router.ServeHTTP(rr, req)
-		assert.Equal(t, http.StatusCreated, rr.Code)
+		tests := []struct {
+			method string
+			path   string
+			body   string
+		}{
+			{http.MethodGet, userPath, ""},
+			{http.MethodPatch, userPath, `{"name": "Renamed"}`},
+			{http.MethodDelete, userPath, ""},
+			{http.MethodGet, userPath + "/export", ""},
+			{http.MethodGet, userPath + "/entitlements", ""},
+			{http.MethodGet, userPath + "/subscriptions", ""},
+			{http.MethodPost, userPath + "/subscriptions", subscribeBody},
+			{http.MethodGet, productPath, ""},
+			{http.MethodPatch, productPath, `{"name": "Renamed"}`},
+			{http.MethodPost, productPath + "/plans", `{"interval": {"unit": "month", "count": 1}, "price": {"code": "EUR", "number": "10.00"}, "tax": {"code": "EUR", "number": "1.00"}}`},
+			{http.MethodDelete, fmt.Sprintf("/products/%s/plans/%s", product.ID, unknownID), ""},
+			{http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, unknownID, unknownID)},
+			{http.MethodGet, subscriptionPath, ""},
+			{http.MethodPatch, subscriptionPath, `{"action": "pause"}`},
+			{http.MethodPatch, subscriptionPath, `{"action": "unsubscribe"}`},
+			{http.MethodGet, subscriptionPath + "/usage", ""},
+			{http.MethodGet, subscriptionPath + "/members", ""},
+			{http.MethodPost, fmt.Sprintf("/users/%s/memberships/%s/accept", user.ID, unknownID), ""},
+			{http.MethodGet, fmt.Sprintf("/price-migrations/%s", unknownID), ""},
+			{http.MethodDelete, fmt.Sprintf("/price-migrations/%s", unknownID), ""},
+		}
 
-		var subscription domain.Subscription
-		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
-		assert.NoError(t, err)
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s %s", tt.method, tt.path), func(t *testing.T) {
+				req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+				rr := httptest.NewRecorder()
 
-		assert.False(t, subscription.IsPaused)
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, http.StatusNotFound, rr.Code)
+			})
+		}
+	})
+}
 
-		jsonBody = `{"action": "pause"}`
-		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
-		rr = httptest.NewRecorder()
+func TestListProducts(t *testing.T) {
+	RunTestIsolated(func() {
+		createdProducts := createProducts()
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+		req, _ := http.NewRequest(http.MethodGet, "/products", nil)
+		rr := httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
-		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
-		assert.NoError(t, err)
-		assert.True(t, subscription.IsPaused)
+		var products []domain.Product
+		json.Unmarshal(rr.Body.Bytes(), &products)
+
+		assert.Equal(t, len(createdProducts), len(products))
 	})
 }
 
-func TestSubscriptionResumeAfterPause(t *testing.T) {
+func TestListProductsPages(t *testing.T) {
 	RunTestIsolated(func() {
-		user := createUser()
-		createdProducts := createProducts()
-		product := createdProducts[0]
-		productPlan := product.ProductPlans[0]
+		createProducts()
+		productRepository.Save(context.Background(), domain.Product{Name: "Test3"})
 
 		router := configRouter(
+			zapLogger,
+			allowAll{},
 			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
-			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
-				repositoryAllowPauseOnTrial(),
-				userRepository,
-				productRepository,
-				voucherStorage,
-				&app.DiscountService{},
-			)),
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
 		)
 
-		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
-		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
-		rr := httptest.NewRecorder()
+		names := []string{}
+		path := "/products?limit=2&sort=-name"
+		for pages := 0; path != ""; pages++ {
+			assert.Less(t, pages, 2)
 
-		router.ServeHTTP(rr, req)
-		assert.Equal(t, http.StatusCreated, rr.Code)
+			req, _ := http.NewRequest(http.MethodGet, path, nil)
+			rr := httptest.NewRecorder()
 
-		var subscription domain.Subscription
-		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
-		assert.NoError(t, err)
-		assert.False(t, subscription.IsPaused)
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
 
-		jsonBody = `{"action": "pause"}`
-		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
-		rr = httptest.NewRecorder()
+			var products []domain.Product
+			err := json.Unmarshal(rr.Body.Bytes(), &products)
+			assert.NoError(t, err)
+			for _, p := range products {
+				names = append(names, p.Name)
+			}
 
-		router.ServeHTTP(rr, req)
-		assert.Equal(t, http.StatusOK, rr.Code)
+			path = ""
+			if link := rr.Header().Get("Link"); link != "" {
+				path = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			}
+		}
+		assert.Equal(t, []string{"Test3", "Test2", "Test1"}, names)
 
-		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
-		assert.NoError(t, err)
-		assert.True(t, subscription.IsPaused)
+		tests := []struct {
+			query  string
+			status int
+			names  []string
+		}{
+			{"interval=month&intervalCount=3", http.StatusOK, []string{"Test2"}},
+			{"interval=month", http.StatusOK, []string{"Test1", "Test2"}},
+			{"interval=year", http.StatusOK, []string{}},
+			{"createdFrom=2000-01-01T00:00:00Z&createdTo=2001-01-01T00:00:00Z", http.StatusOK, []string{}},
+			{"interval=fortnight", http.StatusBadRequest, nil},
+			{"limit=101", http.StatusBadRequest, nil},
+			{"limit=ten", http.StatusBadRequest, nil},
+			{"sort=price", http.StatusBadRequest, nil},
+			{"cursor=invalid", http.StatusBadRequest, nil},
+			{"createdFrom=yesterday", http.StatusBadRequest, nil},
+		}
 
-		jsonBody = `{"action": "resume"}`
-		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
-		rr = httptest.NewRecorder()
+		for _, tt := range tests {
+			t.Run(tt.query, func(t *testing.T) {
+				req, _ := http.NewRequest(http.MethodGet, "/products?"+tt.query, nil)
+				rr := httptest.NewRecorder()
 
-		router.ServeHTTP(rr, req)
-		assert.Equal(t, http.StatusOK, rr.Code)
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, tt.status, rr.Code)
+				if tt.status != http.StatusOK {
+					return
+				}
 
-		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
-		assert.NoError(t, err)
-		assert.False(t, subscription.IsPaused)
+				var products []domain.Product
+				err := json.Unmarshal(rr.Body.Bytes(), &products)
+				assert.NoError(t, err)
+				names := []string{}
+				for _, p := range products {
+					names = append(names, p.Name)
+				}
+				assert.Equal(t, tt.names, names)
+			})
+		}
 	})
 }
 
-func TestSubscriptionUnsubcribeOutOfTrial(t *testing.T) {
+func TestListSubscriptionsFilters(t *testing.T) {
 	RunTestIsolated(func() {
 		user := createUser()
-		createdProducts := createProducts()
-		product := createdProducts[0]
-		productPlan := product.ProductPlans[0]
+		products := createProducts()
+		subscriptionService := app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
 
 		router := configRouter(
+			zapLogger,
+			allowAll{},
 			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
-			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
-				repositoryAllowPauseOnTrial(),
-				userRepository,
-				productRepository,
-				voucherStorage,
-				&app.DiscountService{},
-			)),
+			&handlers.ProductHandler{},
+			handlers.NewSubscriptionHandler(zapLogger, subscriptionService),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
 		)
 
-		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
-		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		subscriptionsPath := fmt.Sprintf("/users/%s/subscriptions", user.ID)
+		req, _ := http.NewRequest(http.MethodGet, subscriptionsPath, nil)
 		rr := httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
-		assert.Equal(t, http.StatusCreated, rr.Code)
-
-		var subscription domain.Subscription
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "[]", rr.Body.String())
 
-		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		canceled, _, err := subscriptionService.Subscribe(
+			context.Background(), user.ID, products[0].ID, products[0].ProductPlans[0].ID, "", 1,
+		)
+		assert.NoError(t, err)
+		_, err = subscriptionService.Unsubscribe(context.Background(), user.ID, canceled.ID, 0)
+		assert.NoError(t, err)
+		active, _, err := subscriptionService.Subscribe(
+			context.Background(), user.ID, products[1].ID, products[1].ProductPlans[2].ID, "", 1,
+		)
 		assert.NoError(t, err)
-		assert.False(t, subscription.IsPaused)
 
-		jsonBody = `{"action": "unsubscribe"}`
-		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
+		tests := []struct {
+			query  string
+			status int
+			ids    []string
+		}{
+			{"", http.StatusOK, []string{canceled.ID, active.ID}},
+			{"sort=-createdAt", http.StatusOK, []string{active.ID, canceled.ID}},
+			{"status=canceled", http.StatusOK, []string{canceled.ID}},
+			{"status=active", http.StatusOK, []string{active.ID}},
+			{"status=paused", http.StatusOK, []string{}},
+			{"productId=" + products[1].ID, http.StatusOK, []string{active.ID}},
+			{"interval=month&intervalCount=3", http.StatusOK, []string{active.ID}},
+			{"status=active&productId=" + products[0].ID, http.StatusOK, []string{}},
+			{"status=expired", http.StatusBadRequest, nil},
+			{"limit=-1", http.StatusBadRequest, nil},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.query, func(t *testing.T) {
+				req, _ := http.NewRequest(http.MethodGet, subscriptionsPath+"?"+tt.query, nil)
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, tt.status, rr.Code)
+				if tt.status != http.StatusOK {
+					return
+				}
+
+				var subscriptions []domain.Subscription
+				err := json.Unmarshal(rr.Body.Bytes(), &subscriptions)
+				assert.NoError(t, err)
+				ids := []string{}
+				for _, s := range subscriptions {
+					ids = append(ids, s.ID)
+				}
+				assert.Equal(t, tt.ids, ids)
+			})
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, subscriptionsPath+"?limit=1", nil)
 		rr = httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
 		assert.Equal(t, http.StatusOK, rr.Code)
-
-		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
-		assert.NoError(t, err)
-		assert.False(t, subscription.IsActive)
+		assert.Contains(t, rr.Header().Get("Link"), "cursor=")
+		assert.Contains(t, rr.Body.String(), canceled.ID)
 	})
 }
 
-func TestSubscriptionUnsubcribeDuringTrial(t *testing.T) {
+func TestSearchSubscriptions(t *testing.T) {
 	RunTestIsolated(func() {
 		user := createUser()
-		createdProducts := createProducts()
-		product := createdProducts[0]
-		productPlan := product.ProductPlans[0]
+		other, _ := userRepository.Save(context.Background(), domain.User{Name: "Other", Email: "other@email.com"})
+		products := createProducts()
+		subscriptionService := app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
 
 		router := configRouter(
+			zapLogger,
+			allowAll{},
 			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
+			&handlers.ProductHandler{},
+			handlers.NewSubscriptionHandler(zapLogger, subscriptionService),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		voucherID := "b86b4903-2043-4f71-b154-efec19fbc55a"
+		withVoucher, _, err := subscriptionService.Subscribe(
+			context.Background(), user.ID, products[0].ID, products[0].ProductPlans[0].ID, voucherID, 1,
+		)
+		assert.NoError(t, err)
+		canceled, _, err := subscriptionService.Subscribe(
+			context.Background(), other.ID, products[1].ID, products[1].ProductPlans[2].ID, "", 1,
+		)
+		assert.NoError(t, err)
+		_, err = subscriptionService.Unsubscribe(context.Background(), other.ID, canceled.ID, 0)
+		assert.NoError(t, err)
+
+		now := time.Now().UTC()
+		tests := []struct {
+			query  string
+			status int
+			ids    []string
+		}{
+			{"", http.StatusOK, []string{withVoucher.ID, canceled.ID}},
+			{"status=canceled", http.StatusOK, []string{canceled.ID}},
+			{"status=paused&productId=" + products[1].ID, http.StatusOK, []string{}},
+			{"productId=" + products[0].ID, http.StatusOK, []string{withVoucher.ID}},
+			{"planId=" + products[1].ProductPlans[2].ID, http.StatusOK, []string{canceled.ID}},
+			{"planId=" + products[1].ProductPlans[0].ID, http.StatusOK, []string{}},
+			{"voucherId=" + voucherID, http.StatusOK, []string{withVoucher.ID}},
+			{"voucherId=" + voucherID + "&status=canceled", http.StatusOK, []string{}},
+			{"email=other@email.com", http.StatusOK, []string{canceled.ID}},
+			{"email=nobody@email.com", http.StatusOK, []string{}},
+			{"trialEndFrom=" + now.Format(time.RFC3339), http.StatusOK, []string{withVoucher.ID, canceled.ID}},
+			{"trialEndTo=" + now.Format(time.RFC3339), http.StatusOK, []string{}},
+			{"endTo=" + now.AddDate(0, 3, 0).Format(time.RFC3339), http.StatusOK, []string{withVoucher.ID}},
+			{"endFrom=" + now.AddDate(0, 3, 0).Format(time.RFC3339), http.StatusOK, []string{canceled.ID}},
+			{"limit=1", http.StatusOK, []string{withVoucher.ID}},
+			{"status=expired", http.StatusBadRequest, nil},
+			{"endFrom=tomorrow", http.StatusBadRequest, nil},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.query, func(t *testing.T) {
+				req, _ := http.NewRequest(http.MethodGet, "/admin/subscriptions?"+tt.query, nil)
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, tt.status, rr.Code)
+				if tt.status != http.StatusOK {
+					return
+				}
+
+				var results []struct {
+					ID     string `json:"id"`
+					UserID string `json:"userId"`
+				}
+				err := json.Unmarshal(rr.Body.Bytes(), &results)
+				assert.NoError(t, err)
+				ids := []string{}
+				for _, r := range results {
+					ids = append(ids, r.ID)
+					if r.ID == canceled.ID {
+						assert.Equal(t, other.ID, r.UserID)
+					}
+				}
+				assert.Equal(t, tt.ids, ids)
+			})
+		}
+	})
+}
+
+func TestFetchSingleProduct(t *testing.T) {
+	RunTestIsolated(func() {
+		createdProducts := createProducts()
+		expectedProduct := createdProducts[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/products/%s", expectedProduct.ID), nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var product domain.Product
+		json.Unmarshal(rr.Body.Bytes(), &product)
+
+		assert.Equal(t, expectedProduct.ID, product.ID)
+		assert.Equal(t, expectedProduct.Name, product.Name)
+		assert.Equal(t, len(expectedProduct.ProductPlans), len(product.ProductPlans))
+	})
+}
+
+func TestUpdateProduct(t *testing.T) {
+	RunTestIsolated(func() {
+		createdProducts := createProducts()
+		expectedProduct := createdProducts[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+		jsonBody := `{"name": "Renamed"}`
+		req, _ := http.NewRequest(http.MethodPatch, fmt.Sprintf("/products/%s", expectedProduct.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/products/%s", expectedProduct.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var product domain.Product
+		err := json.Unmarshal(rr.Body.Bytes(), &product)
+		assert.NoError(t, err)
+		assert.Equal(t, "Renamed", product.Name)
+		assert.Equal(t, len(expectedProduct.ProductPlans), len(product.ProductPlans))
+	})
+}
+
+func TestAddAndRetireProductPlan(t *testing.T) {
+	RunTestIsolated(func() {
+		createdProducts := createProducts()
+		expectedProduct := createdProducts[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+		jsonBody := `{"interval": {"unit": "year", "count": 1}, "price": {"code": "EUR", "number": "900.00"}, "tax": {"code": "EUR", "number": "90.00"}}`
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/products/%s/plans", expectedProduct.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var plan domain.ProductPlan
+		err := json.Unmarshal(rr.Body.Bytes(), &plan)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, plan.ID)
+		assert.Equal(t, domain.Interval{Unit: domain.IntervalYear, Count: 1}, plan.Interval)
+		assert.Equal(t, 1, plan.Version)
+
+		req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("/products/%s/plans/%s", expectedProduct.ID, plan.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		err = json.Unmarshal(rr.Body.Bytes(), &plan)
+		assert.NoError(t, err)
+		assert.True(t, plan.IsRetired)
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/products/%s", expectedProduct.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var product domain.Product
+		err = json.Unmarshal(rr.Body.Bytes(), &product)
+		assert.NoError(t, err)
+		assert.Equal(t, len(expectedProduct.ProductPlans), len(product.ProductPlans))
+
+		jsonBody = `{"price": {"code": "EUR", "number": "800.00"}}`
+		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/products/%s/plans/%s", expectedProduct.ID, plan.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusLocked, rr.Code)
+	})
+}
+
+func TestArchiveProduct(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		other, _ := userRepository.Save(context.Background(), domain.User{Name: "Other", Email: "other@email.com"})
+		createdProducts := createProducts()
+		product := createdProducts[0]
+
+		subscriptionService := app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, subscriptionService),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		subscription, _, err := subscriptionService.Subscribe(
+			context.Background(), user.ID, product.ID, product.ProductPlans[0].ID, "", 1,
+		)
+		assert.NoError(t, err)
+
+		archivePath := fmt.Sprintf("/products/%s/archive", product.ID)
+		req, _ := http.NewRequest(http.MethodPost, archivePath, nil)
+		req.Header.Set("If-Match", `"2"`)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, archivePath, nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var archived domain.Product
+		err = json.Unmarshal(rr.Body.Bytes(), &archived)
+		assert.NoError(t, err)
+		assert.True(t, archived.IsArchived)
+		assert.NotNil(t, archived.ArchiveDate)
+
+		req, _ = http.NewRequest(http.MethodPost, archivePath, nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "archiving an archived product changes nothing")
+
+		req, _ = http.NewRequest(http.MethodGet, "/products", nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var products []domain.Product
+		err = json.Unmarshal(rr.Body.Bytes(), &products)
+		assert.NoError(t, err)
+		assert.Len(t, products, len(createdProducts)-1)
+		for _, p := range products {
+			assert.NotEqual(t, product.ID, p.ID)
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/products/%s", product.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "an archived product can still be fetched")
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, product.ProductPlans[0].ID)
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", other.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusLocked, rr.Code, "an archived product can't be subscribed")
+
+		req, _ = http.NewRequest(http.MethodPost, "/products", strings.NewReader(fmt.Sprintf(`{"name": "Bundle", "bundle": [{"id": "%s"}]}`, product.ID)))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "an archived product can't be bundled")
+
+		renewed, err := subscriptionService.Renew(context.Background(), subscription.EndDate.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, renewed, "subscriptions of an archived product keep being renewed")
+	})
+}
+
+func TestProductPlanPriceChangeCreatesVersion(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
 			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
 				subscriptionRespository,
 				userRepository,
 				productRepository,
 				voucherStorage,
 				&app.DiscountService{},
+				unitOfWork,
 			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
 		)
 
 		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
@@ -399,13 +1020,27 @@ func TestSubscriptionUnsubcribeDuringTrial(t *testing.T) {
 		assert.Equal(t, http.StatusCreated, rr.Code)
 
 		var subscription domain.Subscription
-
 		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
 		assert.NoError(t, err)
-		assert.False(t, subscription.IsPaused)
 
-		jsonBody = `{"action": "unsubscribe"}`
-		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
+		planBody := `{"price": {"code": "EUR", "number": "120.00"}}`
+		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/products/%s/plans/%s", product.ID, productPlan.ID), strings.NewReader(planBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var plan domain.ProductPlan
+		err = json.Unmarshal(rr.Body.Bytes(), &plan)
+		assert.NoError(t, err)
+		assert.NotEqual(t, productPlan.ID, plan.ID)
+		assert.Equal(t, productPlan.ID, plan.PreviousPlanID)
+		assert.Equal(t, 2, plan.Version)
+		assert.Equal(t, "120.00", plan.Price.Number)
+		assert.Equal(t, productPlan.Tax, plan.Tax)
+		assert.Equal(t, productPlan.Interval, plan.Interval)
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), nil)
 		rr = httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
@@ -413,11 +1048,18 @@ func TestSubscriptionUnsubcribeDuringTrial(t *testing.T) {
 
 		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
 		assert.NoError(t, err)
-		assert.False(t, subscription.IsActive)
+		assert.Equal(t, productPlan.Price.Number, subscription.SubscriptionPlan.Price.Number)
+
+		otherUser, _ := userRepository.Save(context.Background(), domain.User{Name: "Other", Email: "other@email.com"})
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", otherUser.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
 }
 
-func TestSubscriptionCreationFixedAmountVoucher(t *testing.T) {
+func TestSubscriptionNoVoucher(t *testing.T) {
 	RunTestIsolated(func() {
 		user := createUser()
 		createdProducts := createProducts()
@@ -425,19 +1067,27 @@ func TestSubscriptionCreationFixedAmountVoucher(t *testing.T) {
 		productPlan := product.ProductPlans[0]
 
 		router := configRouter(
+			zapLogger,
+			allowAll{},
 			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
 			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
 				subscriptionRespository,
 				userRepository,
 				productRepository,
 				voucherStorage,
 				&app.DiscountService{},
+				unitOfWork,
 			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
 		)
 
-		fixedAmountVoucherID := "b86b4903-2043-4f71-b154-efec19fbc55a" // 5.00
-		jsonBody := fmt.Sprintf(`{"productId": "%s", "planId": "%s", "voucherId": "%s"}`, product.ID, productPlan.ID, fixedAmountVoucherID)
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
 		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
 		rr := httptest.NewRecorder()
 
@@ -451,15 +1101,13 @@ func TestSubscriptionCreationFixedAmountVoucher(t *testing.T) {
 		assert.NotEmpty(t, subscription.ID)
 		assert.Equal(t, product.ID, subscription.Product.ID)
 		assert.NotEqual(t, productPlan.ID, subscription.SubscriptionPlan.ID)
-		assert.Equal(t, productPlan.Length, subscription.SubscriptionPlan.Length)
-		assert.Equal(t, "95.00", subscription.SubscriptionPlan.Price.Number) // fixed value discount: 5
+		assert.Equal(t, productPlan.Interval, subscription.SubscriptionPlan.Interval)
 		assert.Equal(t, productPlan.Price.Code, subscription.SubscriptionPlan.Price.Code)
-		assert.Equal(t, "9.50", subscription.SubscriptionPlan.Tax.Number) // percentage discount: 5% = 0.50
-		assert.Equal(t, productPlan.Tax.Code, subscription.SubscriptionPlan.Tax.Code)
+		assert.Equal(t, productPlan.Price.Number, subscription.SubscriptionPlan.Price.Number)
 	})
 }
 
-func TestSubscriptionCreationPercentageVoucher(t *testing.T) {
+func TestFetchSubscription(t *testing.T) {
 	RunTestIsolated(func() {
 		user := createUser()
 		createdProducts := createProducts()
@@ -467,119 +1115,3230 @@ func TestSubscriptionCreationPercentageVoucher(t *testing.T) {
 		productPlan := product.ProductPlans[0]
 
 		router := configRouter(
+			zapLogger,
+			allowAll{},
 			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
 			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
 				subscriptionRespository,
 				userRepository,
 				productRepository,
 				voucherStorage,
 				&app.DiscountService{},
+				unitOfWork,
 			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
 		)
 
-		fixedAmountVoucherID := "4976ff21-a188-4bcc-97a0-2cf2278e9a6b" // 10.10
-		jsonBody := fmt.Sprintf(`{"productId": "%s", "planId": "%s", "voucherId": "%s"}`, product.ID, productPlan.ID, fixedAmountVoucherID)
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
 		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
 		rr := httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
-
 		assert.Equal(t, http.StatusCreated, rr.Code)
 
 		var subscription domain.Subscription
 		json.Unmarshal(rr.Body.Bytes(), &subscription)
 
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		json.Unmarshal(rr.Body.Bytes(), &subscription)
+
 		assert.NotEmpty(t, subscription.ID)
 		assert.Equal(t, product.ID, subscription.Product.ID)
 		assert.NotEqual(t, productPlan.ID, subscription.SubscriptionPlan.ID)
-		assert.Equal(t, productPlan.Length, subscription.SubscriptionPlan.Length)
-		assert.Equal(t, "89.90", subscription.SubscriptionPlan.Price.Number) // percentage discount: 10.10% = 10.10
+		assert.Equal(t, productPlan.Interval, subscription.SubscriptionPlan.Interval)
 		assert.Equal(t, productPlan.Price.Code, subscription.SubscriptionPlan.Price.Code)
-		assert.Equal(t, "8.99", subscription.SubscriptionPlan.Tax.Number) // percentage discount: 10.10% = 1.01
-		assert.Equal(t, productPlan.Tax.Code, subscription.SubscriptionPlan.Tax.Code)
+		assert.Equal(t, productPlan.Price.Number, subscription.SubscriptionPlan.Price.Number)
 	})
 }
 
-func TestSubscriptionCreationInactiveVoucher(t *testing.T) {
+func TestSubscriptionEndDateFollowsPlanInterval(t *testing.T) {
 	RunTestIsolated(func() {
 		user := createUser()
-		createdProducts := createProducts()
-		product := createdProducts[0]
+		product, _ := productRepository.Save(context.Background(), domain.Product{
+			Name: "Day Pass",
+			ProductPlans: []domain.ProductPlan{
+				{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalDay, Count: 10}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "30.00"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "3.00"}}},
+			},
+		})
 		productPlan := product.ProductPlans[0]
 
 		router := configRouter(
+			zapLogger,
+			allowAll{},
 			&handlers.UserHandler{},
-			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository)),
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
 			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
 				subscriptionRespository,
 				userRepository,
 				productRepository,
 				voucherStorage,
 				&app.DiscountService{},
+				unitOfWork,
 			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
 		)
 
-		fixedAmountVoucherID := "18c4b4ea-6fce-4ee7-8d3b-a16047a8789e" // inactive
-		jsonBody := fmt.Sprintf(`{"productId": "%s", "planId": "%s", "voucherId": "%s"}`, product.ID, productPlan.ID, fixedAmountVoucherID)
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
 		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
 		rr := httptest.NewRecorder()
 
 		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
 
-		assert.Equal(t, http.StatusConflict, rr.Code)
+		var subscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.Equal(t, productPlan.Interval, subscription.SubscriptionPlan.Interval)
+		assert.True(t, subscription.TrialDate.AddDate(0, 0, 10).Equal(*subscription.EndDate))
 	})
 }
 
-func createUser() domain.User {
-	u, _ := userRepository.Save(domain.User{
-		Name:  "Tester",
-		Email: "tester@email.com",
-	})
-	return u
-}
+func TestCreateProductInvalidInterval(t *testing.T) {
+	RunTestIsolated(func() {
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
 
-func createProducts() []domain.Product {
-	p, _ := productRepository.Save(domain.Product{
-		Name: "Test1",
-		ProductPlans: []domain.ProductPlan{
-			{Plan: &domain.Plan{Length: 1, Price: domain.Money{Code: domain.CurrencyEUR, Number: "100.00"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "10.00"}}},
-			{Plan: &domain.Plan{Length: 2, Price: domain.Money{Code: domain.CurrencyEUR, Number: "50.00"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "5.50"}}},
-		},
-	})
+		jsonBody := `{"name": "Invalid", "plans": [{"interval": {"unit": "decade", "count": 1}, "price": {"code": "EUR", "number": "1.00"}, "tax": {"code": "EUR", "number": "0.10"}}]}`
+		req, _ := http.NewRequest(http.MethodPost, "/products", strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
 
-	p2, _ := productRepository.Save(domain.Product{
-		Name: "Test2",
-		ProductPlans: []domain.ProductPlan{
-			{Plan: &domain.Plan{Length: 1, Price: domain.Money{Code: domain.CurrencyEUR, Number: "12.99"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "5.99"}}},
-			{Plan: &domain.Plan{Length: 2, Price: domain.Money{Code: domain.CurrencyEUR, Number: "21.99"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "4.99"}}},
-			{Plan: &domain.Plan{Length: 3, Price: domain.Money{Code: domain.CurrencyEUR, Number: "20.99"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "3.99"}}},
-		},
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
 	})
-
-	return append([]domain.Product{}, p, p2)
 }
 
-func truncateTables() {
-	db.Exec("DELETE FROM subscriptions;")
-	db.Exec("DELETE FROM products;")
-	db.Exec("DELETE FROM users;")
-}
+func TestSubscriptionPauseDuringTrial(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
 
-func repositoryAllowPauseOnTrial() domain.SubscriptionRepository {
-	return &mocks.MockSubscriptionRepository{
-		SaveFunc: func(u domain.User) (domain.Subscription, error) {
-			return subscriptionRespository.Save(u)
-		},
-		GetFunc: func(subscriptionID string) (domain.Subscription, error) {
-			s, _ := subscriptionRespository.Get(subscriptionID)
-			// set TrialDate has it had already passed
-			hours := 24 * 30 * app.TrialPeriod * 2
-			s.TrialDate = s.TrialDate.Add(-time.Duration(hours) * time.Hour)
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		json.Unmarshal(rr.Body.Bytes(), &subscription)
+
+		jsonBody = `{"action": "pause"}`
+		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusLocked, rr.Code)
+	})
+}
+
+func TestSubscriptionPauseAfterTrial(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				repositoryAllowPauseOnTrial(),
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+
+		assert.False(t, subscription.IsPaused)
+
+		jsonBody = `{"action": "pause"}`
+		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.True(t, subscription.IsPaused)
+	})
+}
+
+func TestSubscriptionResumeAfterPause(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				repositoryAllowPauseOnTrial(),
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.False(t, subscription.IsPaused)
+
+		jsonBody = `{"action": "pause"}`
+		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.True(t, subscription.IsPaused)
+
+		jsonBody = `{"action": "resume"}`
+		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.False(t, subscription.IsPaused)
+	})
+}
+
+func TestSubscriptionResumeKeepsPeriodLeft(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		subscriptionService := app.NewSubscriptionService(
+			repositoryAllowPauseOnTrial(),
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+
+		subscription, _, err := subscriptionService.Subscribe(context.Background(), user.ID, product.ID, productPlan.ID, "", 1)
+		assert.NoError(t, err)
+
+		// the subscription is in its third period
+		renewalAnchor := time.Now().AddDate(0, -2, -10)
+		endDate := renewalAnchor.AddDate(0, 3, 0)
+		subscription, err = subscriptionRespository.Update(context.Background(), subscription, domain.ToUpdate{
+			repositories.RenewalAnchor: renewalAnchor,
+			repositories.EndDate:       &endDate,
+		})
+		assert.NoError(t, err)
+
+		paused, err := subscriptionService.Pause(context.Background(), user.ID, subscription.ID, 0)
+		assert.NoError(t, err)
+		assert.Nil(t, paused.EndDate)
+
+		resumed, err := subscriptionService.Resume(context.Background(), user.ID, subscription.ID, 0)
+		assert.NoError(t, err)
+		assert.WithinDuration(t, endDate, *resumed.EndDate, time.Second, "the time left in the period is kept")
+
+		subscriptionService = app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		renewed, err := subscriptionService.Renew(context.Background(), time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, renewed)
+
+		renewedAt := resumed.EndDate.Add(time.Hour)
+		renewed, err = subscriptionService.Renew(context.Background(), renewedAt)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, renewed)
+
+		subscription, err = subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.NoError(t, err)
+		// the next period is counted from the end of the resumed one
+		assert.True(t, subscription.EndDate.After(resumed.EndDate.AddDate(0, 0, 27)))
+		assert.False(t, subscription.EndDate.After(resumed.EndDate.AddDate(0, 0, 31)))
+	})
+}
+
+func TestSubscriptionRenewAtMonthEnd(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		subscriptionService := app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+
+		subscription, _, err := subscriptionService.Subscribe(context.Background(), user.ID, product.ID, productPlan.ID, "", 1)
+		assert.NoError(t, err)
+
+		renewalAnchor := time.Date(2022, time.January, 31, 10, 30, 0, 0, time.UTC)
+		endDate := time.Date(2022, time.February, 28, 10, 30, 0, 0, time.UTC)
+		_, err = subscriptionRespository.Update(context.Background(), subscription, domain.ToUpdate{
+			repositories.RenewalAnchor: renewalAnchor,
+			repositories.EndDate:       &endDate,
+		})
+		assert.NoError(t, err)
+
+		for _, expected := range []time.Time{
+			time.Date(2022, time.March, 31, 10, 30, 0, 0, time.UTC),
+			time.Date(2022, time.April, 30, 10, 30, 0, 0, time.UTC),
+			time.Date(2022, time.May, 31, 10, 30, 0, 0, time.UTC),
+		} {
+			renewed, err := subscriptionService.Renew(context.Background(), endDate.Add(time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, renewed)
+
+			subscription, err = subscriptionRespository.Get(context.Background(), subscription.ID)
+			assert.NoError(t, err)
+			assert.True(t, expected.Equal(*subscription.EndDate), "expected %s, got %s", expected, subscription.EndDate)
+			endDate = *subscription.EndDate
+		}
+	})
+}
+
+func TestSubscriptionUnsubcribeOutOfTrial(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				repositoryAllowPauseOnTrial(),
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.False(t, subscription.IsPaused)
+
+		jsonBody = `{"action": "unsubscribe"}`
+		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.False(t, subscription.IsActive)
+	})
+}
+
+func TestSubscriptionUnsubcribeDuringTrial(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.False(t, subscription.IsPaused)
+
+		jsonBody = `{"action": "unsubscribe"}`
+		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.False(t, subscription.IsActive)
+	})
+}
+
+func TestSubscriptionCreationFixedAmountVoucher(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		fixedAmountVoucherID := "b86b4903-2043-4f71-b154-efec19fbc55a" // 5.00
+		jsonBody := fmt.Sprintf(`{"productId": "%s", "planId": "%s", "voucherId": "%s"}`, product.ID, productPlan.ID, fixedAmountVoucherID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		json.Unmarshal(rr.Body.Bytes(), &subscription)
+
+		assert.NotEmpty(t, subscription.ID)
+		assert.Equal(t, product.ID, subscription.Product.ID)
+		assert.NotEqual(t, productPlan.ID, subscription.SubscriptionPlan.ID)
+		assert.Equal(t, productPlan.Interval, subscription.SubscriptionPlan.Interval)
+		assert.Equal(t, "95.00", subscription.SubscriptionPlan.Price.Number) // fixed value discount: 5
+		assert.Equal(t, productPlan.Price.Code, subscription.SubscriptionPlan.Price.Code)
+		assert.Equal(t, "9.50", subscription.SubscriptionPlan.Tax.Number) // percentage discount: 5% = 0.50
+		assert.Equal(t, productPlan.Tax.Code, subscription.SubscriptionPlan.Tax.Code)
+	})
+}
+
+func TestSubscriptionCreationPercentageVoucher(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		fixedAmountVoucherID := "4976ff21-a188-4bcc-97a0-2cf2278e9a6b" // 10.10
+		jsonBody := fmt.Sprintf(`{"productId": "%s", "planId": "%s", "voucherId": "%s"}`, product.ID, productPlan.ID, fixedAmountVoucherID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		json.Unmarshal(rr.Body.Bytes(), &subscription)
+
+		assert.NotEmpty(t, subscription.ID)
+		assert.Equal(t, product.ID, subscription.Product.ID)
+		assert.NotEqual(t, productPlan.ID, subscription.SubscriptionPlan.ID)
+		assert.Equal(t, productPlan.Interval, subscription.SubscriptionPlan.Interval)
+		assert.Equal(t, "89.90", subscription.SubscriptionPlan.Price.Number) // percentage discount: 10.10% = 10.10
+		assert.Equal(t, productPlan.Price.Code, subscription.SubscriptionPlan.Price.Code)
+		assert.Equal(t, "8.99", subscription.SubscriptionPlan.Tax.Number) // percentage discount: 10.10% = 1.01
+		assert.Equal(t, productPlan.Tax.Code, subscription.SubscriptionPlan.Tax.Code)
+	})
+}
+
+func TestSubscriptionCreationInactiveVoucher(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		fixedAmountVoucherID := "18c4b4ea-6fce-4ee7-8d3b-a16047a8789e" // inactive
+		jsonBody := fmt.Sprintf(`{"productId": "%s", "planId": "%s", "voucherId": "%s"}`, product.ID, productPlan.ID, fixedAmountVoucherID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+}
+
+func TestSubscriptionAlreadySubscribed(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var existingSubscription domain.Subscription
+		err = json.Unmarshal(rr.Body.Bytes(), &existingSubscription)
+		assert.NoError(t, err)
+		assert.Equal(t, subscription.ID, existingSubscription.ID)
+	})
+}
+
+func TestResubscriptionAfterCancellation(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var canceledSubscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &canceledSubscription)
+		assert.NoError(t, err)
+
+		actionBody := `{"action": "unsubscribe"}`
+		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, canceledSubscription.ID), strings.NewReader(actionBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.NotEqual(t, canceledSubscription.ID, subscription.ID)
+		assert.True(t, subscription.IsActive)
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, canceledSubscription.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		err = json.Unmarshal(rr.Body.Bytes(), &canceledSubscription)
+		assert.NoError(t, err)
+		assert.False(t, canceledSubscription.IsActive)
+		assert.NotNil(t, canceledSubscription.CancelDate)
+	})
+}
+
+func TestResubscriptionWithinWinBackPeriod(t *testing.T) {
+	t.Setenv("WIN_BACK_PERIOD_DAYS", "30")
+
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var canceledSubscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &canceledSubscription)
+		assert.NoError(t, err)
+
+		actionBody := `{"action": "unsubscribe"}`
+		req, _ = http.NewRequest(http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, canceledSubscription.ID), strings.NewReader(actionBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.Equal(t, canceledSubscription.ID, subscription.ID)
+		assert.True(t, subscription.IsActive)
+		assert.Nil(t, subscription.CancelDate)
+
+		// subscribing again once reactivated is reported apart
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestPriceMigration(t *testing.T) {
+	RunTestIsolated(func() {
+		grandfatheredUser := createUser()
+		user, _ := userRepository.Save(context.Background(), domain.User{Name: "Other", Email: "other@email.com"})
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		priceMigrationService := app.NewPriceMigrationService(
+			repositories.NewPriceMigrationRepository(db),
+			subscriptionRespository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			handlers.NewPriceMigrationHandler(zapLogger, priceMigrationService),
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", grandfatheredUser.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var grandfatheredSubscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &grandfatheredSubscription)
+		assert.NoError(t, err)
+
+		grandfatheredUntil := grandfatheredSubscription.StartDate.Add(time.Millisecond)
+		time.Sleep(2 * time.Millisecond)
+
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		err = json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+
+		for _, prices := range []map[string]interface{}{
+			{"targetPrice": domain.Money{Code: "USD", Number: "110.00"}},
+			{"targetPrice": domain.Money{Code: domain.CurrencyEUR, Number: "110.00"}, "targetTax": domain.Money{Code: "USD", Number: "11.00"}},
+		} {
+			prices["productId"] = product.ID
+			prices["planId"] = productPlan.ID
+			prices["effectiveDate"] = time.Now().AddDate(0, 0, 8)
+			otherCurrencyBody, _ := json.Marshal(prices)
+			req, _ = http.NewRequest(http.MethodPost, "/price-migrations", strings.NewReader(string(otherCurrencyBody)))
+			rr = httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, "the target prices must be in the currency of the plan")
+		}
+
+		migrationBody, _ := json.Marshal(map[string]interface{}{
+			"productId":          product.ID,
+			"planId":             productPlan.ID,
+			"targetPrice":        domain.Money{Code: domain.CurrencyEUR, Number: "110.00"},
+			"noticeDays":         7,
+			"effectiveDate":      time.Now().AddDate(0, 0, 8),
+			"grandfatheredUntil": grandfatheredUntil,
+		})
+		req, _ = http.NewRequest(http.MethodPost, "/price-migrations", strings.NewReader(string(migrationBody)))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var migration domain.PriceMigration
+		err = json.Unmarshal(rr.Body.Bytes(), &migration)
+		assert.NoError(t, err)
+		assert.Equal(t, productPlan.Tax, migration.TargetTax)
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/price-migrations/%s/preview", migration.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var candidates []domain.MigrationCandidate
+		err = json.Unmarshal(rr.Body.Bytes(), &candidates)
+		assert.NoError(t, err)
+		assert.Len(t, candidates, 2)
+
+		for _, candidate := range candidates {
+			if candidate.SubscriptionID == grandfatheredSubscription.ID {
+				assert.True(t, candidate.IsGrandfathered)
+				continue
+			}
+			assert.False(t, candidate.IsGrandfathered)
+			assert.Equal(t, "110.00", candidate.TargetPrice.Number)
+			assert.WithinDuration(t, *subscription.EndDate, *candidate.MigrationDate, time.Second)
+		}
+
+		migrated, err := priceMigrationService.Apply(context.Background(), time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, migrated)
+
+		migrated, err = priceMigrationService.Apply(context.Background(), subscription.EndDate.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, migrated)
+
+		migrated, err = priceMigrationService.Apply(context.Background(), subscription.EndDate.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, migrated)
+
+		migratedSubscription, _ := subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.Equal(t, "110.00", migratedSubscription.SubscriptionPlan.Price.Number)
+
+		grandfatheredSubscription, _ = subscriptionRespository.Get(context.Background(), grandfatheredSubscription.ID)
+		assert.Equal(t, productPlan.Price.Number, grandfatheredSubscription.SubscriptionPlan.Price.Number)
+
+		migration, _ = priceMigrationService.Fetch(context.Background(), migration.ID)
+		assert.NotNil(t, migration.CompleteDate, "the migration is complete once no subscription is left to migrate")
+
+		req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("/price-migrations/%s", migration.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusLocked, rr.Code, "a complete migration can't be canceled")
+
+		_, err = repositories.NewPriceMigrationRepository(db).Update(
+			context.Background(), migration, domain.ToUpdate{repositories.IsCanceled: true},
+		)
+		assert.Error(t, err, "only pending migrations are updated")
+
+		migration, _ = priceMigrationService.Fetch(context.Background(), migration.ID)
+		assert.False(t, migration.IsCanceled)
+	})
+}
+
+func TestPriceMigrationsOnSamePlan(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		priceMigrationService := app.NewPriceMigrationService(
+			repositories.NewPriceMigrationRepository(db),
+			subscriptionRespository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		subscriptionService := app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+
+		subscription, _, err := subscriptionService.Subscribe(context.Background(), user.ID, product.ID, productPlan.ID, "", 1)
+		assert.NoError(t, err)
+
+		first, err := priceMigrationService.Schedule(context.Background(), domain.PriceMigration{
+			ProductID:     product.ID,
+			ProductPlanID: productPlan.ID,
+			TargetPrice:   domain.Money{Code: domain.CurrencyEUR, Number: "110.00"},
+			EffectiveDate: time.Now().AddDate(0, 0, 1),
+		})
+		assert.NoError(t, err)
+		second, err := priceMigrationService.Schedule(context.Background(), domain.PriceMigration{
+			ProductID:     product.ID,
+			ProductPlanID: productPlan.ID,
+			TargetPrice:   domain.Money{Code: domain.CurrencyEUR, Number: "120.00"},
+			EffectiveDate: time.Now().AddDate(0, 0, 2),
+		})
+		assert.NoError(t, err)
+
+		// renewing the subscription first doesn't move its migration date
+		renewed, err := subscriptionService.Renew(context.Background(), subscription.EndDate.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, renewed)
+
+		migrated, err := priceMigrationService.Apply(context.Background(), subscription.EndDate.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, migrated, "the subscription moves straight to the latest price")
+
+		migrated, err = priceMigrationService.Apply(context.Background(), subscription.EndDate.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, migrated)
+
+		migratedSubscription, _ := subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.Equal(t, "120.00", migratedSubscription.SubscriptionPlan.Price.Number)
+		assert.Equal(t, subscription.Version+2, migratedSubscription.Version)
+
+		for _, migration := range []domain.PriceMigration{first, second} {
+			migration, _ = priceMigrationService.Fetch(context.Background(), migration.ID)
+			assert.NotNil(t, migration.CompleteDate)
+		}
+	})
+}
+
+func TestPriceMigrationNoticePeriod(t *testing.T) {
+	RunTestIsolated(func() {
+		createdProducts := createProducts()
+		product := createdProducts[0]
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			&handlers.ProductHandler{},
+			&handlers.SubscriptionHandler{},
+			handlers.NewPriceMigrationHandler(zapLogger, app.NewPriceMigrationService(
+				repositories.NewPriceMigrationRepository(db),
+				subscriptionRespository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		migrationBody, _ := json.Marshal(map[string]interface{}{
+			"productId":     product.ID,
+			"planId":        productPlan.ID,
+			"targetPrice":   domain.Money{Code: domain.CurrencyEUR, Number: "110.00"},
+			"noticeDays":    30,
+			"effectiveDate": time.Now().AddDate(0, 0, 10),
+		})
+		req, _ := http.NewRequest(http.MethodPost, "/price-migrations", strings.NewReader(string(migrationBody)))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestPriceMigrationSeats(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		seatPrice := domain.Money{Code: domain.CurrencyEUR, Number: "5.00"}
+		product, _ := productRepository.Save(context.Background(), domain.Product{
+			Name: "Family Gym",
+			ProductPlans: []domain.ProductPlan{
+				{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalMonth, Count: 1}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "100.00"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "10.00"}, MaxSeats: 3, SeatPrice: &seatPrice}},
+			},
+		})
+		productPlan := product.ProductPlans[0]
+
+		priceMigrationService := app.NewPriceMigrationService(
+			repositories.NewPriceMigrationRepository(db),
+			subscriptionRespository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			&handlers.ProductHandler{},
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			handlers.NewPriceMigrationHandler(zapLogger, priceMigrationService),
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s","seats": 3}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+
+		migrationBody, _ := json.Marshal(map[string]interface{}{
+			"productId":     product.ID,
+			"planId":        productPlan.ID,
+			"targetPrice":   domain.Money{Code: domain.CurrencyEUR, Number: "120.00"},
+			"effectiveDate": time.Now().AddDate(0, 0, 1),
+		})
+		req, _ = http.NewRequest(http.MethodPost, "/price-migrations", strings.NewReader(string(migrationBody)))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var migration domain.PriceMigration
+		err = json.Unmarshal(rr.Body.Bytes(), &migration)
+		assert.NoError(t, err)
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/price-migrations/%s/preview", migration.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var candidates []domain.MigrationCandidate
+		err = json.Unmarshal(rr.Body.Bytes(), &candidates)
+		assert.NoError(t, err)
+		assert.Len(t, candidates, 1)
+		assert.Equal(t, "130.00", candidates[0].TargetPrice.Number)
+
+		migrated, err := priceMigrationService.Apply(context.Background(), subscription.EndDate.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, migrated)
+
+		migratedSubscription, _ := subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.Equal(t, "130.00", migratedSubscription.SubscriptionPlan.Price.Number)
+		assert.Equal(t, 3, migratedSubscription.Seats)
+	})
+}
+
+func TestAddOnCurrency(t *testing.T) {
+	RunTestIsolated(func() {
+		product := createProducts()[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		tests := []struct {
+			name   string
+			path   string
+			body   string
+			status int
+		}{
+			{
+				"new product with add-on in other currency",
+				"/products",
+				`{"name": "Gym", "plans": [{"interval": {"unit": "month", "count": 1}, "price": {"code": "EUR", "number": "30.00"}, "tax": {"code": "EUR", "number": "3.00"}}], "addOns": [{"key": "guest-pass", "unitPrice": {"code": "USD", "number": "10.00"}}]}`,
+				http.StatusBadRequest,
+			},
+			{
+				"add-on in other currency",
+				fmt.Sprintf("/products/%s/add-ons", product.ID),
+				`{"key": "guest-pass", "unitPrice": {"code": "USD", "number": "10.00"}}`,
+				http.StatusBadRequest,
+			},
+			{
+				"add-on in product currency",
+				fmt.Sprintf("/products/%s/add-ons", product.ID),
+				`{"key": "guest-pass", "unitPrice": {"code": "EUR", "number": "10.00"}}`,
+				http.StatusCreated,
+			},
+			{
+				"plan in other currency",
+				fmt.Sprintf("/products/%s/plans", product.ID),
+				`{"interval": {"unit": "year", "count": 1}, "price": {"code": "USD", "number": "300.00"}, "tax": {"code": "USD", "number": "30.00"}}`,
+				http.StatusBadRequest,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req, _ := http.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, tt.status, rr.Code)
+			})
+		}
+	})
+}
+
+func TestUsageReportAndSummary(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		product, _ := productRepository.Save(context.Background(), domain.Product{
+			Name: "Gym",
+			ProductPlans: []domain.ProductPlan{
+				{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalMonth, Count: 1}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "30.00"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "3.00"}}},
+			},
+			AddOns: []domain.AddOn{
+				{Key: "extra-class", Name: "Extra class", UnitPrice: domain.Money{Code: domain.CurrencyEUR, Number: "7.50"}},
+				{Key: "guest-pass", Name: "Guest pass", UnitPrice: domain.Money{Code: domain.CurrencyEUR, Number: "10.00"}},
+			},
+		})
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			handlers.NewUsageHandler(zapLogger, app.NewUsageService(
+				repositories.NewUsageRepository(db),
+				subscriptionRespository,
+				productRepository,
+			)),
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+
+		usagePath := fmt.Sprintf("/users/%s/subscriptions/%s/usage", user.ID, subscription.ID)
+		usages := []string{
+			fmt.Sprintf(`{"addOnId": "%s", "quantity": 2}`, product.AddOns[0].ID),
+			fmt.Sprintf(`{"addOnId": "%s", "quantity": 3}`, product.AddOns[0].ID),
+			fmt.Sprintf(`{"addOnId": "%s", "quantity": 1}`, product.AddOns[1].ID),
+		}
+		for _, usage := range usages {
+			req, _ = http.NewRequest(http.MethodPost, usagePath, strings.NewReader(usage))
+			rr = httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusCreated, rr.Code)
+		}
+
+		req, _ = http.NewRequest(http.MethodPost, usagePath, strings.NewReader(`{"addOnId": "unknown", "quantity": 1}`))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodGet, usagePath, nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var summary domain.UsageSummary
+		err = json.Unmarshal(rr.Body.Bytes(), &summary)
+		assert.NoError(t, err)
+		assert.Len(t, summary.Items, 2)
+		assert.Equal(t, 5, summary.Items[0].Quantity)
+		assert.Equal(t, "37.50", summary.Items[0].Total.Number)
+		assert.Equal(t, "47.50", summary.Total.Number)
+		assert.True(t, summary.PeriodEnd.Equal(subscription.TrialDate))
+
+		nextPeriod := subscription.TrialDate.Add(time.Hour).Format(time.RFC3339)
+		req, _ = http.NewRequest(http.MethodGet, usagePath+"?at="+nextPeriod, nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		err = json.Unmarshal(rr.Body.Bytes(), &summary)
+		assert.NoError(t, err)
+		assert.Empty(t, summary.Items)
+		assert.Equal(t, "0.00", summary.Total.Number)
+		assert.True(t, summary.PeriodEnd.Equal(*subscription.EndDate))
+	})
+}
+
+func TestGroupMembership(t *testing.T) {
+	RunTestIsolated(func() {
+		owner := createUser()
+		member, _ := userRepository.Save(context.Background(), domain.User{Name: "Member", Email: "member@email.com"})
+		seatPrice := domain.Money{Code: domain.CurrencyEUR, Number: "5.00"}
+		product, _ := productRepository.Save(context.Background(), domain.Product{
+			Name: "Family Gym",
+			ProductPlans: []domain.ProductPlan{
+				{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalMonth, Count: 1}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "100.00"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "10.00"}, MaxSeats: 3, SeatPrice: &seatPrice}},
+			},
+		})
+		productPlan := product.ProductPlans[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			&handlers.ProductHandler{},
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			handlers.NewMemberHandler(zapLogger, app.NewMemberService(
+				repositories.NewMemberRepository(db),
+				subscriptionRespository,
+				userRepository,
+				unitOfWork,
+			)),
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s","seats": 4}`, product.ID, productPlan.ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", owner.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		jsonBody = fmt.Sprintf(`{"productId": "%s","planId": "%s","seats": 3}`, product.ID, productPlan.ID)
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", owner.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, subscription.Seats)
+		assert.Equal(t, "110.00", subscription.SubscriptionPlan.Price.Number)
+
+		membersPath := fmt.Sprintf("/users/%s/subscriptions/%s/members", owner.ID, subscription.ID)
+		var invitation domain.SubscriptionMember
+		for i, email := range []string{"member@email.com", "friend@email.com", "third@email.com"} {
+			req, _ = http.NewRequest(http.MethodPost, membersPath, strings.NewReader(fmt.Sprintf(`{"email": "%s"}`, email)))
+			rr = httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			if i == 2 {
+				assert.Equal(t, http.StatusLocked, rr.Code)
+				continue
+			}
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			if i == 0 {
+				err = json.Unmarshal(rr.Body.Bytes(), &invitation)
+				assert.NoError(t, err)
+				assert.Equal(t, domain.MemberInvited, invitation.Status)
+			}
+		}
+
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/memberships/%s/accept", owner.ID, invitation.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/memberships/%s/accept", member.ID, invitation.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/users/%s/memberships", member.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var memberships []domain.SubscriptionMember
+		err = json.Unmarshal(rr.Body.Bytes(), &memberships)
+		assert.NoError(t, err)
+		assert.Len(t, memberships, 1)
+		assert.Equal(t, subscription.ID, memberships[0].SubscriptionID)
+		assert.Equal(t, domain.MemberActive, memberships[0].Status)
+
+		req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%s", membersPath, invitation.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, membersPath, strings.NewReader(`{"email": "third@email.com"}`))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		extra, _ := userRepository.Save(context.Background(), domain.User{Name: "Extra", Email: "extra@email.com"})
+		overbooked, _ := repositories.NewMemberRepository(db).Save(context.Background(), domain.SubscriptionMember{
+			SubscriptionID: subscription.ID,
+			Email:          extra.Email,
+			Status:         domain.MemberInvited,
+			InviteDate:     time.Now(),
+		})
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/memberships/%s/accept", extra.ID, overbooked.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusLocked, rr.Code, "an invitation past the seats of the subscription can't be accepted")
+
+		otherUserPath := fmt.Sprintf("/users/%s/subscriptions/%s/members", member.ID, subscription.ID)
+		req, _ = http.NewRequest(http.MethodGet, otherUserPath, nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		friend, _ := userRepository.Save(context.Background(), domain.User{Name: "Friend", Email: "friend@email.com"})
+		req, _ = http.NewRequest(http.MethodGet, membersPath, nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var members []domain.SubscriptionMember
+		err = json.Unmarshal(rr.Body.Bytes(), &members)
+		assert.NoError(t, err)
+		var friendInvitation domain.SubscriptionMember
+		for _, m := range members {
+			if m.Email == friend.Email {
+				friendInvitation = m
+			}
+		}
+
+		req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/%s", membersPath, friendInvitation.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/memberships/%s/accept", friend.ID, friendInvitation.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusLocked, rr.Code, "a removed invitation can't be accepted")
+	})
+}
+
+func TestEraseGroupMember(t *testing.T) {
+	RunTestIsolated(func() {
+		owner := createUser()
+		member, _ := userRepository.Save(context.Background(), domain.User{Name: "Member", Email: "member@email.com", Locale: "pt-BR"})
+		invitee, _ := userRepository.Save(context.Background(), domain.User{Name: "Invitee", Email: "invitee@email.com"})
+		seatPrice := domain.Money{Code: domain.CurrencyEUR, Number: "5.00"}
+		product, _ := productRepository.Save(context.Background(), domain.Product{
+			Name: "Family Gym",
+			ProductPlans: []domain.ProductPlan{
+				{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalMonth, Count: 1}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "100.00"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "10.00"}, MaxSeats: 3, SeatPrice: &seatPrice}},
+			},
+		})
+		memberRepository := repositories.NewMemberRepository(db)
+
+		subscriptionService := app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		subscription, _, err := subscriptionService.Subscribe(
+			context.Background(), owner.ID, product.ID, product.ProductPlans[0].ID, "", 3,
+		)
+		assert.NoError(t, err)
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			handlers.NewUserHandler(zapLogger, app.NewUserService(
+				userRepository,
+				subscriptionRespository,
+				memberRepository,
+				repositories.NewUsageRepository(db),
+				repositories.NewNotificationRepository(db),
+				unitOfWork,
+			)),
+			&handlers.ProductHandler{},
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			handlers.NewMemberHandler(zapLogger, app.NewMemberService(
+				memberRepository,
+				subscriptionRespository,
+				userRepository,
+				unitOfWork,
+			)),
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		membersPath := fmt.Sprintf("/users/%s/subscriptions/%s/members", owner.ID, subscription.ID)
+		var invitation domain.SubscriptionMember
+		for _, email := range []string{"Member@email.com", "invitee@email.com"} {
+			req, _ := http.NewRequest(http.MethodPost, membersPath, strings.NewReader(fmt.Sprintf(`{"email": "%s"}`, email)))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			if invitation.ID == "" {
+				err = json.Unmarshal(rr.Body.Bytes(), &invitation)
+				assert.NoError(t, err)
+			}
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/memberships/%s/accept", member.ID, invitation.ID), nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		for _, user := range []domain.User{member, invitee} {
+			req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/erase", user.ID), nil)
+			rr = httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusNoContent, rr.Code)
+		}
+
+		req, _ = http.NewRequest(http.MethodGet, membersPath, nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, strings.ToLower(rr.Body.String()), "member@email.com")
+		assert.NotContains(t, rr.Body.String(), "invitee@email.com")
+
+		var members []domain.SubscriptionMember
+		err = json.Unmarshal(rr.Body.Bytes(), &members)
+		assert.NoError(t, err)
+		assert.Len(t, members, 2)
+		for _, m := range members {
+			assert.True(t, strings.HasPrefix(m.Email, "erased-"), m.Email)
+		}
+
+		var erased domain.User
+		db.Unscoped().First(&erased, "id = ?", member.ID)
+		assert.Empty(t, erased.Locale)
+	})
+}
+
+func TestCreateProductBundle(t *testing.T) {
+	RunTestIsolated(func() {
+		createdProducts := createProducts()
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(
+			`{"name": "Bundle", "plans": [{"interval": {"unit": "month", "count": 1}, "price": {"code": "EUR", "number": "99.00"}, "tax": {"code": "EUR", "number": "9.00"}}], "bundle": [{"id": "%s"}, {"id": "%s"}]}`,
+			createdProducts[0].ID, createdProducts[1].ID,
+		)
+		req, _ := http.NewRequest(http.MethodPost, "/products", strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var bundle domain.Product
+		err := json.Unmarshal(rr.Body.Bytes(), &bundle)
+		assert.NoError(t, err)
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/products/%s", bundle.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		err = json.Unmarshal(rr.Body.Bytes(), &bundle)
+		assert.NoError(t, err)
+		assert.Len(t, bundle.Bundle, 2)
+		assert.Len(t, bundle.ProductPlans, 1)
+
+		jsonBody = fmt.Sprintf(`{"name": "Nested", "bundle": [{"id": "%s"}]}`, bundle.ID)
+		req, _ = http.NewRequest(http.MethodPost, "/products", strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestUserEntitlements(t *testing.T) {
+	RunTestIsolated(func() {
+		owner := createUser()
+		member, _ := userRepository.Save(context.Background(), domain.User{Name: "Member", Email: "member@email.com"})
+		spaAccess := 8
+		spa, _ := productRepository.Save(context.Background(), domain.Product{
+			Name:         "Spa",
+			Entitlements: []domain.Entitlement{{Key: "class-booking", Limit: &spaAccess}, {Key: "sauna"}},
+		})
+		product, _ := productRepository.Save(context.Background(), domain.Product{
+			Name: "Gym and Spa",
+			ProductPlans: []domain.ProductPlan{
+				{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalMonth, Count: 1}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "100.00"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "10.00"}, MaxSeats: 2}},
+			},
+			Bundle: []domain.Product{spa},
+		})
+		memberRepository := repositories.NewMemberRepository(db)
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			handlers.NewEntitlementHandler(zapLogger, app.NewEntitlementService(
+				userRepository,
+				subscriptionRespository,
+				productRepository,
+				memberRepository,
+			)),
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		entitlementsPath := fmt.Sprintf("/products/%s/entitlements", product.ID)
+		for _, jsonBody := range []string{
+			`{"key": "door-access"}`,
+			`{"key": "class-booking", "limit": 4}`,
+			`{"key": "guest-pass", "limit": 2, "excludeOnTrial": true}`,
+		} {
+			req, _ := http.NewRequest(http.MethodPost, entitlementsPath, strings.NewReader(jsonBody))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusCreated, rr.Code)
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, entitlementsPath, strings.NewReader(`{"key": "sauna", "limit": -1}`))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s","seats": 2}`, product.ID, product.ProductPlans[0].ID)
+		req, _ = http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", owner.ID), strings.NewReader(jsonBody))
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+
+		now := time.Now()
+		_, err = memberRepository.Save(context.Background(), domain.SubscriptionMember{
+			SubscriptionID: subscription.ID,
+			UserID:         member.ID,
+			Email:          member.Email,
+			Status:         domain.MemberActive,
+			InviteDate:     now,
+			AcceptDate:     &now,
+		})
+		assert.NoError(t, err)
+
+		for _, u := range []domain.User{owner, member} {
+			req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/users/%s/entitlements", u.ID), nil)
+			rr = httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			var entitlements []domain.EffectiveEntitlement
+			err = json.Unmarshal(rr.Body.Bytes(), &entitlements)
+			assert.NoError(t, err)
+			assert.Len(t, entitlements, 3)
+			assert.Equal(t, "class-booking", entitlements[0].Key)
+			assert.Equal(t, spaAccess, *entitlements[0].Limit)
+			assert.Equal(t, "door-access", entitlements[1].Key)
+			assert.Nil(t, entitlements[1].Limit)
+			assert.Equal(t, "sauna", entitlements[2].Key)
+			assert.Equal(t, subscription.ID, entitlements[1].Sources[0].SubscriptionID)
+			assert.True(t, entitlements[1].Sources[0].OnTrial)
+			assert.Equal(t, u.ID == member.ID, entitlements[1].Sources[0].IsMember)
+		}
+
+		// updates are conditioned on the version, which the response only carries in its ETag
+		subscription, err = subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.NoError(t, err)
+		_, err = subscriptionRespository.Update(context.Background(), subscription, domain.ToUpdate{repositories.IsPaused: true})
+		assert.NoError(t, err)
+
+		req, _ = http.NewRequest(http.MethodGet, fmt.Sprintf("/users/%s/entitlements", member.ID), nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "[]", rr.Body.String())
+
+		req, _ = http.NewRequest(http.MethodGet, "/users/4e6b2a38-7a4d-4a36-9a8b-0c4f3c7c2d11/entitlements", nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestAuthentication(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		hmacSecret := []byte("test-secret")
+
+		router := configRouter(
+			zapLogger,
+			auth.NewAuthenticator(auth.Config{
+				APIKeys: map[string]auth.APIClient{
+					auth.HashAPIKey("test-api-key"): {Name: "billing", Roles: []auth.Role{auth.RoleSupport}},
+				},
+				HMACSecret:   hmacSecret,
+				RSAPublicKey: &rsaKey.PublicKey,
+				Issuer:       "https://auth.membership.test",
+			}),
+			handlers.NewUserHandler(zapLogger, app.NewUserService(userRepository, nil, nil, nil, nil, nil)),
+			&handlers.ProductHandler{},
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		now := time.Now()
+		validClaims := fmt.Sprintf(`{"sub": "%s", "iss": "https://auth.membership.test", "exp": %d}`, user.ID, now.Add(time.Hour).Unix())
+		expiredClaims := fmt.Sprintf(`{"sub": "%s", "iss": "https://auth.membership.test", "exp": %d}`, user.ID, now.Add(-time.Hour).Unix())
+		otherIssuerClaims := fmt.Sprintf(`{"sub": "%s", "iss": "https://other.test", "exp": %d}`, user.ID, now.Add(time.Hour).Unix())
+
+		tests := []struct {
+			name   string
+			header string
+			value  string
+			status int
+		}{
+			{"no credentials", "", "", http.StatusUnauthorized},
+			{"valid api key", "X-API-Key", "test-api-key", http.StatusOK},
+			{"unknown api key", "X-API-Key", "other-api-key", http.StatusUnauthorized},
+			{"valid HS256 token", "Authorization", "Bearer " + signHS256(validClaims, hmacSecret), http.StatusOK},
+			{"HS256 token with other secret", "Authorization", "Bearer " + signHS256(validClaims, []byte("other")), http.StatusUnauthorized},
+			{"expired HS256 token", "Authorization", "Bearer " + signHS256(expiredClaims, hmacSecret), http.StatusUnauthorized},
+			{"HS256 token from other issuer", "Authorization", "Bearer " + signHS256(otherIssuerClaims, hmacSecret), http.StatusUnauthorized},
+			{"valid RS256 token", "Authorization", "Bearer " + signRS256(validClaims, rsaKey), http.StatusOK},
+			{"unsigned token", "Authorization", "Bearer " + encodeSegment(`{"alg": "none"}`) + "." + encodeSegment(validClaims) + ".", http.StatusUnauthorized},
+			{"malformed token", "Authorization", "Bearer token", http.StatusUnauthorized},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/users/%s", user.ID), nil)
+				if tt.header != "" {
+					req.Header.Set(tt.header, tt.value)
+				}
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, tt.status, rr.Code)
+
+				if tt.status == http.StatusUnauthorized {
+					var problem handlers.Problem
+					err := json.Unmarshal(rr.Body.Bytes(), &problem)
+					assert.NoError(t, err)
+					assert.Equal(t, handlers.CodeUnauthenticated, problem.Code)
+					assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+				}
+			})
+		}
+	})
+}
+
+func TestAPIKeysConfig(t *testing.T) {
+	hash := auth.HashAPIKey("test-api-key")
+
+	tests := []struct {
+		name  string
+		value string
+		role  auth.Role
+		valid bool
+	}{
+		{"member key", "billing:" + hash + ":member", auth.RoleMember, true},
+		{"admin key", "billing:" + hash + ":admin", auth.RoleAdmin, true},
+		{"key without role", "billing:" + hash, "", false},
+		{"unknown role", "billing:" + hash + ":owner", "", false},
+		{"short hash", "billing:abc:admin", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_KEYS", tt.value)
+
+			cfg, err := auth.ConfigFromEnv()
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []auth.Role{tt.role}, cfg.APIKeys[hash].Roles)
+		})
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		other, _ := userRepository.Save(context.Background(), domain.User{Name: "Other", Email: "other@email.com"})
+		product := createProducts()[0]
+		subscriptionService := app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		otherSubscription, _, err := subscriptionService.Subscribe(
+			context.Background(), other.ID, product.ID, product.ProductPlans[0].ID, "", 0,
+		)
+		assert.NoError(t, err)
+
+		hmacSecret := []byte("test-secret")
+		router := configRouter(
+			zapLogger,
+			auth.NewAuthenticator(auth.Config{
+				APIKeys: map[string]auth.APIClient{
+					auth.HashAPIKey("support-key"): {Name: "helpdesk", Roles: []auth.Role{auth.RoleSupport}},
+					auth.HashAPIKey("admin-key"):   {Name: "backoffice", Roles: []auth.Role{auth.RoleAdmin}},
+				},
+				HMACSecret: hmacSecret,
+			}),
+			handlers.NewUserHandler(zapLogger, app.NewUserService(userRepository, nil, nil, nil, nil, nil)),
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			handlers.NewSubscriptionHandler(zapLogger, subscriptionService),
+			handlers.NewPriceMigrationHandler(zapLogger, app.NewPriceMigrationService(
+				repositories.NewPriceMigrationRepository(db),
+				subscriptionRespository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		memberToken := "Bearer " + signHS256(
+			fmt.Sprintf(`{"sub": "%s", "exp": %d}`, user.ID, time.Now().Add(time.Hour).Unix()), hmacSecret,
+		)
+		newProduct := `{"name": "New", "plans": [{"interval": {"unit": "month", "count": 1}, "price": {"code": "EUR", "number": "10.00"}, "tax": {"code": "EUR", "number": "1.00"}}]}`
+
+		tests := []struct {
+			name   string
+			header string
+			value  string
+			method string
+			path   string
+			body   string
+			status int
+		}{
+			{"member fetches itself", "Authorization", memberToken, http.MethodGet, "/users/" + user.ID, "", http.StatusOK},
+			{"member fetches other user", "Authorization", memberToken, http.MethodGet, "/users/" + other.ID, "", http.StatusForbidden},
+			{"member fetches other user subscription", "Authorization", memberToken, http.MethodGet, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, otherSubscription.ID), "", http.StatusNotFound},
+			{"member cancels other user subscription", "Authorization", memberToken, http.MethodPatch, fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, otherSubscription.ID), `{"action": "unsubscribe"}`, http.StatusNotFound},
+			{"member lists products", "Authorization", memberToken, http.MethodGet, "/products", "", http.StatusOK},
+			{"member creates product", "Authorization", memberToken, http.MethodPost, "/products", newProduct, http.StatusForbidden},
+			{"member fetches price migration", "Authorization", memberToken, http.MethodGet, "/price-migrations/4e6b2a38-7a4d-4a36-9a8b-0c4f3c7c2d11", "", http.StatusForbidden},
+			{"support fetches any user", "X-API-Key", "support-key", http.MethodGet, "/users/" + other.ID, "", http.StatusOK},
+			{"support fetches user subscription", "X-API-Key", "support-key", http.MethodGet, fmt.Sprintf("/users/%s/subscriptions/%s", other.ID, otherSubscription.ID), "", http.StatusOK},
+			{"support fetches price migration", "X-API-Key", "support-key", http.MethodGet, "/price-migrations/4e6b2a38-7a4d-4a36-9a8b-0c4f3c7c2d11", "", http.StatusNotFound},
+			{"support creates product", "X-API-Key", "support-key", http.MethodPost, "/products", newProduct, http.StatusForbidden},
+			{"support searches subscriptions", "X-API-Key", "support-key", http.MethodGet, "/admin/subscriptions", "", http.StatusForbidden},
+			{"admin creates product", "X-API-Key", "admin-key", http.MethodPost, "/products", newProduct, http.StatusCreated},
+			{"admin searches subscriptions", "X-API-Key", "admin-key", http.MethodGet, "/admin/subscriptions?status=active", "", http.StatusOK},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+				req.Header.Set(tt.header, tt.value)
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+				assert.Equal(t, tt.status, rr.Code)
+			})
+		}
+
+		canceled, _ := subscriptionRespository.Get(context.Background(), otherSubscription.ID)
+		assert.True(t, canceled.IsActive)
+	})
+}
+
+func TestUnitOfWork(t *testing.T) {
+	RunTestIsolated(func() {
+		ctx := context.Background()
+
+		var saved domain.User
+		err := unitOfWork.Do(ctx, func(ctx context.Context) error {
+			saved, _ = userRepository.Save(ctx, domain.User{Name: "Rolled Back", Email: "rollback@email.com"})
+			return domain.ErrForbidden
+		})
+		assert.ErrorIs(t, err, domain.ErrForbidden)
+		_, err = userRepository.Get(ctx, saved.ID)
+		assert.IsType(t, &domain.ErrDataNotFound{}, err)
+
+		attempts := 0
+		err = unitOfWork.Do(ctx, func(ctx context.Context) error {
+			attempts++
+			// the inner unit of work joins the outer transaction
+			return unitOfWork.Do(ctx, func(ctx context.Context) error {
+				saved, _ = userRepository.Save(ctx, domain.User{
+					Name: "Retried", Email: fmt.Sprintf("retried%d@email.com", attempts),
+				})
+				if attempts == 1 {
+					return fmt.Errorf("error when saving user: %w", errors.New("database is locked"))
+				}
+				return nil
+			})
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, attempts)
+		user, err := userRepository.Get(ctx, saved.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, "retried2@email.com", user.Email)
+		_, err = userRepository.GetByEmail(ctx, "retried1@email.com")
+		assert.IsType(t, &domain.ErrDataNotFound{}, err)
+	})
+}
+
+func TestConcurrentSubscriptionChanges(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		createdProducts := createProducts()
+		subscriptionService := app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+
+		var wg sync.WaitGroup
+		subscriptions := make([]domain.Subscription, 10)
+		created := make([]bool, 10)
+		for i := range subscriptions {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				subscriptions[i], created[i], _ = subscriptionService.Subscribe(
+					context.Background(), user.ID, createdProducts[0].ID, createdProducts[0].ProductPlans[0].ID, "", 0,
+				)
+			}(i)
+		}
+		wg.Wait()
+
+		createdCount := 0
+		for i := range subscriptions {
+			assert.Equal(t, subscriptions[0].ID, subscriptions[i].ID)
+			if created[i] {
+				createdCount++
+			}
+		}
+		assert.Equal(t, 1, createdCount)
+
+		list, _, err := subscriptionService.List(context.Background(), user.ID, domain.SubscriptionFilter{}, domain.Page{})
+		assert.Nil(t, err)
+		assert.Len(t, list, 1)
+
+		errs := make([]error, 10)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = subscriptionService.Unsubscribe(context.Background(), user.ID, subscriptions[0].ID, 0)
+			}(i)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			assert.Nil(t, err)
+		}
+		canceled, _ := subscriptionRespository.Get(context.Background(), subscriptions[0].ID)
+		assert.False(t, canceled.IsActive)
+		assert.NotNil(t, canceled.CancelDate)
+	})
+}
+
+func TestSubscriptionIfMatch(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		product := createProducts()[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			&handlers.ProductHandler{},
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, product.ProductPlans[0].ID)
+		req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("/users/%s/subscriptions", user.ID), strings.NewReader(jsonBody))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+
+		var subscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+
+		subscriptionPath := fmt.Sprintf("/users/%s/subscriptions/%s", user.ID, subscription.ID)
+		req, _ = http.NewRequest(http.MethodGet, subscriptionPath, nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		etag := rr.Header().Get("ETag")
+		assert.Equal(t, `"1"`, etag)
+
+		for _, ifMatch := range []string{`"2"`, `W/"1"`, "1"} {
+			req, _ = http.NewRequest(http.MethodPatch, subscriptionPath, strings.NewReader(`{"action": "unsubscribe"}`))
+			req.Header.Set("If-Match", ifMatch)
+			rr = httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+			var problem handlers.Problem
+			err = json.Unmarshal(rr.Body.Bytes(), &problem)
+			assert.NoError(t, err)
+			assert.Equal(t, handlers.CodePreconditionFailed, problem.Code)
+		}
+
+		req, _ = http.NewRequest(http.MethodPatch, subscriptionPath, strings.NewReader(`{"action": "unsubscribe"}`))
+		req.Header.Set("If-Match", etag)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+
+		// the change made with the first ETag made it stale
+		req, _ = http.NewRequest(http.MethodPatch, subscriptionPath, strings.NewReader(`{"action": "unsubscribe"}`))
+		req.Header.Set("If-Match", etag)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+		stale, err := subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.NoError(t, err)
+		stale.Version = 1
+		_, err = subscriptionRespository.Update(context.Background(), stale, domain.ToUpdate{repositories.IsPaused: true})
+		assert.ErrorIs(t, err, domain.ErrPreconditionFailed)
+	})
+}
+
+func TestProductIfMatch(t *testing.T) {
+	RunTestIsolated(func() {
+		product := createProducts()[0]
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			handlers.NewProductHandler(zapLogger, app.NewProductService(productRepository, unitOfWork)),
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			&handlers.WebhookHandler{},
+		)
+
+		productPath := fmt.Sprintf("/products/%s", product.ID)
+		req, _ := http.NewRequest(http.MethodGet, productPath, nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+
+		req, _ = http.NewRequest(http.MethodPatch, productPath, strings.NewReader(`{"name": "Renamed"}`))
+		req.Header.Set("If-Match", `"1"`)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+
+		req, _ = http.NewRequest(http.MethodPatch, productPath, strings.NewReader(`{"name": "Renamed again"}`))
+		req.Header.Set("If-Match", `"1"`)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+		// changes to the entitlements of a product are changes of the product
+		req, _ = http.NewRequest(http.MethodPost, productPath+"/entitlements", strings.NewReader(`{"key": "sauna"}`))
+		req.Header.Set("If-Match", `"1"`)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodPost, productPath+"/entitlements", strings.NewReader(`{"key": "sauna"}`))
+		req.Header.Set("If-Match", `"2"`)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		req, _ = http.NewRequest(http.MethodGet, productPath, nil)
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"3"`, rr.Header().Get("ETag"))
+
+		var fetched domain.Product
+		err := json.Unmarshal(rr.Body.Bytes(), &fetched)
+		assert.NoError(t, err)
+		assert.Equal(t, "Renamed", fetched.Name)
+		assert.Len(t, fetched.Entitlements, 1)
+	})
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		product := createProducts()[0]
+		idempotencyService := app.NewIdempotencyService(repositories.NewIdempotencyRepository(db))
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			&handlers.ProductHandler{},
+			handlers.NewSubscriptionHandler(zapLogger, app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			handlers.NewIdempotencyHandler(zapLogger, idempotencyService),
+			&handlers.WebhookHandler{},
+		)
+
+		subscriptionsPath := fmt.Sprintf("/users/%s/subscriptions", user.ID)
+		jsonBody := fmt.Sprintf(`{"productId": "%s","planId": "%s"}`, product.ID, product.ProductPlans[0].ID)
+		req, _ := http.NewRequest(http.MethodPost, subscriptionsPath, strings.NewReader(jsonBody))
+		req.Header.Set("Idempotency-Key", "subscribe")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		created := rr.Body.String()
+
+		var subscription domain.Subscription
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+
+		// the repeat is not handled again, the first response is replayed
+		req, _ = http.NewRequest(http.MethodPost, subscriptionsPath, strings.NewReader(jsonBody))
+		req.Header.Set("Idempotency-Key", "subscribe")
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, created, rr.Body.String())
+		assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+		assert.Equal(t, "application/json; charset=utf-8", rr.Header().Get("Content-Type"))
+
+		req, _ = http.NewRequest(http.MethodPost, subscriptionsPath, strings.NewReader(`{"productId": "other","planId": "other"}`))
+		req.Header.Set("Idempotency-Key", "subscribe")
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		var problem handlers.Problem
+		err = json.Unmarshal(rr.Body.Bytes(), &problem)
+		assert.NoError(t, err)
+		assert.Equal(t, handlers.CodeIdempotencyKeyReused, problem.Code)
+
+		// failed requests can be retried with the same key
+		for i := 0; i < 2; i++ {
+			req, _ = http.NewRequest(http.MethodPost, subscriptionsPath, strings.NewReader(`{"productId": "other","planId": "other"}`))
+			req.Header.Set("Idempotency-Key", "failing")
+			rr = httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusNotFound, rr.Code)
+			assert.Empty(t, rr.Header().Get("Idempotent-Replayed"))
+		}
+
+		subscriptionPath := fmt.Sprintf("%s/%s", subscriptionsPath, subscription.ID)
+		for _, replayed := range []string{"", "true"} {
+			req, _ = http.NewRequest(http.MethodPatch, subscriptionPath, strings.NewReader(`{"action": "unsubscribe"}`))
+			req.Header.Set("Idempotency-Key", "unsubscribe")
+			rr = httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, replayed, rr.Header().Get("Idempotent-Replayed"))
+			assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+		}
+
+		purged, err := idempotencyService.Purge(context.Background(), time.Now().Add(app.IdempotencyKeyTTL))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), purged)
+
+		// once expired, the key is free to use again
+		req, _ = http.NewRequest(http.MethodPost, subscriptionsPath, strings.NewReader(jsonBody))
+		req.Header.Set("Idempotency-Key", "subscribe")
+		rr = httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Empty(t, rr.Header().Get("Idempotent-Replayed"))
+	})
+}
+
+// failingSink refuses every event.
+type failingSink struct{}
+
+func (failingSink) Deliver(context.Context, domain.Event) error {
+	return errors.New("sink unavailable")
+}
+
+func TestSubscriptionEvents(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		product := createProducts()[0]
+		subscriptionService := app.NewSubscriptionService(
+			repositoryAllowPauseOnTrial(),
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		outboxRepository := repositories.NewOutboxRepository(db)
+		sink := events.NewMemorySink()
+		relay := app.NewEventRelay(outboxRepository, sink)
+
+		eventTypes := func() []domain.EventType {
+			types := []domain.EventType{}
+			for _, event := range sink.Events() {
+				types = append(types, event.Type)
+			}
+			return types
+		}
+
+		subscription, _, err := subscriptionService.Subscribe(
+			context.Background(), user.ID, product.ID, product.ProductPlans[0].ID, "b86b4903-2043-4f71-b154-efec19fbc55a", 1,
+		)
+		assert.NoError(t, err)
+		_, err = subscriptionService.Pause(context.Background(), user.ID, subscription.ID, 0)
+		assert.NoError(t, err)
+		_, err = subscriptionService.Resume(context.Background(), user.ID, subscription.ID, subscription.Version)
+		assert.ErrorIs(t, err, domain.ErrPreconditionFailed)
+		_, err = subscriptionService.Resume(context.Background(), user.ID, subscription.ID, 0)
+		assert.NoError(t, err)
+
+		// events wait in the outbox until a sink takes them
+		delivered, err := app.NewEventRelay(outboxRepository, failingSink{}).Relay(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, 0, delivered)
+		pending, err := outboxRepository.ListPending(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Len(t, pending, 4)
+		assert.Equal(t, 1, pending[0].Attempts)
+
+		delivered, err = relay.Relay(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 4, delivered)
+		assert.Equal(t, []domain.EventType{
+			domain.EventSubscriptionCreated,
+			domain.EventVoucherRedeemed,
+			domain.EventPaused,
+			domain.EventResumed,
+		}, eventTypes())
+		for _, event := range sink.Events() {
+			assert.NotEmpty(t, event.ID)
+			assert.Equal(t, subscription.ID, event.SubscriptionID)
+			assert.Equal(t, user.ID, event.UserID)
+			assert.Contains(t, string(event.Data), subscription.ID)
+		}
+
+		delivered, err = relay.Relay(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+
+		// the trial of the subscription is over only for the service pausing it
+		subscriptionService = app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		subscription, err = subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.NoError(t, err)
+		sink.Reset()
+
+		notified, err := subscriptionService.NotifyTrialEnding(context.Background(), subscription.TrialDate.Add(-24*time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, notified)
+		notified, err = subscriptionService.NotifyTrialEnding(context.Background(), subscription.TrialDate.Add(-time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, notified)
+
+		renewedAt := subscription.EndDate.Add(time.Hour)
+		renewed, err := subscriptionService.Renew(context.Background(), renewedAt)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, renewed)
+		renewed, err = subscriptionService.Renew(context.Background(), renewedAt)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, renewed)
+		subscription, err = subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.NoError(t, err)
+		assert.True(t, subscription.EndDate.After(renewedAt))
+
+		_, err = subscriptionService.Unsubscribe(context.Background(), user.ID, subscription.ID, 0)
+		assert.NoError(t, err)
+
+		_, err = relay.Relay(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.EventType{
+			domain.EventTrialEnding,
+			domain.EventRenewed,
+			domain.EventCanceled,
+		}, eventTypes())
+
+		purged, err := relay.Purge(context.Background(), time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), purged)
+		purged, err = relay.Purge(context.Background(), time.Now().Add(app.EventRetention+time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), purged)
+	})
+}
+
+// webhookReceiver records the requests posted to it, answering with its status.
+type webhookReceiver struct {
+	sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+	body, _ := io.ReadAll(req.Body)
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func (r *webhookReceiver) respond(status int) {
+	r.Lock()
+	defer r.Unlock()
+	r.status = status
+}
+
+func (r *webhookReceiver) received() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.requests)
+}
+
+func TestWebhooks(t *testing.T) {
+	RunTestIsolated(func() {
+		disableAfter := app.WebhookDisableAfter
+		app.WebhookDisableAfter = 3
+		defer func() { app.WebhookDisableAfter = disableAfter }()
+
+		receiver := &webhookReceiver{status: http.StatusOK}
+		server := httptest.NewServer(receiver)
+		defer server.Close()
+
+		user := createUser()
+		product := createProducts()[0]
+		subscriptionService := app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		webhookService := app.NewWebhookService(
+			repositories.NewWebhookRepository(db),
+			repositories.NewWebhookDeliveryRepository(db),
+			webhooks.NewSender(),
+		)
+		relay := app.NewEventRelay(repositories.NewOutboxRepository(db), webhookService)
+
+		router := configRouter(
+			zapLogger,
+			allowAll{},
+			&handlers.UserHandler{},
+			&handlers.ProductHandler{},
+			&handlers.SubscriptionHandler{},
+			&handlers.PriceMigrationHandler{},
+			&handlers.UsageHandler{},
+			&handlers.MemberHandler{},
+			&handlers.EntitlementHandler{},
+			&handlers.IdempotencyHandler{},
+			handlers.NewWebhookHandler(zapLogger, webhookService),
+		)
+		request := func(method, path, body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, strings.NewReader(body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		rr := request(http.MethodPost, "/webhooks", `{"url": "ftp://partner.com"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr = request(http.MethodPost, "/webhooks", fmt.Sprintf(`{"url": "%s", "eventTypes": ["Expired"]}`, server.URL))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = request(
+			http.MethodPost, "/webhooks",
+			fmt.Sprintf(`{"url": "%s", "eventTypes": ["SubscriptionCreated", "Canceled"]}`, server.URL),
+		)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var created struct {
+			ID     string `json:"id"`
+			Secret string `json:"secret"`
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &created)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(created.Secret, "whsec_"))
+
+		webhookPath := "/webhooks/" + created.ID
+		rr = request(http.MethodGet, webhookPath, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), created.Secret)
+
+		rr = request(http.MethodGet, "/webhooks", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), created.ID)
+
+		subscription, _, err := subscriptionService.Subscribe(
+			context.Background(), user.ID, product.ID, product.ProductPlans[0].ID, "", 1,
+		)
+		assert.NoError(t, err)
+		_, err = relay.Relay(context.Background())
+		assert.NoError(t, err)
+
+		now := time.Now()
+		sent, err := webhookService.Dispatch(context.Background(), now)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, 1, receiver.received())
+
+		// the receiver checks the signature of the timestamp and body
+		posted := receiver.requests[0]
+		timestamp, err := strconv.ParseInt(posted.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+		assert.NoError(t, err)
+		assert.Equal(t, webhooks.Sign(created.Secret, timestamp, receiver.bodies[0]), posted.Header.Get(webhooks.HeaderSignature))
+		assert.NotEmpty(t, posted.Header.Get(webhooks.HeaderID))
+		var event domain.Event
+		err = json.Unmarshal(receiver.bodies[0], &event)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.EventSubscriptionCreated, event.Type)
+		assert.Equal(t, subscription.ID, event.SubscriptionID)
+
+		// events are queued once for each endpoint, even when relayed again
+		err = webhookService.Deliver(context.Background(), event)
+		assert.NoError(t, err)
+		sent, err = webhookService.Dispatch(context.Background(), now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, sent)
+
+		// pausing is not sent, canceling fails and is retried with a backoff
+		receiver.respond(http.StatusInternalServerError)
+		_, err = subscriptionService.Unsubscribe(context.Background(), user.ID, subscription.ID, 0)
+		assert.NoError(t, err)
+		_, err = relay.Relay(context.Background())
+		assert.NoError(t, err)
+
+		now = time.Now()
+		sent, err = webhookService.Dispatch(context.Background(), now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, sent)
+		assert.Equal(t, 2, receiver.received())
+		_, err = webhookService.Dispatch(context.Background(), now.Add(app.WebhookRetryBackoff/2))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, receiver.received())
+
+		rr = request(http.MethodGet, webhookPath+"/deliveries?sort=-createdAt", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var deliveries []domain.WebhookDelivery
+		err = json.Unmarshal(rr.Body.Bytes(), &deliveries)
+		assert.NoError(t, err)
+		assert.Len(t, deliveries, 2)
+		assert.Equal(t, domain.EventCanceled, deliveries[0].EventType)
+		assert.Equal(t, domain.DeliveryPending, deliveries[0].Status)
+		assert.Equal(t, 1, deliveries[0].Attempts)
+		assert.Equal(t, http.StatusInternalServerError, deliveries[0].ResponseStatus)
+		assert.NotNil(t, deliveries[0].NextAttemptAt)
+		assert.Equal(t, domain.DeliverySucceeded, deliveries[1].Status)
+
+		// the endpoint is disabled after failing WebhookDisableAfter attempts in a row
+		_, err = webhookService.Dispatch(context.Background(), now.Add(app.WebhookRetryBackoff))
+		assert.NoError(t, err)
+		_, err = webhookService.Dispatch(context.Background(), now.Add(3*app.WebhookRetryBackoff))
+		assert.NoError(t, err)
+		assert.Equal(t, 4, receiver.received())
+
+		rr = request(http.MethodGet, webhookPath, "")
+		var endpoint domain.WebhookEndpoint
+		err = json.Unmarshal(rr.Body.Bytes(), &endpoint)
+		assert.NoError(t, err)
+		assert.False(t, endpoint.IsEnabled)
+		assert.NotNil(t, endpoint.DisableDate)
+
+		_, err = webhookService.Dispatch(context.Background(), now.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 4, receiver.received())
+
+		receiver.respond(http.StatusNoContent)
+		rr = request(http.MethodPatch, webhookPath, `{"enabled": true}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		err = json.Unmarshal(rr.Body.Bytes(), &endpoint)
+		assert.NoError(t, err)
+		assert.True(t, endpoint.IsEnabled)
+		assert.Equal(t, 0, endpoint.Failures)
+
+		sent, err = webhookService.Dispatch(context.Background(), now.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, sent)
+
+		// replaying a delivery sends its event again
+		rr = request(http.MethodPost, fmt.Sprintf("%s/deliveries/%s/replay", webhookPath, deliveries[1].ID), "")
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		var replay domain.WebhookDelivery
+		err = json.Unmarshal(rr.Body.Bytes(), &replay)
+		assert.NoError(t, err)
+		assert.True(t, replay.IsReplay)
+		assert.Equal(t, deliveries[1].EventID, replay.EventID)
+
+		sent, err = webhookService.Dispatch(context.Background(), time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, 6, receiver.received())
+		assert.Equal(t, receiver.bodies[0], receiver.bodies[5])
+
+		rr = request(http.MethodPost, fmt.Sprintf("%s/deliveries/%s/replay", webhookPath, created.ID), "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = request(http.MethodDelete, webhookPath, "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		rr = request(http.MethodGet, webhookPath, "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+// recordingNotifier keeps the messages it is given, failing with err when set.
+type recordingNotifier struct {
+	sync.Mutex
+	err      error
+	messages []domain.Message
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, message domain.Message) error {
+	n.Lock()
+	defer n.Unlock()
+	if n.err != nil {
+		return n.err
+	}
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func (n *recordingNotifier) fail(err error) {
+	n.Lock()
+	defer n.Unlock()
+	n.err = err
+}
+
+func (n *recordingNotifier) subjects() []string {
+	n.Lock()
+	defer n.Unlock()
+	subjects := []string{}
+	for _, message := range n.messages {
+		subjects = append(subjects, message.Subject)
+	}
+	return subjects
+}
+
+func TestNotifications(t *testing.T) {
+	RunTestIsolated(func() {
+		userService := app.NewUserService(userRepository, nil, nil, nil, nil, nil)
+		_, err := userService.Create(context.Background(), domain.User{Name: "Tester", Email: "t@email.com", Locale: "pt_BR"})
+		assert.Error(t, err)
+		user, err := userService.Create(context.Background(), domain.User{Name: "Tester", Email: "t@email.com", Locale: "pt-BR"})
+		assert.NoError(t, err)
+		assert.Equal(t, "pt-BR", user.Locale)
+
+		product := createProducts()[0]
+		templates, err := notifications.NewTemplates()
+		assert.NoError(t, err)
+		notifier := &recordingNotifier{}
+		notificationService := app.NewNotificationService(
+			repositories.NewNotificationRepository(db), userRepository, subscriptionRespository, templates, notifier,
+		)
+		relay := app.NewEventRelay(repositories.NewOutboxRepository(db), notificationService)
+		subscriptionService := app.NewSubscriptionService(
+			repositoryAllowPauseOnTrial(),
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+
+		subscription, _, err := subscriptionService.Subscribe(
+			context.Background(), user.ID, product.ID, product.ProductPlans[0].ID, "", 1,
+		)
+		assert.NoError(t, err)
+		// the service pauses on trial by faking the trial date of the subscriptions it gets
+		stored, err := subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.NoError(t, err)
+		_, err = subscriptionService.Pause(context.Background(), user.ID, subscription.ID, 0)
+		assert.NoError(t, err)
+		_, err = subscriptionService.Resume(context.Background(), user.ID, subscription.ID, 0)
+		assert.NoError(t, err)
+
+		// users are only told about some events, once each
+		_, err = relay.Relay(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, notificationService.Deliver(context.Background(), domain.Event{
+			ID: "not-found", Type: domain.EventResumed, UserID: "not-found",
+		}))
+
+		notifier.fail(errors.New("smtp unavailable"))
+		now := time.Now()
+		sent, err := notificationService.Dispatch(context.Background(), now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, sent)
+		sent, err = notificationService.Dispatch(context.Background(), now)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, sent)
+
+		notifier.fail(nil)
+		sent, err = notificationService.Dispatch(context.Background(), now.Add(app.NotificationRetryBackoff))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, sent)
+		assert.Equal(t, []string{
+			"Boas-vindas ao Test1",
+			"Sua assinatura do Test1 está ativa novamente",
+		}, notifier.subjects())
+		assert.Contains(t, notifier.messages[0].Text, "Olá Tester")
+		assert.Contains(t, notifier.messages[0].Text, stored.TrialDate.Format("02/01/2006"))
+		assert.Contains(t, notifier.messages[0].HTML, "<strong>Test1</strong>")
+		assert.Equal(t, "t@email.com", notifier.messages[0].To)
+
+		// users without templates for their locale get the default one
+		user, err = userService.Update(context.Background(), user.ID, domain.User{Locale: "fr"})
+		assert.NoError(t, err)
+		assert.Equal(t, "fr", user.Locale)
+
+		subscriptionService = app.NewSubscriptionService(
+			subscriptionRespository,
+			userRepository,
+			productRepository,
+			voucherStorage,
+			&app.DiscountService{},
+			unitOfWork,
+		)
+		subscription, err = subscriptionRespository.Get(context.Background(), subscription.ID)
+		assert.NoError(t, err)
+		notified, err := subscriptionService.NotifyTrialEnding(context.Background(), subscription.TrialDate.Add(-24*time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, notified)
+		_, err = relay.Relay(context.Background())
+		assert.NoError(t, err)
+		sent, err = notificationService.Dispatch(context.Background(), time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, "Your trial of Test1 ends soon", notifier.subjects()[2])
+
+		// emails are written as files without an SMTP server
+		dir := t.TempDir()
+		fileNotifier, err := notifications.NewFileNotifier(dir, "Membership <no-reply@membership.local>")
+		assert.NoError(t, err)
+		assert.NoError(t, fileNotifier.Notify(context.Background(), notifier.messages[1]))
+		files, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, files, 1)
+		email, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+		assert.NoError(t, err)
+		assert.Contains(t, string(email), "To: t@email.com\r\n")
+		assert.Contains(t, string(email), "Subject: =?utf-8?q?Sua_assinatura_do_Test1_est=C3=A1_ativa_novamente?=")
+		assert.Contains(t, string(email), "Content-Type: text/html; charset=utf-8")
+
+		// notifications are purged once sent, and the pending ones of an erased user are never sent
+		purged, err := notificationService.Purge(context.Background(), time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), purged)
+		purged, err = notificationService.Purge(context.Background(), time.Now().Add(app.NotificationRetention+time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), purged)
+
+		data, _ := json.Marshal(subscription)
+		assert.NoError(t, notificationService.Deliver(context.Background(), domain.Event{
+			ID: uuid.NewString(), Type: domain.EventResumed, UserID: user.ID, SubscriptionID: subscription.ID, Data: data,
+		}))
+		userService = app.NewUserService(
+			userRepository,
+			subscriptionRespository,
+			repositories.NewMemberRepository(db),
+			repositories.NewUsageRepository(db),
+			repositories.NewNotificationRepository(db),
+			unitOfWork,
+		)
+		assert.NoError(t, userService.Erase(context.Background(), user.ID))
+		sent, err = notificationService.Dispatch(context.Background(), time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, sent)
+		assert.Len(t, notifier.messages, 3)
+	})
+}
+
+func TestGRPCAPI(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+		other, _ := userRepository.Save(context.Background(), domain.User{Name: "Other", Email: "other@email.com"})
+		product := createProducts()[0]
+
+		hmacSecret := []byte("test-secret")
+		server := configGRPCServer(
+			zapLogger,
+			auth.NewAuthenticator(auth.Config{
+				APIKeys: map[string]auth.APIClient{
+					auth.HashAPIKey("support-key"): {Name: "helpdesk", Roles: []auth.Role{auth.RoleSupport}},
+					auth.HashAPIKey("admin-key"):   {Name: "backoffice", Roles: []auth.Role{auth.RoleAdmin}},
+				},
+				HMACSecret: hmacSecret,
+			}),
+			grpcapi.NewUserServer(app.NewUserService(
+				userRepository,
+				subscriptionRespository,
+				repositories.NewMemberRepository(db),
+				repositories.NewUsageRepository(db),
+				repositories.NewNotificationRepository(db),
+				unitOfWork,
+			)),
+			grpcapi.NewProductServer(app.NewProductService(productRepository, unitOfWork)),
+			grpcapi.NewSubscriptionServer(app.NewSubscriptionService(
+				subscriptionRespository,
+				userRepository,
+				productRepository,
+				voucherStorage,
+				&app.DiscountService{},
+				unitOfWork,
+			)),
+		)
+
+		listener := bufconn.Listen(1024 * 1024)
+		go server.Serve(listener)
+		defer server.Stop()
+
+		conn, err := grpc.DialContext(
+			context.Background(),
+			"bufnet",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		users := membershipv1.NewUserServiceClient(conn)
+		products := membershipv1.NewProductServiceClient(conn)
+		subscriptions := membershipv1.NewSubscriptionServiceClient(conn)
+
+		admin := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "admin-key")
+		support := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "support-key")
+		member := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+signHS256(
+			fmt.Sprintf(`{"sub": "%s", "exp": %d}`, user.ID, time.Now().Add(time.Hour).Unix()), hmacSecret,
+		))
+
+		t.Run("authentication and authorization", func(t *testing.T) {
+			_, err := users.GetUser(context.Background(), &membershipv1.GetUserRequest{UserId: user.ID})
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+			fetched, err := users.GetUser(member, &membershipv1.GetUserRequest{UserId: user.ID})
+			assert.NoError(t, err)
+			assert.Equal(t, user.Email, fetched.GetEmail())
+
+			_, err = users.GetUser(member, &membershipv1.GetUserRequest{UserId: other.ID})
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+			_, err = users.GetUser(support, &membershipv1.GetUserRequest{UserId: other.ID})
+			assert.NoError(t, err)
+
+			_, err = products.UpdateProduct(support, &membershipv1.UpdateProductRequest{ProductId: product.ID, Name: "Renamed"})
+			assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		})
+
+		t.Run("users", func(t *testing.T) {
+			created, err := users.CreateUser(support, &membershipv1.CreateUserRequest{
+				Name: "New", Email: "new@email.com", Locale: "pt-BR",
+			})
+			assert.NoError(t, err)
+			assert.NotEmpty(t, created.GetId())
+			assert.Equal(t, "pt-BR", created.GetLocale())
+
+			_, err = users.CreateUser(support, &membershipv1.CreateUserRequest{Name: "Again", Email: "new@email.com"})
+			assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+			_, err = users.CreateUser(support, &membershipv1.CreateUserRequest{Name: "Invalid", Email: "email"})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+			updated, err := users.UpdateUser(support, &membershipv1.UpdateUserRequest{UserId: created.GetId(), Name: "Renamed"})
+			assert.NoError(t, err)
+			assert.Equal(t, "Renamed", updated.GetName())
+			assert.Equal(t, "new@email.com", updated.GetEmail())
+
+			_, err = users.DeleteUser(support, &membershipv1.DeleteUserRequest{UserId: created.GetId()})
+			assert.NoError(t, err)
+
+			_, err = users.GetUser(support, &membershipv1.GetUserRequest{UserId: created.GetId()})
+			assert.Equal(t, codes.NotFound, status.Code(err))
+		})
+
+		t.Run("products", func(t *testing.T) {
+			created, err := products.CreateProduct(admin, &membershipv1.CreateProductRequest{
+				Name: "New",
+				Plans: []*membershipv1.Plan{{
+					Interval: &membershipv1.Interval{Unit: "year", Count: 1},
+					Price:    &membershipv1.Money{Currency: "EUR", Amount: "100.00"},
+					Tax:      &membershipv1.Money{Currency: "EUR", Amount: "10.00"},
+				}},
+			})
+			assert.NoError(t, err)
+			assert.Len(t, created.GetPlans(), 1)
+			assert.Equal(t, "100.00", created.GetPlans()[0].GetPrice().GetAmount())
+
+			_, err = products.CreateProduct(admin, &membershipv1.CreateProductRequest{
+				Name:  "Invalid",
+				Plans: []*membershipv1.Plan{{Interval: &membershipv1.Interval{Unit: "decade", Count: 1}}},
+			})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+			list, err := products.ListProducts(member, &membershipv1.ListProductsRequest{
+				Page:     &membershipv1.Page{PageSize: 1, Sort: "name"},
+				Interval: &membershipv1.Interval{Unit: "month"},
+			})
+			assert.NoError(t, err)
+			assert.Len(t, list.GetProducts(), 1)
+			assert.Equal(t, "Test1", list.GetProducts()[0].GetName())
+			assert.NotEmpty(t, list.GetNextPageToken())
+
+			_, err = products.UpdateProduct(admin, &membershipv1.UpdateProductRequest{
+				ProductId: created.GetId(), Name: "Renamed", Version: created.GetVersion() + 1,
+			})
+			assert.Equal(t, codes.Aborted, status.Code(err))
+
+			updated, err := products.UpdateProduct(admin, &membershipv1.UpdateProductRequest{
+				ProductId: created.GetId(), Name: "Renamed", Version: created.GetVersion(),
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, "Renamed", updated.GetName())
+
+			_, err = products.GetProduct(member, &membershipv1.GetProductRequest{ProductId: "4e6b2a38-7a4d-4a36-9a8b-0c4f3c7c2d11"})
+			assert.Equal(t, codes.NotFound, status.Code(err))
+		})
+
+		t.Run("subscriptions", func(t *testing.T) {
+			_, err := subscriptions.CreateSubscription(member, &membershipv1.CreateSubscriptionRequest{
+				UserId: user.ID, ProductId: product.ID, PlanId: product.ProductPlans[0].ID, Seats: 2,
+			})
+			assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+			created, err := subscriptions.CreateSubscription(member, &membershipv1.CreateSubscriptionRequest{
+				UserId: user.ID, ProductId: product.ID, PlanId: product.ProductPlans[0].ID,
+			})
+			assert.NoError(t, err)
+			assert.True(t, created.GetCreated())
+			subscription := created.GetSubscription()
+			assert.Equal(t, product.ID, subscription.GetProduct().GetId())
+			assert.Equal(t, "100.00", subscription.GetPlan().GetPrice().GetAmount())
+			assert.NotNil(t, subscription.GetTrialDate())
+			assert.True(t, subscription.GetActive())
+
+			fetched, err := subscriptions.GetSubscription(member, &membershipv1.GetSubscriptionRequest{
+				UserId: user.ID, SubscriptionId: subscription.GetId(),
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, subscription.GetVersion(), fetched.GetVersion())
+
+			_, err = subscriptions.GetSubscription(support, &membershipv1.GetSubscriptionRequest{
+				UserId: other.ID, SubscriptionId: subscription.GetId(),
+			})
+			assert.Equal(t, codes.NotFound, status.Code(err))
+
+			// subscriptions can't be paused during the trial
+			_, err = subscriptions.PauseSubscription(member, &membershipv1.SubscriptionActionRequest{
+				UserId: user.ID, SubscriptionId: subscription.GetId(),
+			})
+			assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+			_, err = subscriptions.CancelSubscription(member, &membershipv1.SubscriptionActionRequest{
+				UserId: user.ID, SubscriptionId: subscription.GetId(), Version: subscription.GetVersion() + 1,
+			})
+			assert.Equal(t, codes.Aborted, status.Code(err))
+
+			canceled, err := subscriptions.CancelSubscription(member, &membershipv1.SubscriptionActionRequest{
+				UserId: user.ID, SubscriptionId: subscription.GetId(), Version: subscription.GetVersion(),
+			})
+			assert.NoError(t, err)
+			assert.False(t, canceled.GetActive())
+			assert.NotNil(t, canceled.GetCancelDate())
+
+			list, err := subscriptions.ListSubscriptions(member, &membershipv1.ListSubscriptionsRequest{
+				UserId: user.ID, Status: string(domain.SubscriptionCanceled),
+			})
+			assert.NoError(t, err)
+			assert.Len(t, list.GetSubscriptions(), 1)
+
+			_, err = subscriptions.ListSubscriptions(member, &membershipv1.ListSubscriptionsRequest{
+				UserId: user.ID, Status: "expired",
+			})
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	})
+}
+
+func TestRequestDeadline(t *testing.T) {
+	RunTestIsolated(func() {
+		user := createUser()
+
+		var deadline time.Time
+		router := gin.New()
+		router.Use(handlers.Timeout(writeTimeout))
+		router.GET("/", func(c *gin.Context) {
+			deadline, _ = c.Request.Context().Deadline()
+		})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.WithinDuration(t, time.Now().Add(writeTimeout), deadline, time.Second)
+
+		expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+
+		_, err := userRepository.Get(expired, user.ID)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		_, err = app.NewUserService(userRepository, nil, nil, nil, nil, nil).Fetch(expired, user.ID)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	migrationDB, err := database.Open(database.Config{Driver: database.DriverSQLite}, &gorm.Config{})
+	assert.Nil(t, err)
+
+	states, err := migrations.Status(migrationDB)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, states)
+	for _, state := range states {
+		assert.Nil(t, state.AppliedAt)
+	}
+	assert.ErrorIs(t, migrations.Check(migrationDB), migrations.ErrPending)
+	assert.False(t, migrationDB.Migrator().HasTable("migrations"), "checking the schema must not change it")
+
+	applied, err := migrations.Up(migrationDB)
+	assert.Nil(t, err)
+	assert.Equal(t, len(states), len(applied))
+	assert.Nil(t, migrations.Check(migrationDB))
+	assert.True(t, migrationDB.Migrator().HasTable(&domain.Subscription{}))
+
+	applied, err = migrations.Up(migrationDB)
+	assert.Nil(t, err)
+	assert.Empty(t, applied)
+
+	// rolling back to the first migration and applying the others again keeps every index
+	indexes := func() []string {
+		var names []string
+		migrationDB.Raw("SELECT name FROM sqlite_master WHERE type = 'index' ORDER BY name").Scan(&names)
+		return names
+	}
+	migrated := indexes()
+	assert.NotEmpty(t, migrated)
+	for range states[1:] {
+		_, err := migrations.Down(migrationDB)
+		assert.Nil(t, err)
+	}
+	applied, err = migrations.Up(migrationDB)
+	assert.Nil(t, err)
+	assert.Equal(t, len(states)-1, len(applied))
+	assert.Equal(t, migrated, indexes())
+
+	for range states {
+		_, err := migrations.Down(migrationDB)
+		assert.Nil(t, err)
+	}
+	_, err = migrations.Down(migrationDB)
+	assert.NotNil(t, err)
+	assert.False(t, migrationDB.Migrator().HasTable(&domain.User{}))
+	assert.ErrorIs(t, migrations.Check(migrationDB), migrations.ErrPending)
+}
+
+func encodeSegment(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func signHS256(claims string, secret []byte) string {
+	signed := encodeSegment(`{"alg": "HS256", "typ": "JWT"}`) + "." + encodeSegment(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(claims string, key *rsa.PrivateKey) string {
+	signed := encodeSegment(`{"alg": "RS256", "typ": "JWT"}`) + "." + encodeSegment(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func createUser() domain.User {
+	u, _ := userRepository.Save(context.Background(), domain.User{
+		Name:  "Tester",
+		Email: "tester@email.com",
+	})
+	return u
+}
+
+func createProducts() []domain.Product {
+	p, _ := productRepository.Save(context.Background(), domain.Product{
+		Name: "Test1",
+		ProductPlans: []domain.ProductPlan{
+			{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalMonth, Count: 1}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "100.00"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "10.00"}}},
+			{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalMonth, Count: 2}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "50.00"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "5.50"}}},
+		},
+	})
+
+	p2, _ := productRepository.Save(context.Background(), domain.Product{
+		Name: "Test2",
+		ProductPlans: []domain.ProductPlan{
+			{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalMonth, Count: 1}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "12.99"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "5.99"}}},
+			{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalMonth, Count: 2}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "21.99"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "4.99"}}},
+			{Plan: &domain.Plan{Interval: domain.Interval{Unit: domain.IntervalMonth, Count: 3}, Price: domain.Money{Code: domain.CurrencyEUR, Number: "20.99"}, Tax: domain.Money{Code: domain.CurrencyEUR, Number: "3.99"}}},
+		},
+	})
+
+	return append([]domain.Product{}, p, p2)
+}
+
+// truncateTables empties the tables referencing others first, as PostgreSQL enforces foreign keys.
+func truncateTables() {
+	db.Exec("DELETE FROM idempotency_keys;")
+	db.Exec("DELETE FROM events;")
+	db.Exec("DELETE FROM notifications;")
+	db.Exec("DELETE FROM webhook_deliveries;")
+	db.Exec("DELETE FROM webhook_endpoints;")
+	db.Exec("DELETE FROM entitlements;")
+	db.Exec("DELETE FROM add_ons;")
+	db.Exec("DELETE FROM usage_records;")
+	db.Exec("DELETE FROM subscription_members;")
+	db.Exec("DELETE FROM subscription_plans;")
+	db.Exec("DELETE FROM subscriptions;")
+	db.Exec("DELETE FROM price_migrations;")
+	db.Exec("DELETE FROM product_bundles;")
+	db.Exec("DELETE FROM product_plans;")
+	db.Exec("DELETE FROM products;")
+	db.Exec("DELETE FROM users;")
+}
+
+func repositoryAllowPauseOnTrial() domain.SubscriptionRepository {
+	return &mocks.MockSubscriptionRepository{
+		SaveFunc: func(ctx context.Context, u domain.User, events []domain.Event) (domain.Subscription, error) {
+			return subscriptionRespository.Save(ctx, u, events...)
+		},
+		GetFunc: func(ctx context.Context, subscriptionID string) (domain.Subscription, error) {
+			s, _ := subscriptionRespository.Get(ctx, subscriptionID)
+			// set TrialDate has it had already passed
+			s.TrialDate = s.StartDate.Add(-time.Hour)
+			return s, nil
+		},
+		GetForUpdateFunc: func(ctx context.Context, subscriptionID string) (domain.Subscription, error) {
+			s, _ := subscriptionRespository.GetForUpdate(ctx, subscriptionID)
+			s.TrialDate = s.StartDate.Add(-time.Hour)
 			return s, nil
 		},
-		UpdateFunc: func(s domain.Subscription, tu domain.ToUpdate) (domain.Subscription, error) {
-			return subscriptionRespository.Update(s, tu)
+		UpdateFunc: func(
+			ctx context.Context,
+			s domain.Subscription,
+			tu domain.ToUpdate,
+			events []domain.Event,
+		) (domain.Subscription, error) {
+			return subscriptionRespository.Update(ctx, s, tu, events...)
 		},
 	}
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/internal/migrations"
+)
+
+const migrateUsage = `usage: main migrate <command>
+
+commands:
+  up      apply every pending migration
+  down    roll back the last applied migration
+  status  list the migrations and when they were applied`
+
+// migrate runs the migrate subcommand against the configured database, returning the exit code.
+func migrate(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	db, _, err := openDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not open database: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(db)
+		for _, m := range applied {
+			fmt.Printf("applied %s\n", m)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migration")
+		}
+	case "down":
+		m, err := migrations.Down(db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("rolled back %s\n", m)
+	case "status":
+		states, err := migrations.Status(db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MIGRATION\tAPPLIED AT")
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.AppliedAt != nil {
+				appliedAt = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", state, appliedAt)
+		}
+		w.Flush()
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
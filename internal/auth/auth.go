@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	bearerPrefix = "Bearer "
+)
+
+type PrincipalKind string
+
+const (
+	PrincipalClient PrincipalKind = "client" // server-to-server client using an API key
+	PrincipalUser   PrincipalKind = "user"   // holder of a JWT bearer token
+)
+
+type Role string
+
+const (
+	RoleMember  Role = "member"  // may only access its own user
+	RoleSupport Role = "support" // may access every user
+	RoleAdmin   Role = "admin"   // may also manage the product catalogue and price migrations
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string
+	Kind    PrincipalKind
+	Roles   []Role
+}
+
+// HasRole reports whether the principal has any of the roles. Admins have every role.
+func (p Principal) HasRole(roles ...Role) bool {
+	for _, has := range p.Roles {
+		if has == RoleAdmin {
+			return true
+		}
+		for _, role := range roles {
+			if has == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CanAccessUser reports whether the principal may access the data of the user: its own user,
+// or any user for support agents.
+func (p Principal) CanAccessUser(userID string) bool {
+	if p.HasRole(RoleSupport) {
+		return true
+	}
+	return p.Kind == PrincipalUser && p.Subject == userID
+}
+
+// APIClient is the owner of an API key.
+type APIClient struct {
+	Name  string
+	Roles []Role
+}
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Config holds the locally configured credentials. API keys are stored as the hex encoded
+// SHA-256 of the key, mapped to the client owning it.
+type Config struct {
+	APIKeys      map[string]APIClient
+	HMACSecret   []byte
+	RSAPublicKey *rsa.PublicKey
+	Issuer       string
+	Audience     string
+}
+
+// CredentialsAuthenticator authenticates requests with an API key in the X-API-Key header or
+// a JWT in the Authorization header.
+type CredentialsAuthenticator struct {
+	cfg Config
+	now func() time.Time
+}
+
+func NewAuthenticator(cfg Config) *CredentialsAuthenticator {
+	return &CredentialsAuthenticator{
+		cfg: cfg,
+		now: time.Now,
+	}
+}
+
+func (a *CredentialsAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return a.authenticateAPIKey(key)
+	}
+
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, bearerPrefix) {
+		return a.authenticateToken(strings.TrimPrefix(header, bearerPrefix))
+	}
+
+	return Principal{}, domain.ErrUnauthenticated
+}
+
+func (a *CredentialsAuthenticator) authenticateAPIKey(key string) (Principal, error) {
+	client, ok := a.cfg.APIKeys[HashAPIKey(key)]
+	if !ok {
+		return Principal{}, domain.ErrUnauthenticated
+	}
+
+	return Principal{Subject: client.Name, Kind: PrincipalClient, Roles: client.Roles}, nil
+}
+
+func (a *CredentialsAuthenticator) authenticateToken(token string) (Principal, error) {
+	claims, err := verifyToken(token, a.cfg, a.now())
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", domain.ErrUnauthenticated, err)
+	}
+
+	roles := []Role{}
+	for _, role := range claims.Roles {
+		switch r := Role(role); r {
+		case RoleMember, RoleSupport, RoleAdmin:
+			roles = append(roles, r)
+		}
+	}
+	if len(roles) == 0 {
+		roles = append(roles, RoleMember)
+	}
+
+	return Principal{Subject: claims.Subject, Kind: PrincipalUser, Roles: roles}, nil
+}
+
+// HashAPIKey returns the form in which API keys are configured.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ConfigFromEnv reads the credentials accepted by the API:
+//   - API_KEYS: comma separated <client>:<sha256 hex of the key>:<role> entries, the role being
+//     required so that no key is granted access to every user by mistake
+//   - JWT_HS256_SECRET: shared secret of HS256 tokens
+//   - JWT_RS256_PUBLIC_KEY_FILE: path of the PEM encoded public key of RS256 tokens
+//   - JWT_ISSUER and JWT_AUDIENCE: expected iss and aud claims, checked when set
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		APIKeys:    map[string]APIClient{},
+		HMACSecret: []byte(os.Getenv("JWT_HS256_SECRET")),
+		Issuer:     os.Getenv("JWT_ISSUER"),
+		Audience:   os.Getenv("JWT_AUDIENCE"),
+	}
+
+	if value := os.Getenv("API_KEYS"); value != "" {
+		for _, entry := range strings.Split(value, ",") {
+			fields := strings.Split(strings.TrimSpace(entry), ":")
+			if len(fields) != 3 || fields[0] == "" || len(fields[1]) != 64 {
+				return Config{}, fmt.Errorf("invalid API_KEYS entry %q, expected <client>:<sha256>:<role>", entry)
+			}
+
+			role := Role(fields[2])
+			if role != RoleMember && role != RoleSupport && role != RoleAdmin {
+				return Config{}, fmt.Errorf("invalid role in API_KEYS entry %q", entry)
+			}
+
+			cfg.APIKeys[strings.ToLower(fields[1])] = APIClient{Name: fields[0], Roles: []Role{role}}
+		}
+	}
+
+	if path := os.Getenv("JWT_RS256_PUBLIC_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("could not read RS256 public key: %w", err)
+		}
+		key, err := ParseRSAPublicKey(data)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.RSAPublicKey = key
+	}
+
+	return cfg, nil
+}
+
+// ParseRSAPublicKey parses a PEM encoded PKIX or PKCS #1 RSA public key.
+func ParseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("RS256 public key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse RS256 public key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("RS256 public key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type principalContextKey struct{}
+
+// userRequest is implemented by the gRPC requests about the data of a user.
+type userRequest interface {
+	GetUserId() string
+}
+
+// UnaryInterceptor is the Middleware of the gRPC server, reading the credentials from the metadata
+// of the call, e.g. x-api-key. Methods of methodRoles are rejected for principals without any of
+// their roles, and requests with a user id for principals that can't access the user.
+func UnaryInterceptor(a Authenticator, methodRoles map[string][]Role) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		header := http.Header{}
+		for _, key := range []string{apiKeyHeader, "Authorization"} {
+			for _, value := range md.Get(key) {
+				header.Add(key, value)
+			}
+		}
+
+		principal, err := a.Authenticate((&http.Request{Header: header}).WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		if roles, ok := methodRoles[info.FullMethod]; ok && !principal.HasRole(roles...) {
+			return nil, domain.ErrPermissionDenied
+		}
+		if r, ok := req.(userRequest); ok && !principal.CanAccessUser(r.GetUserId()) {
+			return nil, domain.ErrPermissionDenied
+		}
+
+		return handler(context.WithValue(ctx, principalContextKey{}, principal), req)
+	}
+}
+
+// PrincipalFromContext returns the principal authenticated for the gRPC call.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// leeway tolerates clock skew between the token issuer and this service.
+const leeway = 30 * time.Second
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+}
+
+type claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Roles     []string `json:"roles"`
+}
+
+// audience is either a single string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyToken checks the signature of a compact JWT with the configured HS256 secret or RS256
+// public key, then its time, issuer and audience claims.
+func verifyToken(token string, cfg Config, now time.Time) (claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims{}, errors.New("malformed token")
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims{}, fmt.Errorf("invalid token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims{}, fmt.Errorf("invalid token signature: %w", err)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if err := verifySignature(header.Alg, signed, signature, cfg); err != nil {
+		return claims{}, err
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return claims{}, fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	if c.Subject == "" {
+		return claims{}, errors.New("token has no subject")
+	}
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)) {
+		return claims{}, errors.New("token is expired")
+	}
+	if c.NotBefore != 0 && now.Add(leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return claims{}, errors.New("token is not valid yet")
+	}
+	if cfg.Issuer != "" && c.Issuer != cfg.Issuer {
+		return claims{}, errors.New("token has an unexpected issuer")
+	}
+	if cfg.Audience != "" && !c.Audience.contains(cfg.Audience) {
+		return claims{}, errors.New("token has an unexpected audience")
+	}
+
+	return c, nil
+}
+
+func verifySignature(alg string, signed, signature []byte, cfg Config) error {
+	switch {
+	case alg == "HS256" && len(cfg.HMACSecret) > 0:
+		mac := hmac.New(sha256.New, cfg.HMACSecret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("invalid HS256 signature")
+		}
+		return nil
+	case alg == "RS256" && cfg.RSAPublicKey != nil:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(cfg.RSAPublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("invalid RS256 signature: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("token algorithm %q is not accepted", alg)
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
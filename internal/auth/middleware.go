@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const principalKey = "principal"
+
+// Middleware rejects requests that can't be authenticated and stores the principal of the others
+// on the context.
+func Middleware(a Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := a.Authenticate(c.Request)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer, ApiKey header="X-API-Key"`)
+			c.Error(err)
+			c.Abort()
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// PrincipalFrom returns the principal authenticated for the request.
+func PrincipalFrom(c *gin.Context) (Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return Principal{}, false
+	}
+
+	principal, ok := value.(Principal)
+	return principal, ok
+}
+
+// RequireRole rejects principals without any of the roles.
+func RequireRole(roles ...Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, _ := PrincipalFrom(c)
+		if !principal.HasRole(roles...) {
+			c.Error(domain.ErrPermissionDenied)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireUser rejects principals that can't access the user identified by the path parameter.
+func RequireUser(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, _ := PrincipalFrom(c)
+		if !principal.CanAccessUser(c.Param(param)) {
+			c.Error(domain.ErrPermissionDenied)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type Driver string
+
+const (
+	DriverSQLite   Driver = "sqlite"
+	DriverPostgres Driver = "postgres"
+
+	memoryPath = ":memory:"
+)
+
+// Config selects the database backing the repositories and the settings of its connection pool.
+// Zero pool settings keep the database/sql defaults.
+type Config struct {
+	Driver          Driver
+	Path            string // SQLite file, in memory when empty
+	Host            string
+	Port            int
+	Name            string
+	User            string
+	Password        string
+	SSLMode         string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// ConfigFromEnv reads the database configuration:
+//   - DB_DRIVER: sqlite or postgres, postgres when DB_HOST is set and sqlite otherwise
+//   - DB_PATH: SQLite database file, in memory when empty
+//   - DB_HOST, DB_PORT, DB_NAME, DB_USER, DB_PW and DB_SSLMODE: PostgreSQL connection, DB_PORT defaulting
+//     to 5432 and DB_SSLMODE to disable
+//   - DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME: connection
+//     pool settings, durations written as 5m, 1h...
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Driver:   Driver(os.Getenv("DB_DRIVER")),
+		Path:     os.Getenv("DB_PATH"),
+		Host:     os.Getenv("DB_HOST"),
+		Port:     5432,
+		Name:     os.Getenv("DB_NAME"),
+		User:     os.Getenv("DB_USER"),
+		Password: os.Getenv("DB_PW"),
+		SSLMode:  os.Getenv("DB_SSLMODE"),
+	}
+
+	if cfg.Driver == "" {
+		cfg.Driver = DriverSQLite
+		if cfg.Host != "" {
+			cfg.Driver = DriverPostgres
+		}
+	}
+	if cfg.Driver != DriverSQLite && cfg.Driver != DriverPostgres {
+		return Config{}, fmt.Errorf("invalid DB_DRIVER %q", cfg.Driver)
+	}
+	if cfg.SSLMode == "" {
+		cfg.SSLMode = "disable"
+	}
+
+	ints := map[string]*int{
+		"DB_PORT":           &cfg.Port,
+		"DB_MAX_OPEN_CONNS": &cfg.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS": &cfg.MaxIdleConns,
+	}
+	for name, field := range ints {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return Config{}, fmt.Errorf("invalid %s %q", name, value)
+		}
+		*field = n
+	}
+
+	durations := map[string]*time.Duration{
+		"DB_CONN_MAX_LIFETIME":  &cfg.ConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME": &cfg.ConnMaxIdleTime,
+	}
+	for name, field := range durations {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return Config{}, fmt.Errorf("invalid %s %q", name, value)
+		}
+		*field = d
+	}
+
+	return cfg, nil
+}
+
+// Open connects to the configured database and applies the connection pool settings.
+func Open(cfg Config, gormConfig *gorm.Config) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+
+	switch cfg.Driver {
+	case DriverPostgres:
+		dialector = postgres.Open(cfg.dsn())
+	case DriverSQLite, "":
+		path := cfg.Path
+		if path == "" {
+			path = memoryPath
+		}
+		dialector = sqlite.Open(path)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s database: %w", cfg.Driver, err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("could not access %s connection pool: %w", cfg.Driver, err)
+	}
+
+	maxOpenConns := cfg.MaxOpenConns
+	if cfg.InMemory() {
+		// every connection to an in memory database opens a new, empty, database
+		maxOpenConns = 1
+	}
+	sqlDB.SetMaxOpenConns(maxOpenConns)
+	if cfg.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	return db, nil
+}
+
+// InMemory reports whether the database only lives as long as the process.
+func (cfg Config) InMemory() bool {
+	return cfg.Driver != DriverPostgres && (cfg.Path == "" || cfg.Path == memoryPath)
+}
+
+func (cfg Config) dsn() string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Path:     cfg.Name,
+		RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+	}
+
+	return dsn.String()
+}
@@ -0,0 +1,30 @@
+package events
+
+import (
+	"context"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"go.uber.org/zap"
+)
+
+// LogSink writes the events delivered to it to the log.
+type LogSink struct {
+	logger *zap.Logger
+}
+
+func NewLogSink(logger *zap.Logger) *LogSink {
+	return &LogSink{
+		logger: logger,
+	}
+}
+
+func (s *LogSink) Deliver(ctx context.Context, event domain.Event) error {
+	s.logger.Info("subscription event",
+		zap.String("id", event.ID),
+		zap.String("type", string(event.Type)),
+		zap.String("subscriptionId", event.SubscriptionID),
+		zap.String("userId", event.UserID),
+		zap.Time("occurredAt", event.OccurredAt),
+	)
+	return nil
+}
@@ -0,0 +1,39 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+// MemorySink keeps the events delivered to it in memory, e.g. for tests to check the events recorded.
+type MemorySink struct {
+	sync.Mutex
+	events []domain.Event
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Deliver(ctx context.Context, event domain.Event) error {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Events returns the events delivered so far, in the order they were delivered.
+func (s *MemorySink) Events() []domain.Event {
+	s.Lock()
+	defer s.Unlock()
+	return append([]domain.Event{}, s.events...)
+}
+
+// Reset forgets the events delivered so far.
+func (s *MemorySink) Reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.events = nil
+}
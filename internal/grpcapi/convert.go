@@ -0,0 +1,125 @@
+package grpcapi
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	membershipv1 "github.com/dnawand/go-membershipapi/pkg/pb/membership/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toUser(user domain.User) *membershipv1.User {
+	return &membershipv1.User{
+		Id:     user.ID,
+		Name:   user.Name,
+		Email:  user.Email,
+		Locale: user.Locale,
+	}
+}
+
+func toProduct(product domain.Product) *membershipv1.Product {
+	plans := make([]*membershipv1.Plan, 0, len(product.ProductPlans))
+	for _, plan := range product.ProductPlans {
+		if plan.Plan == nil {
+			continue
+		}
+		p := toPlan(*plan.Plan)
+		p.Version = int32(plan.Version)
+		p.PreviousPlanId = plan.PreviousPlanID
+		p.Retired = plan.IsRetired
+		p.RetireDate = toTimestamp(plan.RetireDate)
+		plans = append(plans, p)
+	}
+
+	return &membershipv1.Product{
+		Id:      product.ID,
+		Name:    product.Name,
+		Plans:   plans,
+		Version: int32(product.Version),
+	}
+}
+
+func toSubscription(subscription domain.Subscription) *membershipv1.Subscription {
+	s := &membershipv1.Subscription{
+		Id:         subscription.ID,
+		Product:    toProduct(subscription.Product),
+		VoucherId:  subscription.SubscriptionPlan.VoucherID,
+		StartDate:  toTimestamp(&subscription.StartDate),
+		EndDate:    toTimestamp(subscription.EndDate),
+		PauseDate:  toTimestamp(subscription.PauseDate),
+		CancelDate: toTimestamp(subscription.CancelDate),
+		Paused:     subscription.IsPaused,
+		Active:     subscription.IsActive,
+		Seats:      int32(subscription.Seats),
+		Version:    int32(subscription.Version),
+	}
+	if !subscription.TrialDate.IsZero() {
+		s.TrialDate = timestamppb.New(subscription.TrialDate)
+	}
+	if subscription.SubscriptionPlan.Plan != nil {
+		s.Plan = toPlan(*subscription.SubscriptionPlan.Plan)
+	}
+
+	return s
+}
+
+func toPlan(plan domain.Plan) *membershipv1.Plan {
+	p := &membershipv1.Plan{
+		Id:       plan.ID,
+		Interval: &membershipv1.Interval{Unit: string(plan.Interval.Unit), Count: int32(plan.Interval.Count)},
+		Price:    toMoney(plan.Price),
+		Tax:      toMoney(plan.Tax),
+		MaxSeats: int32(plan.MaxSeats),
+	}
+	if plan.SeatPrice != nil {
+		p.SeatPrice = toMoney(*plan.SeatPrice)
+	}
+
+	return p
+}
+
+func toMoney(money domain.Money) *membershipv1.Money {
+	return &membershipv1.Money{Currency: string(money.Code), Amount: money.Number}
+}
+
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func fromPlan(plan *membershipv1.Plan) domain.ProductPlan {
+	p := &domain.Plan{
+		Interval: fromInterval(plan.GetInterval()),
+		Price:    fromMoney(plan.GetPrice()),
+		Tax:      fromMoney(plan.GetTax()),
+		MaxSeats: int(plan.GetMaxSeats()),
+	}
+	if plan.GetSeatPrice() != nil {
+		seatPrice := fromMoney(plan.GetSeatPrice())
+		p.SeatPrice = &seatPrice
+	}
+
+	return domain.ProductPlan{Plan: p}
+}
+
+func fromInterval(interval *membershipv1.Interval) domain.Interval {
+	return domain.Interval{Unit: domain.IntervalUnit(interval.GetUnit()), Count: int(interval.GetCount())}
+}
+
+func fromMoney(money *membershipv1.Money) domain.Money {
+	return domain.Money{Code: domain.CurrencyCode(money.GetCurrency()), Number: money.GetAmount()}
+}
+
+// fromPage reads the page like the list endpoints of the REST API, the sort key prefixed with a
+// minus for descending order.
+func fromPage(page *membershipv1.Page) domain.Page {
+	return domain.Page{
+		Limit:  int(page.GetPageSize()),
+		Cursor: page.GetPageToken(),
+		SortBy: strings.TrimPrefix(page.GetSort(), "-"),
+		Desc:   strings.HasPrefix(page.GetSort(), "-"),
+	}
+}
@@ -0,0 +1,65 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Errors is the ErrorHandler of the gRPC server, turning the domain errors returned by the services
+// into statuses. Services may return a status to override the default code of an error.
+func Errors(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+
+		st, ok := status.FromError(err)
+		if !ok {
+			st = statusFor(err)
+		}
+
+		fields := []zap.Field{zap.Error(err), zap.String("method", info.FullMethod)}
+		if st.Code() == codes.Internal || st.Code() == codes.Unknown {
+			logger.Error("error when handling call", fields...)
+		} else {
+			logger.Debug(st.Message(), fields...)
+		}
+
+		return nil, st.Err()
+	}
+}
+
+func statusFor(err error) *status.Status {
+	var errInvalidArgument *domain.ErrInvalidArgument
+	var errDataNotFound *domain.ErrDataNotFound
+	var errConflict *domain.ErrConflict
+
+	switch {
+	case errors.As(err, &errInvalidArgument):
+		return status.New(codes.InvalidArgument, errInvalidArgument.Error())
+	case errors.As(err, &errDataNotFound):
+		return status.New(codes.NotFound, errDataNotFound.Error())
+	case errors.As(err, &errConflict):
+		return status.New(codes.AlreadyExists, errConflict.Error())
+	case errors.Is(err, domain.ErrUnauthenticated):
+		return status.New(codes.Unauthenticated, "missing or invalid credentials")
+	case errors.Is(err, domain.ErrPermissionDenied):
+		return status.New(codes.PermissionDenied, "caller is not allowed to access this resource")
+	case errors.Is(err, domain.ErrPreconditionFailed):
+		// the caller should read the resource again and retry
+		return status.New(codes.Aborted, "resource changed since the given version")
+	case errors.Is(err, domain.ErrForbidden):
+		return status.New(codes.FailedPrecondition, "action is not allowed in the current state")
+	default:
+		return status.New(codes.Internal, "internal error")
+	}
+}
@@ -0,0 +1,75 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	membershipv1 "github.com/dnawand/go-membershipapi/pkg/pb/membership/v1"
+)
+
+type ProductServer struct {
+	membershipv1.UnimplementedProductServiceServer
+	ps domain.ProductService
+}
+
+func NewProductServer(ps domain.ProductService) *ProductServer {
+	return &ProductServer{
+		ps: ps,
+	}
+}
+
+func (s *ProductServer) CreateProduct(
+	ctx context.Context, req *membershipv1.CreateProductRequest,
+) (*membershipv1.Product, error) {
+	product := domain.Product{Name: req.GetName()}
+	for _, plan := range req.GetPlans() {
+		product.ProductPlans = append(product.ProductPlans, fromPlan(plan))
+	}
+
+	product, err := s.ps.Create(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+
+	return toProduct(product), nil
+}
+
+func (s *ProductServer) GetProduct(ctx context.Context, req *membershipv1.GetProductRequest) (*membershipv1.Product, error) {
+	product, err := s.ps.Fetch(ctx, req.GetProductId())
+	if err != nil {
+		return nil, err
+	}
+
+	return toProduct(product), nil
+}
+
+func (s *ProductServer) ListProducts(
+	ctx context.Context, req *membershipv1.ListProductsRequest,
+) (*membershipv1.ListProductsResponse, error) {
+	filter := domain.ProductFilter{
+		Interval: fromInterval(req.GetInterval()),
+	}
+
+	products, next, err := s.ps.List(ctx, filter, fromPage(req.GetPage()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &membershipv1.ListProductsResponse{NextPageToken: next}
+	for _, product := range products {
+		resp.Products = append(resp.Products, toProduct(product))
+	}
+
+	return resp, nil
+}
+
+func (s *ProductServer) UpdateProduct(
+	ctx context.Context, req *membershipv1.UpdateProductRequest,
+) (*membershipv1.Product, error) {
+	product, err := s.ps.Update(ctx, req.GetProductId(), req.GetName(), int(req.GetVersion()))
+	if err != nil {
+		return nil, err
+	}
+
+	return toProduct(product), nil
+}
@@ -0,0 +1,108 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	membershipv1 "github.com/dnawand/go-membershipapi/pkg/pb/membership/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type SubscriptionServer struct {
+	membershipv1.UnimplementedSubscriptionServiceServer
+	ss domain.SubscriptionService
+}
+
+func NewSubscriptionServer(ss domain.SubscriptionService) *SubscriptionServer {
+	return &SubscriptionServer{
+		ss: ss,
+	}
+}
+
+func (s *SubscriptionServer) CreateSubscription(
+	ctx context.Context, req *membershipv1.CreateSubscriptionRequest,
+) (*membershipv1.CreateSubscriptionResponse, error) {
+	subscription, created, err := s.ss.Subscribe(
+		ctx, req.GetUserId(), req.GetProductId(), req.GetPlanId(), req.GetVoucherId(), int(req.GetSeats()),
+	)
+	if err != nil {
+		var errInvalidArgument *domain.ErrInvalidArgument
+
+		// plans, vouchers and seats that can't be subscribed to conflict with the catalogue
+		if errors.As(err, &errInvalidArgument) {
+			return nil, status.Error(codes.FailedPrecondition, errInvalidArgument.Error())
+		}
+
+		return nil, err
+	}
+
+	return &membershipv1.CreateSubscriptionResponse{
+		Subscription: toSubscription(subscription),
+		Created:      created,
+	}, nil
+}
+
+func (s *SubscriptionServer) GetSubscription(
+	ctx context.Context, req *membershipv1.GetSubscriptionRequest,
+) (*membershipv1.Subscription, error) {
+	subscription, err := s.ss.Fetch(ctx, req.GetUserId(), req.GetSubscriptionId())
+	if err != nil {
+		return nil, err
+	}
+
+	return toSubscription(subscription), nil
+}
+
+func (s *SubscriptionServer) ListSubscriptions(
+	ctx context.Context, req *membershipv1.ListSubscriptionsRequest,
+) (*membershipv1.ListSubscriptionsResponse, error) {
+	filter := domain.SubscriptionFilter{
+		Status:    domain.SubscriptionStatus(req.GetStatus()),
+		ProductID: req.GetProductId(),
+	}
+
+	subscriptions, next, err := s.ss.List(ctx, req.GetUserId(), filter, fromPage(req.GetPage()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &membershipv1.ListSubscriptionsResponse{NextPageToken: next}
+	for _, subscription := range subscriptions {
+		resp.Subscriptions = append(resp.Subscriptions, toSubscription(subscription))
+	}
+
+	return resp, nil
+}
+
+func (s *SubscriptionServer) PauseSubscription(
+	ctx context.Context, req *membershipv1.SubscriptionActionRequest,
+) (*membershipv1.Subscription, error) {
+	return s.action(ctx, req, s.ss.Pause)
+}
+
+func (s *SubscriptionServer) ResumeSubscription(
+	ctx context.Context, req *membershipv1.SubscriptionActionRequest,
+) (*membershipv1.Subscription, error) {
+	return s.action(ctx, req, s.ss.Resume)
+}
+
+func (s *SubscriptionServer) CancelSubscription(
+	ctx context.Context, req *membershipv1.SubscriptionActionRequest,
+) (*membershipv1.Subscription, error) {
+	return s.action(ctx, req, s.ss.Unsubscribe)
+}
+
+func (s *SubscriptionServer) action(
+	ctx context.Context,
+	req *membershipv1.SubscriptionActionRequest,
+	apply func(ctx context.Context, userID, subscriptionID string, version int) (domain.Subscription, error),
+) (*membershipv1.Subscription, error) {
+	subscription, err := apply(ctx, req.GetUserId(), req.GetSubscriptionId(), int(req.GetVersion()))
+	if err != nil {
+		return nil, err
+	}
+
+	return toSubscription(subscription), nil
+}
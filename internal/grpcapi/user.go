@@ -0,0 +1,64 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	membershipv1 "github.com/dnawand/go-membershipapi/pkg/pb/membership/v1"
+)
+
+type UserServer struct {
+	membershipv1.UnimplementedUserServiceServer
+	userService domain.UserService
+}
+
+func NewUserServer(userService domain.UserService) *UserServer {
+	return &UserServer{
+		userService: userService,
+	}
+}
+
+func (s *UserServer) CreateUser(ctx context.Context, req *membershipv1.CreateUserRequest) (*membershipv1.User, error) {
+	user, err := s.userService.Create(ctx, domain.User{
+		Name:   req.GetName(),
+		Email:  req.GetEmail(),
+		Locale: req.GetLocale(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toUser(user), nil
+}
+
+func (s *UserServer) GetUser(ctx context.Context, req *membershipv1.GetUserRequest) (*membershipv1.User, error) {
+	user, err := s.userService.Fetch(ctx, req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	return toUser(user), nil
+}
+
+func (s *UserServer) UpdateUser(ctx context.Context, req *membershipv1.UpdateUserRequest) (*membershipv1.User, error) {
+	user, err := s.userService.Update(ctx, req.GetUserId(), domain.User{
+		Name:   req.GetName(),
+		Email:  req.GetEmail(),
+		Locale: req.GetLocale(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toUser(user), nil
+}
+
+func (s *UserServer) DeleteUser(
+	ctx context.Context, req *membershipv1.DeleteUserRequest,
+) (*membershipv1.DeleteUserResponse, error) {
+	if err := s.userService.Delete(ctx, req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	return &membershipv1.DeleteUserResponse{}, nil
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type EntitlementHandler struct {
+	logger *zap.Logger
+	es     domain.EntitlementService
+}
+
+func NewEntitlementHandler(logger *zap.Logger, es domain.EntitlementService) *EntitlementHandler {
+	return &EntitlementHandler{
+		logger: logger,
+		es:     es,
+	}
+}
+
+func (h *EntitlementHandler) List(c *gin.Context) {
+	userID := c.Param("user-id")
+
+	entitlements, err := h.es.Resolve(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, entitlements)
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setETag sends the version of the returned resource as its entity tag.
+func setETag(c *gin.Context, version int) {
+	c.Header("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// ifMatch returns the version the request is conditioned on by its If-Match header, zero when it
+// accepts any version. Entity tags are compared strongly, so weak tags, lists of tags and tags that
+// were not sent by setETag match no version.
+func ifMatch(c *gin.Context) int {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0
+	}
+
+	if len(header) < 2 || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return -1
+	}
+
+	version, err := strconv.Atoi(header[1 : len(header)-1])
+	if err != nil || version <= 0 {
+		return -1
+	}
+
+	return version
+}
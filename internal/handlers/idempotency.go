@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/dnawand/go-membershipapi/internal/auth"
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	idempotentReplayHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+)
+
+type IdempotencyHandler struct {
+	logger *zap.Logger
+	is     domain.IdempotencyService
+}
+
+// recordingWriter keeps a copy of the response body written by the handlers.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func NewIdempotencyHandler(logger *zap.Logger, is domain.IdempotencyService) *IdempotencyHandler {
+	return &IdempotencyHandler{
+		logger: logger,
+		is:     is,
+	}
+}
+
+// Handle makes the request idempotent when it has an Idempotency-Key header: the response of the first
+// request with the key is stored, and replayed to the repeats of the request instead of handling them.
+// Failed requests are not stored, so that they can be retried with the same key.
+func (h *IdempotencyHandler) Handle(c *gin.Context) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		c.Error(&domain.ErrInvalidArgument{Argument: idempotencyKeyHeader, Msg: idempotencyKeyHeader})
+		c.Abort()
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		c.Abort()
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	// keys are only unique for a caller
+	principal, _ := auth.PrincipalFrom(c)
+	key = fmt.Sprintf("%s:%s:%s", principal.Kind, principal.Subject, key)
+
+	stored, started, err := h.is.Start(c.Request.Context(), key, fingerprint(c, body))
+	if err != nil {
+		c.Error(err)
+		c.Abort()
+		return
+	}
+
+	if !started {
+		if stored.ETag != "" {
+			c.Header("ETag", stored.ETag)
+		}
+		c.Header(idempotentReplayHeader, "true")
+		c.Data(stored.Status, stored.ContentType, stored.Body)
+		c.Abort()
+		return
+	}
+
+	writer := &recordingWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+
+	// the outcome is recorded even when the request was canceled, or the key would stay taken until it expires
+	ctx := context.Background()
+
+	if len(c.Errors) > 0 || !writer.Written() || writer.Status() >= 500 {
+		if err := h.is.Abort(ctx, key); err != nil {
+			h.logger.Error("could not abort idempotent request", zap.Error(err), zap.String("path", c.FullPath()))
+		}
+		return
+	}
+
+	stored.Status = writer.Status()
+	stored.ContentType = writer.Header().Get("Content-Type")
+	stored.ETag = writer.Header().Get("ETag")
+	stored.Body = writer.body.Bytes()
+
+	if err := h.is.Complete(ctx, stored); err != nil {
+		h.logger.Error("could not store idempotent response", zap.Error(err), zap.String("path", c.FullPath()))
+	}
+}
+
+// fingerprint identifies the request, repeats of a request having the same method, url and body.
+func fingerprint(c *gin.Context, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", c.Request.Method, c.Request.URL.RequestURI())
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/gin-gonic/gin"
+)
+
+// listRequest is the query of the list endpoints: the page, sorted by sort and in descending order
+// when prefixed with a minus, and the filters common to the lists.
+type listRequest struct {
+	Limit         int                 `form:"limit" json:"limit"`
+	Cursor        string              `form:"cursor" json:"cursor"`
+	Sort          string              `form:"sort" json:"sort"`
+	CreatedFrom   time.Time           `form:"createdFrom" json:"createdFrom" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo     time.Time           `form:"createdTo" json:"createdTo" time_format:"2006-01-02T15:04:05Z07:00"`
+	Interval      domain.IntervalUnit `form:"interval" json:"interval"`
+	IntervalCount int                 `form:"intervalCount" json:"intervalCount"`
+}
+
+func (r listRequest) page() domain.Page {
+	return domain.Page{
+		Limit:  r.Limit,
+		Cursor: r.Cursor,
+		SortBy: strings.TrimPrefix(r.Sort, "-"),
+		Desc:   strings.HasPrefix(r.Sort, "-"),
+	}
+}
+
+func (r listRequest) interval() domain.Interval {
+	return domain.Interval{Unit: r.Interval, Count: r.IntervalCount}
+}
+
+// setNextPage links the next page of the list in the Link header, when there is one.
+func setNextPage(c *gin.Context, cursor string) {
+	if cursor == "" {
+		return
+	}
+
+	next := *c.Request.URL
+	query := next.Query()
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+
+	c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
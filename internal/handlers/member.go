@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type MemberHandler struct {
+	logger *zap.Logger
+	ms     domain.MemberService
+}
+
+type inviteRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+func NewMemberHandler(logger *zap.Logger, ms domain.MemberService) *MemberHandler {
+	return &MemberHandler{
+		logger: logger,
+		ms:     ms,
+	}
+}
+
+func (h *MemberHandler) Invite(c *gin.Context) {
+	userID := c.Param("user-id")
+	subscriptionID := c.Param("subscription-id")
+	var request inviteRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	member, err := h.ms.Invite(c.Request.Context(), userID, subscriptionID, request.Email)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, member)
+}
+
+func (h *MemberHandler) List(c *gin.Context) {
+	userID := c.Param("user-id")
+	subscriptionID := c.Param("subscription-id")
+
+	members, err := h.ms.List(c.Request.Context(), userID, subscriptionID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+func (h *MemberHandler) Remove(c *gin.Context) {
+	userID := c.Param("user-id")
+	subscriptionID := c.Param("subscription-id")
+	memberID := c.Param("member-id")
+
+	member, err := h.ms.Remove(c.Request.Context(), userID, subscriptionID, memberID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+func (h *MemberHandler) Accept(c *gin.Context) {
+	userID := c.Param("user-id")
+	memberID := c.Param("member-id")
+
+	member, err := h.ms.Accept(c.Request.Context(), userID, memberID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+func (h *MemberHandler) Memberships(c *gin.Context) {
+	userID := c.Param("user-id")
+
+	members, err := h.ms.Memberships(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
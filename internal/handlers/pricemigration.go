@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type PriceMigrationHandler struct {
+	logger *zap.Logger
+	pms    domain.PriceMigrationService
+}
+
+type priceMigrationRequest struct {
+	ProductID          string       `json:"productId" binding:"required"`
+	ProductPlanID      string       `json:"planId" binding:"required"`
+	TargetPrice        domain.Money `json:"targetPrice"`
+	TargetTax          domain.Money `json:"targetTax"`
+	NoticeDays         int          `json:"noticeDays"`
+	EffectiveDate      time.Time    `json:"effectiveDate"`
+	GrandfatheredUntil *time.Time   `json:"grandfatheredUntil"`
+}
+
+func NewPriceMigrationHandler(logger *zap.Logger, pms domain.PriceMigrationService) *PriceMigrationHandler {
+	return &PriceMigrationHandler{
+		logger: logger,
+		pms:    pms,
+	}
+}
+
+func (h *PriceMigrationHandler) Create(c *gin.Context) {
+	var request priceMigrationRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	migration, err := h.pms.Schedule(c.Request.Context(), domain.PriceMigration{
+		ProductID:          request.ProductID,
+		ProductPlanID:      request.ProductPlanID,
+		TargetPrice:        request.TargetPrice,
+		TargetTax:          request.TargetTax,
+		NoticeDays:         request.NoticeDays,
+		EffectiveDate:      request.EffectiveDate,
+		GrandfatheredUntil: request.GrandfatheredUntil,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, migration)
+}
+
+func (h *PriceMigrationHandler) Fetch(c *gin.Context) {
+	migrationID := c.Param("migration-id")
+
+	migration, err := h.pms.Fetch(c.Request.Context(), migrationID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, migration)
+}
+
+func (h *PriceMigrationHandler) Preview(c *gin.Context) {
+	migrationID := c.Param("migration-id")
+
+	candidates, err := h.pms.Preview(c.Request.Context(), migrationID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, candidates)
+}
+
+func (h *PriceMigrationHandler) Cancel(c *gin.Context) {
+	migrationID := c.Param("migration-id")
+
+	migration, err := h.pms.Cancel(c.Request.Context(), migrationID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, migration)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+const problemContentType = "application/problem+json"
+
+// Stable error codes returned in the code member of a Problem. Not found codes are prefixed
+// with the missing resource, e.g. user_not_found.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeInvalidArgument      = "invalid_argument"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeActionForbidden      = "action_forbidden"
+	CodeUnauthenticated      = "unauthenticated"
+	CodePermissionDenied     = "permission_denied"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeInternal             = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details response.
+type Problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Code     string         `json:"code"`
+	Errors   []InvalidField `json:"errors,omitempty"`
+}
+
+// InvalidField describes why a request field was rejected.
+type InvalidField struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+func init() {
+	// report binding errors with the json names of the fields
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// ErrorHandler writes the last error added to the context by a handler as a problem.
+// Handlers add binding errors with gin.ErrorTypeBind, and may set an http status as the error
+// meta to override the default status of the error.
+func ErrorHandler(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		ginErr := c.Errors.Last()
+		problem := newProblem(ginErr)
+		if status, ok := ginErr.Meta.(int); ok {
+			problem.Status = status
+			problem.Title = http.StatusText(status)
+		}
+		problem.Instance = c.Request.URL.Path
+
+		fields := []zap.Field{
+			zap.Error(ginErr.Err),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.FullPath()),
+			zap.Any("params", c.Params),
+		}
+		if problem.Status >= http.StatusInternalServerError {
+			logger.Error("error when handling request", fields...)
+		} else {
+			logger.Debug(problem.Detail, fields...)
+		}
+
+		c.Header("Content-Type", problemContentType)
+		c.JSON(problem.Status, problem)
+	}
+}
+
+func newProblem(ginErr *gin.Error) Problem {
+	var validationErrs validator.ValidationErrors
+	var errInvalidArgument *domain.ErrInvalidArgument
+	var errDataNotFound *domain.ErrDataNotFound
+	var errConflict *domain.ErrConflict
+
+	err := ginErr.Err
+
+	switch {
+	case ginErr.IsType(gin.ErrorTypeBind):
+		problem := problemFor(http.StatusBadRequest, CodeInvalidRequest, "request body could not be read")
+		if errors.As(err, &validationErrs) {
+			problem.Detail = "request body has invalid fields"
+			for _, fe := range validationErrs {
+				problem.Errors = append(problem.Errors, InvalidField{Field: fe.Field(), Reason: fe.Tag()})
+			}
+		}
+		return problem
+	case errors.As(err, &errInvalidArgument):
+		problem := problemFor(http.StatusBadRequest, CodeInvalidArgument, errInvalidArgument.Error())
+		if errInvalidArgument.Argument != "" {
+			problem.Errors = []InvalidField{{Field: errInvalidArgument.Argument, Reason: "invalid"}}
+		}
+		return problem
+	case errors.As(err, &errDataNotFound):
+		problem := problemFor(http.StatusNotFound, CodeNotFound, errDataNotFound.Error())
+		problem.Code = fmt.Sprintf("%s_%s", strings.ReplaceAll(errDataNotFound.DataType, " ", "_"), CodeNotFound)
+		return problem
+	case errors.As(err, &errConflict):
+		problem := problemFor(http.StatusConflict, CodeConflict, errConflict.Error())
+		problem.Errors = []InvalidField{{Field: errConflict.Field, Reason: "taken"}}
+		return problem
+	case errors.Is(err, domain.ErrUnauthenticated):
+		return problemFor(http.StatusUnauthorized, CodeUnauthenticated, "missing or invalid credentials")
+	case errors.Is(err, domain.ErrPermissionDenied):
+		return problemFor(http.StatusForbidden, CodePermissionDenied, "caller is not allowed to access this resource")
+	case errors.Is(err, domain.ErrPreconditionFailed):
+		return problemFor(http.StatusPreconditionFailed, CodePreconditionFailed, "resource changed since the given version")
+	case errors.Is(err, domain.ErrIdempotencyKeyReused):
+		detail := "idempotency key was sent with another request"
+		return problemFor(http.StatusUnprocessableEntity, CodeIdempotencyKeyReused, detail)
+	case errors.Is(err, domain.ErrForbidden):
+		return problemFor(http.StatusLocked, CodeActionForbidden, "action is not allowed in the current state")
+	default:
+		return problemFor(http.StatusInternalServerError, CodeInternal, "")
+	}
+}
+
+func problemFor(status int, code, detail string) Problem {
+	return Problem{
+		Type:   fmt.Sprintf("/problems/%s", strings.ReplaceAll(code, "_", "-")),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
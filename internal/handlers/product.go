@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"errors"
 	"net/http"
 
 	"github.com/dnawand/go-membershipapi/pkg/domain"
@@ -14,6 +13,18 @@ type ProductHandler struct {
 	ps     domain.ProductService
 }
 
+type updateProductRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type updatePlanRequest struct {
+	Interval  domain.Interval `json:"interval"`
+	Price     domain.Money    `json:"price"`
+	Tax       domain.Money    `json:"tax"`
+	MaxSeats  int             `json:"maxSeats"`
+	SeatPrice *domain.Money   `json:"seatPrice"`
+}
+
 func NewProductHandler(logger *zap.Logger, ps domain.ProductService) *ProductHandler {
 	return &ProductHandler{
 		logger: logger,
@@ -25,57 +36,182 @@ func (h *ProductHandler) Create(c *gin.Context) {
 	var product domain.Product
 
 	if err := c.ShouldBindJSON(&product); err != nil {
-		h.logger.Error("request binding error", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	user, err := h.ps.Create(product)
+	product, err := h.ps.Create(c.Request.Context(), product)
 	if err != nil {
-		h.logger.Error("error when creating product", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{})
+		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, user)
+	setETag(c, product.Version)
+	c.JSON(http.StatusCreated, product)
 }
 
 func (h *ProductHandler) Fetch(c *gin.Context) {
 	productID := c.Param("product-id")
 
-	product, err := h.ps.Fetch(productID)
+	product, err := h.ps.Fetch(c.Request.Context(), productID)
 	if err != nil {
-		var dataNotFoundError *domain.ErrDataNotFound
+		c.Error(err)
+		return
+	}
+
+	setETag(c, product.Version)
+	c.JSON(http.StatusOK, product)
+}
+
+func (h *ProductHandler) List(c *gin.Context) {
+	var request listRequest
 
-		if !errors.As(err, &dataNotFoundError) {
-			h.logger.Debug("product not found", zap.Error(err), zap.String("productId", productID))
-			c.JSON(http.StatusInternalServerError, gin.H{})
-			return
-		}
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	filter := domain.ProductFilter{
+		CreatedFrom: request.CreatedFrom,
+		CreatedTo:   request.CreatedTo,
+		Interval:    request.interval(),
+	}
 
-		h.logger.Error("error when fetching product", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{})
+	products, next, err := h.ps.List(c.Request.Context(), filter, request.page())
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
+	setNextPage(c, next)
+	c.JSON(http.StatusOK, products)
+}
+
+func (h *ProductHandler) Update(c *gin.Context) {
+	productID := c.Param("product-id")
+	var request updateProductRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	product, err := h.ps.Update(c.Request.Context(), productID, request.Name, ifMatch(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	setETag(c, product.Version)
 	c.JSON(http.StatusOK, product)
 }
 
-func (h *ProductHandler) List(c *gin.Context) {
-	products, err := h.ps.List()
+func (h *ProductHandler) Archive(c *gin.Context) {
+	productID := c.Param("product-id")
+
+	product, err := h.ps.Archive(c.Request.Context(), productID, ifMatch(c))
 	if err != nil {
-		var dataNotFoundError *domain.ErrDataNotFound
+		c.Error(err)
+		return
+	}
 
-		if !errors.As(err, &dataNotFoundError) {
-			h.logger.Debug("products not found", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{})
-			return
-		}
+	setETag(c, product.Version)
+	c.JSON(http.StatusOK, product)
+}
 
-		h.logger.Error("error when listing products", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{})
+func (h *ProductHandler) AddPlan(c *gin.Context) {
+	productID := c.Param("product-id")
+	var plan domain.ProductPlan
+
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	c.JSON(http.StatusOK, products)
+	plan, err := h.ps.AddPlan(c.Request.Context(), productID, plan, ifMatch(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, plan)
+}
+
+func (h *ProductHandler) UpdatePlan(c *gin.Context) {
+	productID := c.Param("product-id")
+	planID := c.Param("plan-id")
+	var request updatePlanRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	plan, err := h.ps.UpdatePlan(c.Request.Context(), productID, planID, domain.Plan{
+		Interval:  request.Interval,
+		Price:     request.Price,
+		Tax:       request.Tax,
+		MaxSeats:  request.MaxSeats,
+		SeatPrice: request.SeatPrice,
+	}, ifMatch(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if plan.ID == planID {
+		c.JSON(http.StatusOK, plan)
+		return
+	}
+
+	c.JSON(http.StatusCreated, plan)
+}
+
+func (h *ProductHandler) RetirePlan(c *gin.Context) {
+	productID := c.Param("product-id")
+	planID := c.Param("plan-id")
+
+	plan, err := h.ps.RetirePlan(c.Request.Context(), productID, planID, ifMatch(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+func (h *ProductHandler) AddAddOn(c *gin.Context) {
+	productID := c.Param("product-id")
+	var addOn domain.AddOn
+
+	if err := c.ShouldBindJSON(&addOn); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	addOn, err := h.ps.AddAddOn(c.Request.Context(), productID, addOn, ifMatch(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, addOn)
+}
+
+func (h *ProductHandler) AddEntitlement(c *gin.Context) {
+	productID := c.Param("product-id")
+	var entitlement domain.Entitlement
+
+	if err := c.ShouldBindJSON(&entitlement); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	entitlement, err := h.ps.AddEntitlement(c.Request.Context(), productID, entitlement, ifMatch(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, entitlement)
 }
@@ -3,6 +3,7 @@ package handlers
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/dnawand/go-membershipapi/pkg/domain"
 	"github.com/gin-gonic/gin"
@@ -18,6 +19,31 @@ type subscribeRequest struct {
 	ProductID     string `json:"productId" binding:"required"`
 	ProductPlanID string `json:"planId" binding:"required"`
 	VoucherID     string `json:"voucherId"`
+	Seats         int    `json:"seats"`
+}
+
+type subscriptionListRequest struct {
+	listRequest
+	Status    domain.SubscriptionStatus `form:"status" json:"status"`
+	ProductID string                    `form:"productId" json:"productId"`
+}
+
+// subscriptionSearchRequest is the query of the staff search across the subscriptions of every user.
+type subscriptionSearchRequest struct {
+	subscriptionListRequest
+	PlanID       string    `form:"planId" json:"planId"`
+	VoucherID    string    `form:"voucherId" json:"voucherId"`
+	Email        string    `form:"email" json:"email"`
+	TrialEndFrom time.Time `form:"trialEndFrom" json:"trialEndFrom" time_format:"2006-01-02T15:04:05Z07:00"`
+	TrialEndTo   time.Time `form:"trialEndTo" json:"trialEndTo" time_format:"2006-01-02T15:04:05Z07:00"`
+	EndFrom      time.Time `form:"endFrom" json:"endFrom" time_format:"2006-01-02T15:04:05Z07:00"`
+	EndTo        time.Time `form:"endTo" json:"endTo" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// subscriptionSearchResult is a subscription found by a search, along with the user owning it.
+type subscriptionSearchResult struct {
+	domain.Subscription
+	UserID string `json:"userId"`
 }
 
 type action string
@@ -44,128 +70,144 @@ func (h *SubscriptionHandler) Create(c *gin.Context) {
 	var request subscribeRequest
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		h.logger.Error("request binding error", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	user, err := h.ss.Subscribe(userID, request.ProductID, request.ProductPlanID, request.VoucherID)
+	subscription, created, err := h.ss.Subscribe(
+		c.Request.Context(), userID, request.ProductID, request.ProductPlanID, request.VoucherID, request.Seats,
+	)
 	if err != nil {
 		var errInvalidArgument *domain.ErrInvalidArgument
-		var errDataNotFound *domain.ErrDataNotFound
 
+		// plans, vouchers and seats that can't be subscribed to conflict with the catalogue
 		if errors.As(err, &errInvalidArgument) {
-			h.logger.Error("invalid argument", zap.Any("msg", errInvalidArgument), zap.Any("request", request))
-			c.JSON(http.StatusConflict, gin.H{})
+			c.Error(err).SetMeta(http.StatusConflict)
 			return
 		}
 
-		if errors.As(err, &errDataNotFound) {
-			h.logger.Error("data not found", zap.Any("msg", errDataNotFound), zap.Any("request", request))
-			c.JSON(http.StatusConflict, gin.H{})
-			return
-		}
+		c.Error(err)
+		return
+	}
+
+	setETag(c, subscription.Version)
 
-		h.logger.Error("error when subscribing user to product", zap.Error(err), zap.Any("request", request))
-		c.JSON(http.StatusInternalServerError, gin.H{})
+	if !created {
+		c.JSON(http.StatusOK, subscription)
 		return
 	}
 
-	c.JSON(http.StatusCreated, user)
+	c.JSON(http.StatusCreated, subscription)
 }
 
 func (h *SubscriptionHandler) Fetch(c *gin.Context) {
 	userID := c.Param("user-id")
 	subscriptionID := c.Param("subscription-id")
-	subscription, err := h.ss.Fetch(userID, subscriptionID)
+	subscription, err := h.ss.Fetch(c.Request.Context(), userID, subscriptionID)
 	if err != nil {
-		var dataNotFoundError *domain.ErrDataNotFound
-
-		if !errors.As(err, &dataNotFoundError) {
-			h.logger.Debug("subscription not found", zap.Error(err), zap.String("subscriptionId", subscriptionID))
-			c.JSON(http.StatusNotFound, gin.H{})
-			return
-		}
-
-		h.logger.Error("error when fetching subscription", zap.Error(err), zap.String("subscriptionId", subscriptionID))
-		c.JSON(http.StatusInternalServerError, gin.H{})
+		c.Error(err)
 		return
 	}
 
+	setETag(c, subscription.Version)
 	c.JSON(http.StatusOK, subscription)
 }
 
 func (h *SubscriptionHandler) List(c *gin.Context) {
 	userID := c.Param("user-id")
-	subscriptions, err := h.ss.List(userID)
-	if err != nil {
-		var dataNotFoundError *domain.ErrDataNotFound
+	var request subscriptionListRequest
 
-		if !errors.As(err, &dataNotFoundError) {
-			h.logger.Debug("subscriptions not found", zap.Error(err), zap.String("userId", userID))
-			c.JSON(http.StatusNotFound, gin.H{})
-			return
-		}
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
 
-		h.logger.Error("error when listing subscriptions", zap.Error(err), zap.String("userId", userID))
-		c.JSON(http.StatusInternalServerError, gin.H{})
+	filter := domain.SubscriptionFilter{
+		Status:      request.Status,
+		ProductID:   request.ProductID,
+		CreatedFrom: request.CreatedFrom,
+		CreatedTo:   request.CreatedTo,
+		Interval:    request.interval(),
+	}
+
+	subscriptions, next, err := h.ss.List(c.Request.Context(), userID, filter, request.page())
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
+	setNextPage(c, next)
 	c.JSON(http.StatusOK, subscriptions)
 }
 
+func (h *SubscriptionHandler) Search(c *gin.Context) {
+	var request subscriptionSearchRequest
+
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	filter := domain.SubscriptionFilter{
+		UserEmail:    request.Email,
+		Status:       request.Status,
+		ProductID:    request.ProductID,
+		PlanID:       request.PlanID,
+		VoucherID:    request.VoucherID,
+		CreatedFrom:  request.CreatedFrom,
+		CreatedTo:    request.CreatedTo,
+		TrialEndFrom: request.TrialEndFrom,
+		TrialEndTo:   request.TrialEndTo,
+		EndFrom:      request.EndFrom,
+		EndTo:        request.EndTo,
+		Interval:     request.interval(),
+	}
+
+	subscriptions, next, err := h.ss.Search(c.Request.Context(), filter, request.page())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	results := make([]subscriptionSearchResult, len(subscriptions))
+	for i, subscription := range subscriptions {
+		results[i] = subscriptionSearchResult{Subscription: subscription, UserID: subscription.UserID}
+	}
+
+	setNextPage(c, next)
+	c.JSON(http.StatusOK, results)
+}
+
 func (h *SubscriptionHandler) Action(c *gin.Context) {
 	userID := c.Param("user-id")
 	subscriptionID := c.Param("subscription-id")
 	var request actionRequest
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		h.logger.Error("request binding error", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
 	var subscription domain.Subscription
 	var err error
+	version := ifMatch(c)
 
 	switch request.Action {
 	case Pause:
-		subscription, err = h.ss.Pause(userID, subscriptionID)
+		subscription, err = h.ss.Pause(c.Request.Context(), userID, subscriptionID, version)
 	case Resume:
-		subscription, err = h.ss.Resume(userID, subscriptionID)
+		subscription, err = h.ss.Resume(c.Request.Context(), userID, subscriptionID, version)
 	case Unsubscribe:
-		subscription, err = h.ss.Unsubscribe(userID, subscriptionID)
+		subscription, err = h.ss.Unsubscribe(c.Request.Context(), userID, subscriptionID, version)
 	default:
-		h.logger.Debug("invalid action on subscription", zap.Error(err), zap.Any("request", request))
-		c.JSON(http.StatusBadRequest, gin.H{})
-		return
+		err = &domain.ErrInvalidArgument{Argument: "action", Msg: "action"}
 	}
 
 	if err != nil {
-		var errDataNotFound *domain.ErrDataNotFound
-
-		if errors.As(err, &errDataNotFound) {
-			h.logger.Debug("data not found", zap.Any("subscriptionId", subscriptionID), zap.Any("request", request))
-			c.JSON(http.StatusNotFound, gin.H{})
-			return
-		}
-
-		if errors.Is(err, domain.ErrForbidden) {
-			h.logger.Debug("forbidden action", zap.Any("subscriptionId", subscriptionID), zap.Any("request", request))
-			c.JSON(http.StatusLocked, gin.H{})
-			return
-		}
-
-		h.logger.Error(
-			"error when performing action on subscription",
-			zap.Error(err),
-			zap.String("subscriptionId", subscriptionID),
-			zap.Any("request", request),
-		)
-		c.JSON(http.StatusInternalServerError, gin.H{})
+		c.Error(err)
 		return
 	}
 
+	setETag(c, subscription.Version)
 	c.JSON(http.StatusOK, subscription)
 }
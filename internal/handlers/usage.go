@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type UsageHandler struct {
+	logger *zap.Logger
+	us     domain.UsageService
+}
+
+type usageRequest struct {
+	AddOnID   string    `json:"addOnId" binding:"required"`
+	Quantity  int       `json:"quantity" binding:"required"`
+	UsageDate time.Time `json:"usageDate"`
+}
+
+func NewUsageHandler(logger *zap.Logger, us domain.UsageService) *UsageHandler {
+	return &UsageHandler{
+		logger: logger,
+		us:     us,
+	}
+}
+
+func (h *UsageHandler) Report(c *gin.Context) {
+	userID := c.Param("user-id")
+	subscriptionID := c.Param("subscription-id")
+	var request usageRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	record, err := h.us.Report(c.Request.Context(), userID, subscriptionID, domain.UsageRecord{
+		AddOnID:   request.AddOnID,
+		Quantity:  request.Quantity,
+		UsageDate: request.UsageDate,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, record)
+}
+
+func (h *UsageHandler) Summary(c *gin.Context) {
+	userID := c.Param("user-id")
+	subscriptionID := c.Param("subscription-id")
+	at := time.Now()
+
+	if value := c.Query("at"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.Error(&domain.ErrInvalidArgument{Argument: "at", Msg: "at"})
+			return
+		}
+		at = t
+	}
+
+	summary, err := h.us.Summary(c.Request.Context(), userID, subscriptionID, at)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
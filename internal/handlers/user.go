@@ -8,6 +8,12 @@ import (
 	"go.uber.org/zap"
 )
 
+type updateUserRequest struct {
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	Locale string `json:"locale"`
+}
+
 type UserHandler struct {
 	logger      *zap.Logger
 	userService domain.UserService
@@ -24,15 +30,13 @@ func (h *UserHandler) Create(c *gin.Context) {
 	var user domain.User
 
 	if err := c.ShouldBindJSON(&user); err != nil {
-		h.logger.Error("error binding request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	user, err := h.userService.Create(user)
+	user, err := h.userService.Create(c.Request.Context(), user)
 	if err != nil {
-		h.logger.Error("error when creating user", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{})
+		c.Error(err)
 		return
 	}
 
@@ -41,8 +45,68 @@ func (h *UserHandler) Create(c *gin.Context) {
 
 func (h *UserHandler) Fetch(c *gin.Context) {
 	userID := c.Param("user-id")
-	var user domain.User
 
-	user, _ = h.userService.Fetch(userID)
+	user, err := h.userService.Fetch(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
 	c.JSON(http.StatusOK, user)
 }
+
+func (h *UserHandler) Update(c *gin.Context) {
+	userID := c.Param("user-id")
+	var request updateUserRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	user, err := h.userService.Update(c.Request.Context(), userID, domain.User{
+		Name:   request.Name,
+		Email:  request.Email,
+		Locale: request.Locale,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *UserHandler) Delete(c *gin.Context) {
+	userID := c.Param("user-id")
+
+	if err := h.userService.Delete(c.Request.Context(), userID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *UserHandler) Erase(c *gin.Context) {
+	userID := c.Param("user-id")
+
+	if err := h.userService.Erase(c.Request.Context(), userID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *UserHandler) Export(c *gin.Context) {
+	userID := c.Param("user-id")
+
+	export, err := h.userService.Export(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, export)
+}
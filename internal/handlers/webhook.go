@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type WebhookHandler struct {
+	logger *zap.Logger
+	ws     domain.WebhookService
+}
+
+type createWebhookRequest struct {
+	URL        string            `json:"url" binding:"required"`
+	EventTypes domain.EventTypes `json:"eventTypes"`
+}
+
+type updateWebhookRequest struct {
+	URL        string            `json:"url"`
+	EventTypes domain.EventTypes `json:"eventTypes"`
+	IsEnabled  *bool             `json:"enabled"`
+}
+
+// createdWebhook is a registered endpoint along with its secret, only told when the endpoint is created.
+type createdWebhook struct {
+	domain.WebhookEndpoint
+	Secret string `json:"secret"`
+}
+
+func NewWebhookHandler(logger *zap.Logger, ws domain.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		logger: logger,
+		ws:     ws,
+	}
+}
+
+func (h *WebhookHandler) Create(c *gin.Context) {
+	var request createWebhookRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	endpoint, err := h.ws.Create(c.Request.Context(), domain.WebhookEndpoint{
+		URL:        request.URL,
+		EventTypes: request.EventTypes,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, createdWebhook{WebhookEndpoint: endpoint, Secret: endpoint.Secret})
+}
+
+func (h *WebhookHandler) Fetch(c *gin.Context) {
+	endpointID := c.Param("webhook-id")
+
+	endpoint, err := h.ws.Fetch(c.Request.Context(), endpointID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, endpoint)
+}
+
+func (h *WebhookHandler) List(c *gin.Context) {
+	endpoints, err := h.ws.List(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, endpoints)
+}
+
+func (h *WebhookHandler) Update(c *gin.Context) {
+	endpointID := c.Param("webhook-id")
+	var request updateWebhookRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	endpoint, err := h.ws.Update(c.Request.Context(), endpointID, domain.WebhookChanges{
+		URL:        request.URL,
+		EventTypes: request.EventTypes,
+		IsEnabled:  request.IsEnabled,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, endpoint)
+}
+
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	endpointID := c.Param("webhook-id")
+
+	if err := h.ws.Delete(c.Request.Context(), endpointID); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) Deliveries(c *gin.Context) {
+	endpointID := c.Param("webhook-id")
+	var request listRequest
+
+	if err := c.ShouldBindQuery(&request); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	deliveries, next, err := h.ws.Deliveries(c.Request.Context(), endpointID, request.page())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	setNextPage(c, next)
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func (h *WebhookHandler) Replay(c *gin.Context) {
+	endpointID := c.Param("webhook-id")
+	deliveryID := c.Param("delivery-id")
+
+	delivery, err := h.ws.Replay(c.Request.Context(), endpointID, deliveryID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Job is a unit of background work, now is the time of the tick that triggered it. ctx is canceled
+// when the job is stopped.
+type Job func(ctx context.Context, now time.Time) error
+
+// Run calls job every interval until ctx is done. Errors are logged and do not stop the job.
+func Run(ctx context.Context, logger *zap.Logger, name string, interval time.Duration, job Job) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger.Info("starting job", zap.String("job", name), zap.Duration("interval", interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("stopping job", zap.String("job", name))
+			return
+		case now := <-ticker.C:
+			if err := job(ctx, now); err != nil {
+				logger.Error("job failed", zap.String("job", name), zap.Error(err))
+			}
+		}
+	}
+}
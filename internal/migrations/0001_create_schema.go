@@ -0,0 +1,204 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// createSchema creates the tables as they were when the API migrated its models on boot. Databases
+// created that way are brought up to date by it, as it only adds what is missing.
+var createSchema = Migration{
+	Version: 1,
+	Name:    "create_schema",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(
+			&user{},
+			&product{},
+			&productPlan{},
+			&addOn{},
+			&entitlement{},
+			&subscription{},
+			&subscriptionPlan{},
+			&priceMigration{},
+			&usageRecord{},
+			&subscriptionMember{},
+		)
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(
+			"subscription_members",
+			"usage_records",
+			"price_migrations",
+			"subscription_plans",
+			"subscriptions",
+			"entitlements",
+			"add_ons",
+			"product_plans",
+			"product_bundles",
+			"products",
+			"users",
+		)
+	},
+}
+
+// The models below are a copy of the domain models at the time of the migration, so that changing
+// the domain does not change what the migration does. Gorm derives constraint names from them, so
+// later migrations name their own copies after their version.
+
+type user struct {
+	ID            string `gorm:"type:uuid;uniqueIndex"`
+	Name          string
+	Email         string         `gorm:"uniqueIndex"`
+	Subscriptions []subscription `gorm:"foreignKey:UserID"`
+	ErasedAt      *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+}
+
+func (user) TableName() string { return "users" }
+
+type product struct {
+	ID           string `gorm:"type:uuid;uniqueIndex"`
+	Name         string
+	ProductPlans []productPlan `gorm:"foreignKey:ProductID"`
+	AddOns       []addOn       `gorm:"foreignKey:ProductID"`
+	Entitlements []entitlement `gorm:"foreignKey:ProductID"`
+	Bundle       []product     `gorm:"many2many:product_bundles;joinForeignKey:ProductID;joinReferences:BundleID"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+}
+
+func (product) TableName() string { return "products" }
+
+type productPlan struct {
+	ID             string `gorm:"type:uuid;uniqueIndex"`
+	IntervalUnit   string
+	IntervalCount  int
+	Price          string `gorm:"type:text"`
+	Tax            string `gorm:"type:text"`
+	MaxSeats       int
+	SeatPrice      *string `gorm:"type:text"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+	Version        int
+	PreviousPlanID string
+	IsRetired      bool
+	RetireDate     *time.Time
+	ProductID      string `gorm:"type:uuid"`
+}
+
+func (productPlan) TableName() string { return "product_plans" }
+
+type addOn struct {
+	ID        string `gorm:"type:uuid;uniqueIndex"`
+	Key       string
+	Name      string
+	UnitPrice string `gorm:"type:text"`
+	ProductID string `gorm:"type:uuid"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (addOn) TableName() string { return "add_ons" }
+
+type entitlement struct {
+	ID             string `gorm:"type:uuid;uniqueIndex"`
+	Key            string
+	Limit          *int
+	ExcludeOnTrial bool
+	ProductID      string `gorm:"type:uuid"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (entitlement) TableName() string { return "entitlements" }
+
+type subscription struct {
+	ID               string           `gorm:"type:uuid;uniqueIndex"`
+	Product          product          `gorm:"foreignKey:ProductID"`
+	ProductID        string           `gorm:"type:uuid"`
+	SubscriptionPlan subscriptionPlan `gorm:"foreignKey:SubscriptionID"`
+	TrialDate        time.Time
+	StartDate        time.Time
+	EndDate          *time.Time
+	PauseDate        *time.Time
+	CancelDate       *time.Time
+	IsPaused         bool
+	IsActive         bool
+	Seats            int
+	UserID           string `gorm:"type:uuid"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeletedAt        gorm.DeletedAt `gorm:"index"`
+}
+
+func (subscription) TableName() string { return "subscriptions" }
+
+type subscriptionPlan struct {
+	ID               string `gorm:"type:uuid;uniqueIndex"`
+	IntervalUnit     string
+	IntervalCount    int
+	Price            string `gorm:"type:text"`
+	Tax              string `gorm:"type:text"`
+	MaxSeats         int
+	SeatPrice        *string `gorm:"type:text"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeletedAt        gorm.DeletedAt `gorm:"index"`
+	VoucherID        string
+	ProductPlanID    string `gorm:"type:uuid"`
+	PriceMigrationID string
+	SubscriptionID   string `gorm:"type:uuid"`
+}
+
+func (subscriptionPlan) TableName() string { return "subscription_plans" }
+
+type priceMigration struct {
+	ID                 string `gorm:"type:uuid;uniqueIndex"`
+	ProductID          string `gorm:"type:uuid"`
+	ProductPlanID      string `gorm:"type:uuid;index"`
+	TargetPrice        string `gorm:"type:text"`
+	TargetTax          string `gorm:"type:text"`
+	NoticeDays         int
+	EffectiveDate      time.Time
+	GrandfatheredUntil *time.Time
+	IsCanceled         bool
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	DeletedAt          gorm.DeletedAt `gorm:"index"`
+}
+
+func (priceMigration) TableName() string { return "price_migrations" }
+
+type usageRecord struct {
+	ID             string `gorm:"type:uuid;uniqueIndex"`
+	SubscriptionID string `gorm:"type:uuid;index"`
+	AddOnID        string `gorm:"type:uuid"`
+	Quantity       int
+	UsageDate      time.Time `gorm:"index"`
+	CreatedAt      time.Time
+}
+
+func (usageRecord) TableName() string { return "usage_records" }
+
+type subscriptionMember struct {
+	ID             string `gorm:"type:uuid;uniqueIndex"`
+	SubscriptionID string `gorm:"type:uuid;index"`
+	UserID         string `gorm:"index"`
+	Email          string
+	Status         string
+	InviteDate     time.Time
+	AcceptDate     *time.Time
+	RemoveDate     *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (subscriptionMember) TableName() string { return "subscription_members" }
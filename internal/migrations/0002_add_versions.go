@@ -0,0 +1,41 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// addVersions adds the versions compared by conditional updates of subscriptions and products.
+// Existing rows start at the first version.
+var addVersions = Migration{
+	Version: 2,
+	Name:    "add_versions",
+	Up: func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&subscription0002{}, &product0002{}} {
+			if err := tx.Migrator().AddColumn(model, "Version"); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		// SQLite drops columns through the migrator by copying the table, which would lose its indexes
+		if err := tx.Exec("ALTER TABLE subscriptions DROP COLUMN version").Error; err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE products DROP COLUMN version").Error
+	},
+}
+
+type subscription0002 struct {
+	Version int `gorm:"not null;default:1"`
+}
+
+func (subscription0002) TableName() string {
+	return "subscriptions"
+}
+
+type product0002 struct {
+	Version int `gorm:"not null;default:1"`
+}
+
+func (product0002) TableName() string {
+	return "products"
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// createIdempotencyKeys creates the table of the requests made with an idempotency key.
+var createIdempotencyKeys = Migration{
+	Version: 3,
+	Name:    "create_idempotency_keys",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&idempotencyKey0003{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&idempotencyKey0003{})
+	},
+}
+
+type idempotencyKey0003 struct {
+	Key         string `gorm:"primaryKey"`
+	Fingerprint string
+	Status      int
+	ContentType string
+	ETag        string `gorm:"column:etag"`
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+func (idempotencyKey0003) TableName() string {
+	return "idempotency_keys"
+}
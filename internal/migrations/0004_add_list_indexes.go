@@ -0,0 +1,22 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// addListIndexes indexes the default order of the product and subscription lists, subscriptions being
+// listed for a user.
+var addListIndexes = Migration{
+	Version: 4,
+	Name:    "add_list_indexes",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Exec("CREATE INDEX idx_products_created_at ON products (created_at, id)").Error; err != nil {
+			return err
+		}
+		return tx.Exec("CREATE INDEX idx_subscriptions_user_id_created_at ON subscriptions (user_id, created_at, id)").Error
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Exec("DROP INDEX idx_subscriptions_user_id_created_at").Error; err != nil {
+			return err
+		}
+		return tx.Exec("DROP INDEX idx_products_created_at").Error
+	},
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// searchIndexes back the filters of the subscription search, the users being found by their already
+// unique email.
+var searchIndexes = []struct{ name, definition string }{
+	{"idx_subscriptions_product_id_created_at", "subscriptions (product_id, created_at, id)"},
+	{"idx_subscriptions_trial_date", "subscriptions (trial_date)"},
+	{"idx_subscriptions_end_date", "subscriptions (end_date)"},
+	{"idx_subscription_plans_product_plan_id", "subscription_plans (product_plan_id, subscription_id)"},
+	{"idx_subscription_plans_voucher_id", "subscription_plans (voucher_id, subscription_id)"},
+}
+
+var addSearchIndexes = Migration{
+	Version: 5,
+	Name:    "add_search_indexes",
+	Up: func(tx *gorm.DB) error {
+		for _, index := range searchIndexes {
+			if err := tx.Exec("CREATE INDEX " + index.name + " ON " + index.definition).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for i := len(searchIndexes) - 1; i >= 0; i-- {
+			if err := tx.Exec("DROP INDEX " + searchIndexes[i].name).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
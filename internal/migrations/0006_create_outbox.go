@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// createOutbox creates the outbox of the subscription events, and adds the date the end of the trial of
+// a subscription was announced.
+var createOutbox = Migration{
+	Version: 6,
+	Name:    "create_outbox",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&event0006{}); err != nil {
+			return err
+		}
+		return tx.Migrator().AddColumn(&subscription0006{}, "TrialNoticeDate")
+	},
+	Down: func(tx *gorm.DB) error {
+		// SQLite drops columns through the migrator by copying the table, which would lose its indexes
+		if err := tx.Exec("ALTER TABLE subscriptions DROP COLUMN trial_notice_date").Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&event0006{})
+	},
+}
+
+type event0006 struct {
+	Sequence       int64  `gorm:"primaryKey;autoIncrement"`
+	ID             string `gorm:"type:uuid;uniqueIndex"`
+	Type           string
+	SubscriptionID string `gorm:"type:uuid"`
+	UserID         string `gorm:"type:uuid"`
+	Data           []byte
+	OccurredAt     time.Time
+	Attempts       int
+	LastError      string
+	PublishedAt    *time.Time `gorm:"index"`
+}
+
+func (event0006) TableName() string {
+	return "events"
+}
+
+type subscription0006 struct {
+	TrialNoticeDate *time.Time
+}
+
+func (subscription0006) TableName() string {
+	return "subscriptions"
+}
@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// createWebhooks creates the tables of the webhook endpoints and of the log of their deliveries, indexed
+// by endpoint in the order the log is listed.
+var createWebhooks = Migration{
+	Version: 7,
+	Name:    "create_webhooks",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&webhookEndpoint0007{}, &webhookDelivery0007{}); err != nil {
+			return err
+		}
+		return tx.Exec(
+			"CREATE INDEX idx_webhook_deliveries_endpoint_id_created_at ON webhook_deliveries (endpoint_id, created_at, id)",
+		).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&webhookDelivery0007{}, &webhookEndpoint0007{})
+	},
+}
+
+type webhookEndpoint0007 struct {
+	ID          string `gorm:"type:uuid;uniqueIndex"`
+	URL         string
+	EventTypes  string `gorm:"type:text"`
+	Secret      string
+	IsEnabled   bool
+	Failures    int
+	DisableDate *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+}
+
+func (webhookEndpoint0007) TableName() string {
+	return "webhook_endpoints"
+}
+
+type webhookDelivery0007 struct {
+	ID             string `gorm:"type:uuid;uniqueIndex"`
+	EndpointID     string `gorm:"type:uuid"`
+	EventID        string `gorm:"type:uuid"`
+	EventType      string
+	Payload        []byte
+	IsReplay       bool
+	Status         string
+	Attempts       int
+	ResponseStatus int
+	LastError      string
+	NextAttemptAt  *time.Time `gorm:"index"`
+	DeliveredAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (webhookDelivery0007) TableName() string {
+	return "webhook_deliveries"
+}
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// createNotifications creates the queue of the notifications sent to users, and adds the locale users are
+// written to in.
+var createNotifications = Migration{
+	Version: 8,
+	Name:    "create_notifications",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&notification0008{}); err != nil {
+			return err
+		}
+		return tx.Migrator().AddColumn(&user0008{}, "Locale")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE users DROP COLUMN locale").Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&notification0008{})
+	},
+}
+
+type notification0008 struct {
+	ID            string `gorm:"type:uuid;uniqueIndex"`
+	EventID       string `gorm:"type:uuid;index"`
+	UserID        string `gorm:"type:uuid"`
+	Kind          string
+	Email         string
+	Name          string
+	Locale        string
+	Subscription  []byte
+	Status        string
+	Attempts      int
+	LastError     string
+	NextAttemptAt *time.Time `gorm:"index"`
+	SentAt        *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (notification0008) TableName() string {
+	return "notifications"
+}
+
+type user0008 struct {
+	Locale string
+}
+
+func (user0008) TableName() string {
+	return "users"
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// addPriceMigrationCompletion adds the date price migrations were completed on, so completed migrations
+// are no longer applied.
+var addPriceMigrationCompletion = Migration{
+	Version: 9,
+	Name:    "add_price_migration_completion",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().AddColumn(&priceMigration0009{}, "CompleteDate")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Exec("ALTER TABLE price_migrations DROP COLUMN complete_date").Error
+	},
+}
+
+type priceMigration0009 struct {
+	CompleteDate *time.Time
+}
+
+func (priceMigration0009) TableName() string {
+	return "price_migrations"
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// addRenewalAnchors adds the date the periods of subscriptions are counted from, and the end of the period
+// paused subscriptions were paused in. Existing subscriptions count their periods from the end of the trial.
+var addRenewalAnchors = Migration{
+	Version: 10,
+	Name:    "add_renewal_anchors",
+	Up: func(tx *gorm.DB) error {
+		for _, field := range []string{"RenewalAnchor", "PausedEndDate"} {
+			if err := tx.Migrator().AddColumn(&subscription0010{}, field); err != nil {
+				return err
+			}
+		}
+		return tx.Exec("UPDATE subscriptions SET renewal_anchor = trial_date").Error
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE subscriptions DROP COLUMN paused_end_date").Error; err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE subscriptions DROP COLUMN renewal_anchor").Error
+	},
+}
+
+type subscription0010 struct {
+	RenewalAnchor *time.Time
+	PausedEndDate *time.Time
+}
+
+func (subscription0010) TableName() string {
+	return "subscriptions"
+}
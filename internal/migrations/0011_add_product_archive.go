@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// addProductArchive adds the archived state of products, which are no longer listed nor subscribed once
+// archived.
+var addProductArchive = Migration{
+	Version: 11,
+	Name:    "add_product_archive",
+	Up: func(tx *gorm.DB) error {
+		for _, field := range []string{"IsArchived", "ArchiveDate"} {
+			if err := tx.Migrator().AddColumn(&product0011{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE products DROP COLUMN archive_date").Error; err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE products DROP COLUMN is_archived").Error
+	},
+}
+
+type product0011 struct {
+	IsArchived  bool
+	ArchiveDate *time.Time
+}
+
+func (product0011) TableName() string {
+	return "products"
+}
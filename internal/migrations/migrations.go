@@ -0,0 +1,178 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrPending = errors.New("database schema has pending migrations")
+
+// Migration is a numbered schema change. Up and Down run inside a transaction with the update of
+// the migrations table, so a failing migration leaves the schema as it was.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// State is a migration and when it was applied, nil while pending.
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// record is a row of the migrations table, one per applied migration.
+type record struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (record) TableName() string {
+	return "migrations"
+}
+
+// all migrations, in the order they are applied. Never edit or remove an applied migration,
+// add a new one instead.
+var all = []Migration{
+	createSchema,
+	addVersions,
+	createIdempotencyKeys,
+	addListIndexes,
+	addSearchIndexes,
+	createOutbox,
+	createWebhooks,
+	createNotifications,
+	addPriceMigrationCompletion,
+	addRenewalAnchors,
+	addProductArchive,
+}
+
+// Up applies the pending migrations in order, returning the ones applied.
+func Up(db *gorm.DB) ([]Migration, error) {
+	if err := createTable(db); err != nil {
+		return nil, err
+	}
+
+	states, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	for _, state := range states {
+		if state.AppliedAt != nil {
+			continue
+		}
+
+		m := state.Migration
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&record{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("error when applying migration %s: %w", m, err)
+		}
+		applied = append(applied, m)
+	}
+
+	return applied, nil
+}
+
+// Down rolls back the last applied migration, returning it.
+func Down(db *gorm.DB) (Migration, error) {
+	if err := createTable(db); err != nil {
+		return Migration{}, err
+	}
+
+	states, err := Status(db)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	for i := len(states) - 1; i >= 0; i-- {
+		if states[i].AppliedAt == nil {
+			continue
+		}
+
+		m := states[i].Migration
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&record{}, m.Version).Error
+		})
+		if err != nil {
+			return Migration{}, fmt.Errorf("error when rolling back migration %s: %w", m, err)
+		}
+		return m, nil
+	}
+
+	return Migration{}, errors.New("no migration to roll back")
+}
+
+// Status lists every migration with the date it was applied. It only reads the database, every
+// migration being pending until the migrations table is created by Up.
+func Status(db *gorm.DB) ([]State, error) {
+	var records []record
+	if db.Migrator().HasTable(&record{}) {
+		if tx := db.Find(&records); tx.Error != nil {
+			return nil, fmt.Errorf("error when querying migrations: %w", tx.Error)
+		}
+	}
+
+	appliedAt := map[int]time.Time{}
+	for _, r := range records {
+		appliedAt[r.Version] = r.AppliedAt
+	}
+
+	states := make([]State, 0, len(all))
+	for _, m := range all {
+		state := State{Migration: m}
+		if t, ok := appliedAt[m.Version]; ok {
+			state.AppliedAt = &t
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// Check returns ErrPending unless every migration was applied.
+func Check(db *gorm.DB) error {
+	states, err := Status(db)
+	if err != nil {
+		return err
+	}
+
+	pending := []string{}
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			pending = append(pending, state.String())
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %s", ErrPending, strings.Join(pending, ", "))
+	}
+
+	return nil
+}
+
+func createTable(db *gorm.DB) error {
+	if err := db.AutoMigrate(&record{}); err != nil {
+		return fmt.Errorf("could not create migrations table: %w", err)
+	}
+
+	return nil
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
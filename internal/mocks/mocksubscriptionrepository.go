@@ -1,26 +1,74 @@
 package mocks
 
-import "github.com/dnawand/go-membershipapi/pkg/domain"
+import (
+	"context"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
 
 type MockSubscriptionRepository struct {
-	SaveFunc   func(domain.User) (domain.Subscription, error)
-	GetFunc    func(subscriptionID string) (domain.Subscription, error)
-	ListFunc   func(userID string) ([]domain.Subscription, error)
-	UpdateFunc func(domain.Subscription, domain.ToUpdate) (domain.Subscription, error)
+	SaveFunc   func(ctx context.Context, u domain.User, events []domain.Event) (domain.Subscription, error)
+	GetFunc    func(ctx context.Context, subscriptionID string) (domain.Subscription, error)
+	ListFunc   func(ctx context.Context, f domain.SubscriptionFilter, p domain.Page) ([]domain.Subscription, string, error)
+	UpdateFunc func(
+		ctx context.Context,
+		s domain.Subscription,
+		toUpdate domain.ToUpdate,
+		events []domain.Event,
+	) (domain.Subscription, error)
+
+	GetForUpdateFunc      func(ctx context.Context, subscriptionID string) (domain.Subscription, error)
+	ListByProductPlanFunc func(ctx context.Context, productPlanID string) ([]domain.Subscription, error)
+	UpdatePlanFunc        func(ctx context.Context, p domain.SubscriptionPlan, toUpdate domain.ToUpdate) (domain.SubscriptionPlan, error)
+}
+
+func (msr *MockSubscriptionRepository) Save(
+	ctx context.Context,
+	u domain.User,
+	events ...domain.Event,
+) (domain.Subscription, error) {
+	return msr.SaveFunc(ctx, u, events)
+}
+
+func (msr *MockSubscriptionRepository) Get(ctx context.Context, subscriptionID string) (domain.Subscription, error) {
+	return msr.GetFunc(ctx, subscriptionID)
+}
+
+func (msr *MockSubscriptionRepository) GetForUpdate(
+	ctx context.Context,
+	subscriptionID string,
+) (domain.Subscription, error) {
+	return msr.GetForUpdateFunc(ctx, subscriptionID)
 }
 
-func (msr *MockSubscriptionRepository) Save(u domain.User) (domain.Subscription, error) {
-	return msr.SaveFunc(u)
+func (msr *MockSubscriptionRepository) List(
+	ctx context.Context,
+	f domain.SubscriptionFilter,
+	p domain.Page,
+) ([]domain.Subscription, string, error) {
+	return msr.ListFunc(ctx, f, p)
 }
 
-func (msr *MockSubscriptionRepository) Get(subscriptionID string) (domain.Subscription, error) {
-	return msr.GetFunc(subscriptionID)
+func (msr *MockSubscriptionRepository) Update(
+	ctx context.Context,
+	s domain.Subscription,
+	toUpdate domain.ToUpdate,
+	events ...domain.Event,
+) (domain.Subscription, error) {
+	return msr.UpdateFunc(ctx, s, toUpdate, events)
 }
 
-func (msr *MockSubscriptionRepository) List(userID string) ([]domain.Subscription, error) {
-	return msr.ListFunc(userID)
+func (msr *MockSubscriptionRepository) ListByProductPlan(
+	ctx context.Context,
+	productPlanID string,
+) ([]domain.Subscription, error) {
+	return msr.ListByProductPlanFunc(ctx, productPlanID)
 }
 
-func (msr *MockSubscriptionRepository) Update(s domain.Subscription, toUpdate domain.ToUpdate) (domain.Subscription, error) {
-	return msr.UpdateFunc(s, toUpdate)
+func (msr *MockSubscriptionRepository) UpdatePlan(
+	ctx context.Context,
+	p domain.SubscriptionPlan,
+	toUpdate domain.ToUpdate,
+) (domain.SubscriptionPlan, error) {
+	return msr.UpdatePlanFunc(ctx, p, toUpdate)
 }
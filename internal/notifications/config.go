@@ -0,0 +1,57 @@
+package notifications
+
+import (
+	"os"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"go.uber.org/zap"
+)
+
+const defaultFrom = "Membership <no-reply@membership.local>"
+
+// Config selects how notifications are sent: through SMTP when a host is set, as files when a directory is
+// set, and to the log otherwise.
+type Config struct {
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	From         string
+	Dir          string
+}
+
+// ConfigFromEnv reads the notifications configuration:
+//   - SMTP_HOST, SMTP_PORT, SMTP_USER and SMTP_PW: SMTP server, SMTP_PORT defaulting to 587
+//   - NOTIFICATIONS_FROM: sender of the emails, e.g. Membership <no-reply@membership.com>
+//   - NOTIFICATIONS_DIR: directory the emails are written to when there is no SMTP server
+func ConfigFromEnv() Config {
+	cfg := Config{
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     os.Getenv("SMTP_PORT"),
+		SMTPUser:     os.Getenv("SMTP_USER"),
+		SMTPPassword: os.Getenv("SMTP_PW"),
+		From:         os.Getenv("NOTIFICATIONS_FROM"),
+		Dir:          os.Getenv("NOTIFICATIONS_DIR"),
+	}
+
+	if cfg.SMTPPort == "" {
+		cfg.SMTPPort = "587"
+	}
+	if cfg.From == "" {
+		cfg.From = defaultFrom
+	}
+
+	return cfg
+}
+
+// NewNotifier returns the notifier selected by the configuration.
+func NewNotifier(cfg Config, logger *zap.Logger) (domain.Notifier, error) {
+	switch {
+	case cfg.SMTPHost != "":
+		return NewSMTPNotifier(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword, cfg.From)
+	case cfg.Dir != "":
+		return NewFileNotifier(cfg.Dir, cfg.From)
+	default:
+		return NewLogNotifier(logger), nil
+	}
+}
@@ -0,0 +1,47 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+// FileNotifier writes each message as an .eml file in a directory, e.g. to read them while developing
+// without an SMTP server.
+type FileNotifier struct {
+	dir  string
+	from string
+}
+
+func NewFileNotifier(dir, from string) (*FileNotifier, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create notifications directory: %w", err)
+	}
+
+	return &FileNotifier{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+func (n *FileNotifier) Notify(ctx context.Context, message domain.Message) error {
+	email, err := compose(n.from, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(n.dir, time.Now().Format("20060102T150405")+"-*.eml")
+	if err != nil {
+		return fmt.Errorf("could not create email file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(email); err != nil {
+		return fmt.Errorf("could not write email file: %w", err)
+	}
+
+	return f.Close()
+}
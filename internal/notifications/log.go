@@ -0,0 +1,27 @@
+package notifications
+
+import (
+	"context"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"go.uber.org/zap"
+)
+
+// LogNotifier writes the recipient and subject of the messages to the log instead of sending them.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{
+		logger: logger,
+	}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, message domain.Message) error {
+	n.logger.Info("notification",
+		zap.String("to", message.To),
+		zap.String("subject", message.Subject),
+	)
+	return nil
+}
@@ -0,0 +1,55 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+// SMTPNotifier sends messages by email through an SMTP server, upgrading the connection with STARTTLS when
+// the server supports it.
+type SMTPNotifier struct {
+	addr   string
+	auth   smtp.Auth // nil for servers not requiring authentication
+	from   string
+	sender string // address of from
+}
+
+// NewSMTPNotifier returns a notifier sending emails from the given address, e.g.
+// Membership <no-reply@membership.com>. Servers are authenticated with PLAIN when a username is given.
+func NewSMTPNotifier(host, port, username, password, from string) (*SMTPNotifier, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address of notifications: %w", err)
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPNotifier{
+		addr:   net.JoinHostPort(host, port),
+		auth:   auth,
+		from:   from,
+		sender: sender.Address,
+	}, nil
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, message domain.Message) error {
+	email, err := compose(n.from, message, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := smtp.SendMail(n.addr, n.auth, n.sender, []string{message.To}, email); err != nil {
+		return fmt.Errorf("could not send email: %w", err)
+	}
+
+	return nil
+}
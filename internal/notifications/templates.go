@@ -0,0 +1,145 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+// DefaultLocale is the locale of the users without one, or without templates for theirs.
+const DefaultLocale = "en"
+
+// dateLayouts are the layouts dates are written with in each locale.
+var dateLayouts = map[string]string{
+	"en":    "January 2, 2006",
+	"pt-br": "02/01/2006",
+}
+
+// templateFiles holds a directory of templates for each locale. A notification has a <kind>.txt file
+// defining its "subject" and its plain "text", and a <kind>.html file with its HTML.
+//
+//go:embed templates
+var templateFiles embed.FS
+
+type templateSet struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates writes notifications with the embedded templates, implementing domain.NotificationRenderer.
+type Templates struct {
+	sets map[string]templateSet // by lower case locale and kind, e.g. pt-br/subscribed
+}
+
+// messageData is what the templates are executed with.
+type messageData struct {
+	Name      string
+	Product   string
+	TrialDate time.Time
+	EndDate   *time.Time
+	OnTrial   bool // when the notification was queued
+}
+
+func NewTemplates() (*Templates, error) {
+	locales, err := fs.ReadDir(templateFiles, "templates")
+	if err != nil {
+		return nil, fmt.Errorf("could not read notification templates: %w", err)
+	}
+
+	t := &Templates{sets: map[string]templateSet{}}
+
+	for _, locale := range locales {
+		dir := path.Join("templates", locale.Name())
+		layout, ok := dateLayouts[strings.ToLower(locale.Name())]
+		if !ok {
+			return nil, fmt.Errorf("no date layout for the notifications of locale %s", locale.Name())
+		}
+		funcs := map[string]interface{}{
+			"date": func(date time.Time) string { return date.Format(layout) },
+		}
+
+		texts, err := fs.Glob(templateFiles, path.Join(dir, "*.txt"))
+		if err != nil {
+			return nil, fmt.Errorf("could not read notification templates: %w", err)
+		}
+
+		for _, textFile := range texts {
+			kind := strings.TrimSuffix(path.Base(textFile), ".txt")
+
+			text, err := texttemplate.New(kind).Funcs(funcs).ParseFS(templateFiles, textFile)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse notification template %s: %w", textFile, err)
+			}
+			html, err := htmltemplate.New(kind).Funcs(funcs).ParseFS(templateFiles, path.Join(dir, kind+".html"))
+			if err != nil {
+				return nil, fmt.Errorf("could not parse notification template %s: %w", kind, err)
+			}
+
+			t.sets[strings.ToLower(locale.Name())+"/"+kind] = templateSet{text: text, html: html}
+		}
+	}
+
+	return t, nil
+}
+
+// Render writes the notification in the locale of its recipient. Missing templates are looked up in the
+// language of the locale, e.g. pt for pt-PT, and then in DefaultLocale.
+func (t *Templates) Render(notification domain.Notification) (domain.Message, error) {
+	set, ok := t.lookup(notification.Locale, notification.Kind)
+	if !ok {
+		return domain.Message{}, fmt.Errorf("no template for notification %s", notification.Kind)
+	}
+
+	var subscription domain.Subscription
+	if err := json.Unmarshal(notification.Subscription, &subscription); err != nil {
+		return domain.Message{}, fmt.Errorf("could not decode subscription of notification: %w", err)
+	}
+
+	data := messageData{
+		Name:      notification.Name,
+		Product:   subscription.Product.Name,
+		TrialDate: subscription.TrialDate,
+		EndDate:   subscription.EndDate,
+		OnTrial:   subscription.TrialDate.After(notification.CreatedAt),
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := set.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return domain.Message{}, fmt.Errorf("could not write subject of notification: %w", err)
+	}
+	if err := set.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return domain.Message{}, fmt.Errorf("could not write text of notification: %w", err)
+	}
+	if err := set.html.ExecuteTemplate(&html, string(notification.Kind)+".html", data); err != nil {
+		return domain.Message{}, fmt.Errorf("could not write html of notification: %w", err)
+	}
+
+	return domain.Message{
+		To:      notification.Email,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+func (t *Templates) lookup(locale string, kind domain.NotificationKind) (templateSet, bool) {
+	locale = strings.ToLower(locale)
+	language := strings.SplitN(locale, "-", 2)[0]
+
+	for _, candidate := range []string{locale, language, DefaultLocale} {
+		if set, ok := t.sets[candidate+"/"+string(kind)]; ok {
+			return set, true
+		}
+	}
+
+	return templateSet{}, false
+}
@@ -0,0 +1,76 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+// Headers of the requests posted to webhook endpoints.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+const sendTimeout = 10 * time.Second
+
+// Sender posts deliveries as JSON, signed with the secret of the endpoint.
+type Sender struct {
+	client *http.Client
+}
+
+func NewSender() *Sender {
+	return &Sender{
+		client: &http.Client{Timeout: sendTimeout},
+	}
+}
+
+// Send posts the payload of the delivery to the endpoint. Its id is sent in the Webhook-Id header, so that
+// receivers can discard the retries of deliveries they already handled.
+func (s *Sender) Send(
+	ctx context.Context,
+	endpoint domain.WebhookEndpoint,
+	delivery domain.WebhookDelivery,
+) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("could not create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("could not post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return resp.StatusCode, nil
+}
+
+// Sign returns the Webhook-Signature of a body sent at the given unix time: the hex encoded HMAC-SHA256,
+// keyed with the secret, of the timestamp and the body joined by a dot, prefixed with the version v1=.
+// Receivers compute it again to check the request, and reject old timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
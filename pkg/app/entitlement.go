@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+type EntitlementService struct {
+	ur domain.UserRepository
+	sr domain.SubscriptionRepository
+	pr domain.ProductRepository
+	mr domain.MemberRepository
+}
+
+func NewEntitlementService(
+	ur domain.UserRepository,
+	sr domain.SubscriptionRepository,
+	pr domain.ProductRepository,
+	mr domain.MemberRepository,
+) *EntitlementService {
+	return &EntitlementService{ur: ur, sr: sr, pr: pr, mr: mr}
+}
+
+// Resolve merges the entitlements granted to the user by their own subscriptions and by the group
+// subscriptions they are a member of, including the products of bundles. Canceled and paused
+// subscriptions grant nothing, and entitlements excluded on trial are skipped until the trial ends.
+// When several subscriptions grant the same key the highest limit wins.
+func (es *EntitlementService) Resolve(ctx context.Context, userID string) ([]domain.EffectiveEntitlement, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	user, err := es.ur.Get(ctx, userID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return nil, err
+		}
+		return nil, domain.ErrInternal
+	}
+
+	memberships, err := es.mr.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, domain.ErrInternal
+	}
+
+	subscriptions := user.Subscriptions
+	isMember := map[string]bool{}
+	for _, m := range memberships {
+		subscription, err := es.sr.Get(ctx, m.SubscriptionID)
+		if err != nil {
+			return nil, domain.ErrInternal
+		}
+		subscriptions = append(subscriptions, subscription)
+		isMember[subscription.ID] = true
+	}
+
+	now := time.Now()
+	products := map[string]domain.Product{}
+	entitlements := map[string]*domain.EffectiveEntitlement{}
+
+	for _, subscription := range subscriptions {
+		if !subscription.IsActive || subscription.IsPaused {
+			continue
+		}
+
+		source := domain.EntitlementSource{
+			SubscriptionID: subscription.ID,
+			ProductID:      subscription.ProductID,
+			OnTrial:        subscription.TrialDate.After(now),
+			IsMember:       isMember[subscription.ID],
+		}
+
+		granted, err := es.grantedBy(ctx, subscription.ProductID, products)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range granted {
+			if source.OnTrial && e.ExcludeOnTrial {
+				continue
+			}
+			merge(entitlements, e, source)
+		}
+	}
+
+	result := make([]domain.EffectiveEntitlement, 0, len(entitlements))
+	for _, e := range entitlements {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+
+	return result, nil
+}
+
+// grantedBy returns the entitlements of the product and of the products it bundles.
+func (es *EntitlementService) grantedBy(
+	ctx context.Context,
+	productID string,
+	cache map[string]domain.Product,
+) ([]domain.Entitlement, error) {
+	product, err := es.fetchProduct(ctx, productID, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := append([]domain.Entitlement{}, product.Entitlements...)
+	for _, bundled := range product.Bundle {
+		p, err := es.fetchProduct(ctx, bundled.ID, cache)
+		if err != nil {
+			return nil, err
+		}
+		granted = append(granted, p.Entitlements...)
+	}
+
+	return granted, nil
+}
+
+func (es *EntitlementService) fetchProduct(
+	ctx context.Context,
+	productID string,
+	cache map[string]domain.Product,
+) (domain.Product, error) {
+	if product, ok := cache[productID]; ok {
+		return product, nil
+	}
+
+	product, err := es.pr.Get(ctx, productID)
+	if err != nil {
+		return domain.Product{}, domain.ErrInternal
+	}
+	cache[productID] = product
+
+	return product, nil
+}
+
+func merge(
+	entitlements map[string]*domain.EffectiveEntitlement,
+	entitlement domain.Entitlement,
+	source domain.EntitlementSource,
+) {
+	effective, ok := entitlements[entitlement.Key]
+	if !ok {
+		entitlements[entitlement.Key] = &domain.EffectiveEntitlement{
+			Key:     entitlement.Key,
+			Limit:   entitlement.Limit,
+			Sources: []domain.EntitlementSource{source},
+		}
+		return
+	}
+
+	effective.Sources = append(effective.Sources, source)
+	if effective.Limit == nil || entitlement.Limit == nil {
+		effective.Limit = nil
+		return
+	}
+	if *entitlement.Limit > *effective.Limit {
+		effective.Limit = entitlement.Limit
+	}
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"errors"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+// domainError returns the domain errors, which callers are told about, and hides the others,
+// e.g. database errors, behind ErrInternal.
+func domainError(err error) error {
+	var dataNotFoundErr *domain.ErrDataNotFound
+	var invalidArgumentErr *domain.ErrInvalidArgument
+	var conflictErr *domain.ErrConflict
+
+	if errors.As(err, &dataNotFoundErr) ||
+		errors.As(err, &invalidArgumentErr) ||
+		errors.As(err, &conflictErr) ||
+		errors.Is(err, domain.ErrForbidden) ||
+		errors.Is(err, domain.ErrPreconditionFailed) ||
+		errors.Is(err, domain.ErrInternal) {
+		return err
+	}
+
+	return domain.ErrInternal
+}
+
+// checkVersion fails with ErrPreconditionFailed when the caller based its change on another version
+// of the data than the current one. A zero version means the caller expects none in particular.
+func checkVersion(current, expected int) error {
+	if expected != 0 && expected != current {
+		return domain.ErrPreconditionFailed
+	}
+
+	return nil
+}
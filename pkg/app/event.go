@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+// EventRetention is how long events are kept in the outbox once published.
+var EventRetention = 7 * 24 * time.Hour
+
+// eventBatch is how many events are read from the outbox at once.
+const eventBatch = 100
+
+type EventRelay struct {
+	or    domain.OutboxRepository
+	sinks []domain.EventSink
+}
+
+func NewEventRelay(or domain.OutboxRepository, sinks ...domain.EventSink) *EventRelay {
+	return &EventRelay{
+		or:    or,
+		sinks: sinks,
+	}
+}
+
+// Relay delivers the pending events of the outbox to every sink, in the order they were recorded, and
+// returns how many were delivered. It stops at the first event a sink fails to take, which is delivered
+// again to every sink on the next call, before the events following it.
+func (er *EventRelay) Relay(ctx context.Context) (int, error) {
+	delivered := 0
+
+	for {
+		events, err := er.or.ListPending(ctx, eventBatch)
+		if err != nil {
+			return delivered, domain.ErrInternal
+		}
+
+		for _, event := range events {
+			if err := er.deliver(ctx, event); err != nil {
+				if err := er.or.MarkFailed(ctx, event, err.Error()); err != nil {
+					return delivered, domain.ErrInternal
+				}
+				return delivered, fmt.Errorf("could not deliver event %s: %w", event.ID, err)
+			}
+
+			if err := er.or.MarkPublished(ctx, event, time.Now()); err != nil {
+				return delivered, domain.ErrInternal
+			}
+			delivered++
+		}
+
+		if len(events) < eventBatch {
+			return delivered, nil
+		}
+	}
+}
+
+// Purge deletes the events published more than EventRetention before now, returning how many were deleted.
+func (er *EventRelay) Purge(ctx context.Context, now time.Time) (int64, error) {
+	return er.or.DeletePublished(ctx, now.Add(-EventRetention))
+}
+
+func (er *EventRelay) deliver(ctx context.Context, event domain.Event) error {
+	for _, sink := range er.sinks {
+		if err := sink.Deliver(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
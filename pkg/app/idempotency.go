@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/dnawand/go-membershipapi/pkg/repositories"
+)
+
+// IdempotencyKeyTTL is how long the response of a request is replayed to the repeats of the request.
+var IdempotencyKeyTTL = 24 * time.Hour
+
+type IdempotencyService struct {
+	ir domain.IdempotencyRepository
+}
+
+func NewIdempotencyService(ir domain.IdempotencyRepository) *IdempotencyService {
+	return &IdempotencyService{
+		ir: ir,
+	}
+}
+
+// Start records that the request with the key and fingerprint is being handled. When the key is already
+// taken, the stored request is returned instead and started is false. A key sent again with another
+// request fails with ErrIdempotencyKeyReused, and with ErrConflict while the first request is handled.
+func (is *IdempotencyService) Start(
+	ctx context.Context,
+	key, fingerprint string,
+) (stored domain.IdempotencyKey, started bool, err error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+	now := time.Now()
+
+	stored, err = is.ir.Get(ctx, key)
+	switch {
+	case errors.As(err, &dataNotFoundErr):
+	case err != nil:
+		return domain.IdempotencyKey{}, false, domain.ErrInternal
+	case !stored.ExpiresAt.After(now):
+		// expired keys may not have been purged yet
+		if err := is.ir.Delete(ctx, key); err != nil {
+			return domain.IdempotencyKey{}, false, domain.ErrInternal
+		}
+	case stored.Fingerprint != fingerprint:
+		return domain.IdempotencyKey{}, false, domain.ErrIdempotencyKeyReused
+	case !stored.IsHandled():
+		return domain.IdempotencyKey{}, false, &domain.ErrConflict{DataType: "request", Field: "Idempotency-Key"}
+	default:
+		return stored, false, nil
+	}
+
+	stored, err = is.ir.Save(ctx, domain.IdempotencyKey{
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   now.Add(IdempotencyKeyTTL),
+	})
+	if err != nil {
+		return domain.IdempotencyKey{}, false, domainError(err)
+	}
+
+	return stored, true, nil
+}
+
+// Complete stores the response of the started request.
+func (is *IdempotencyService) Complete(ctx context.Context, key domain.IdempotencyKey) error {
+	toUpdate := domain.ToUpdate{
+		repositories.ResponseStatus:      key.Status,
+		repositories.ResponseContentType: key.ContentType,
+		repositories.ResponseETag:        key.ETag,
+		repositories.ResponseBody:        key.Body,
+	}
+
+	if _, err := is.ir.Update(ctx, key, toUpdate); err != nil {
+		return domainError(err)
+	}
+
+	return nil
+}
+
+// Abort frees the key of a started request that has no response to replay, so that it can be retried.
+func (is *IdempotencyService) Abort(ctx context.Context, key string) error {
+	if err := is.ir.Delete(ctx, key); err != nil {
+		return domain.ErrInternal
+	}
+
+	return nil
+}
+
+// Purge deletes the keys expired at now, returning how many were deleted.
+func (is *IdempotencyService) Purge(ctx context.Context, now time.Time) (int64, error) {
+	return is.ir.DeleteExpired(ctx, now)
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+// addInterval returns t moved forward by n intervals.
+//
+// Month and year intervals are always computed from t, never chained, and a day that does not exist
+// in the target month is clamped to the last day of that month instead of overflowing into the next
+// one: Jan 31 plus 1 month is Feb 28 (Feb 29 on leap years), plus 2 months is Mar 31.
+func addInterval(t time.Time, interval domain.Interval, n int) time.Time {
+	count := interval.Count * n
+
+	switch interval.Unit {
+	case domain.IntervalDay:
+		return t.AddDate(0, 0, count)
+	case domain.IntervalWeek:
+		return t.AddDate(0, 0, 7*count)
+	case domain.IntervalMonth:
+		return addMonths(t, count)
+	case domain.IntervalYear:
+		return addMonths(t, 12*count)
+	default:
+		return t
+	}
+}
+
+// periodEndAfter returns the first end of period after t, for periods of the given interval counted from
+// anchor. Every end is computed from anchor, so month ends don't drift after a shorter month.
+func periodEndAfter(anchor time.Time, interval domain.Interval, t time.Time) time.Time {
+	end := addInterval(anchor, interval, 1)
+	for n := 2; !end.After(t); n++ {
+		end = addInterval(anchor, interval, n)
+	}
+
+	return end
+}
+
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+
+	firstOfTarget := time.Date(year, month+time.Month(months), 1, hour, min, sec, t.Nanosecond(), t.Location())
+	lastDay := firstOfTarget.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+
+	return time.Date(
+		firstOfTarget.Year(), firstOfTarget.Month(), day, hour, min, sec, t.Nanosecond(), t.Location(),
+	)
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddInterval(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 10, 30, 0, 0, time.UTC)
+	}
+
+	t.Run("test day and week intervals", func(t *testing.T) {
+		tenDays := domain.Interval{Unit: domain.IntervalDay, Count: 10}
+		week := domain.Interval{Unit: domain.IntervalWeek, Count: 1}
+
+		assert.Equal(t, date(2022, time.February, 4), addInterval(date(2022, time.January, 25), tenDays, 1))
+		assert.Equal(t, date(2022, time.February, 14), addInterval(date(2022, time.January, 25), tenDays, 2))
+		assert.Equal(t, date(2022, time.March, 3), addInterval(date(2022, time.February, 24), week, 1))
+	})
+
+	t.Run("test month interval clamps to the end of the month", func(t *testing.T) {
+		month := domain.Interval{Unit: domain.IntervalMonth, Count: 1}
+
+		assert.Equal(t, date(2022, time.February, 28), addInterval(date(2022, time.January, 31), month, 1))
+		assert.Equal(t, date(2024, time.February, 29), addInterval(date(2024, time.January, 31), month, 1))
+		assert.Equal(t, date(2022, time.March, 31), addInterval(date(2022, time.January, 31), month, 2))
+		assert.Equal(t, date(2022, time.April, 30), addInterval(date(2022, time.January, 31), month, 3))
+		assert.Equal(t, date(2023, time.January, 15), addInterval(date(2022, time.December, 15), month, 1))
+	})
+
+	t.Run("test year interval on leap day", func(t *testing.T) {
+		year := domain.Interval{Unit: domain.IntervalYear, Count: 1}
+
+		assert.Equal(t, date(2025, time.February, 28), addInterval(date(2024, time.February, 29), year, 1))
+		assert.Equal(t, date(2028, time.February, 29), addInterval(date(2024, time.February, 29), year, 4))
+	})
+}
+
+func TestPeriodEndAfter(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 10, 30, 0, 0, time.UTC)
+	}
+	month := domain.Interval{Unit: domain.IntervalMonth, Count: 1}
+	anchor := date(2022, time.January, 31)
+
+	assert.Equal(t, date(2022, time.February, 28), periodEndAfter(anchor, month, anchor))
+	assert.Equal(t, date(2022, time.March, 31), periodEndAfter(anchor, month, date(2022, time.February, 28)))
+	assert.Equal(t, date(2022, time.April, 30), periodEndAfter(anchor, month, date(2022, time.April, 1)))
+	assert.Equal(t, date(2022, time.May, 31), periodEndAfter(anchor, month, date(2022, time.April, 30)))
+}
@@ -0,0 +1,296 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/dnawand/go-membershipapi/pkg/repositories"
+)
+
+type MemberService struct {
+	mr  domain.MemberRepository
+	sr  domain.SubscriptionRepository
+	ur  domain.UserRepository
+	uow domain.UnitOfWork
+}
+
+func NewMemberService(
+	mr domain.MemberRepository,
+	sr domain.SubscriptionRepository,
+	ur domain.UserRepository,
+	uow domain.UnitOfWork,
+) *MemberService {
+	return &MemberService{mr: mr, sr: sr, ur: ur, uow: uow}
+}
+
+// Invite reserves a seat of the subscription for the given email. The owner of the subscription
+// takes the first seat, so a subscription with N seats can have N-1 invited or active members.
+func (ms *MemberService) Invite(
+	ctx context.Context,
+	userID, subscriptionID, email string,
+) (domain.SubscriptionMember, error) {
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") {
+		return domain.SubscriptionMember{}, &domain.ErrInvalidArgument{Argument: "email", Msg: "email"}
+	}
+
+	var member domain.SubscriptionMember
+
+	// the subscription stays locked until the invitation is saved, so concurrent invitations
+	// can't take the same seat
+	err := ms.uow.Do(ctx, func(ctx context.Context) error {
+		subscription, err := ms.lockOwnSubscription(ctx, userID, subscriptionID)
+		if err != nil {
+			return err
+		}
+
+		if !subscription.IsActive {
+			return domain.ErrForbidden
+		}
+
+		owner, err := ms.ur.Get(ctx, userID)
+		if err != nil {
+			return domain.ErrInternal
+		}
+		if strings.EqualFold(owner.Email, email) {
+			return &domain.ErrInvalidArgument{Argument: "email", Msg: "owner can't be invited"}
+		}
+
+		members, err := ms.mr.List(ctx, subscription.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range members {
+			if m.Status != domain.MemberRemoved && strings.EqualFold(m.Email, email) {
+				return &domain.ErrInvalidArgument{Argument: "email", Msg: "email already invited"}
+			}
+		}
+
+		if takenSeats(members, "") >= subscription.Seats {
+			return domain.ErrForbidden
+		}
+
+		member, err = ms.mr.Save(ctx, domain.SubscriptionMember{
+			SubscriptionID: subscription.ID,
+			Email:          email,
+			Status:         domain.MemberInvited,
+			InviteDate:     time.Now(),
+		})
+		return err
+	})
+	if err != nil {
+		return domain.SubscriptionMember{}, domainError(err)
+	}
+
+	return member, nil
+}
+
+func (ms *MemberService) List(ctx context.Context, userID, subscriptionID string) ([]domain.SubscriptionMember, error) {
+	subscription, err := ms.fetchOwnSubscription(ctx, userID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := ms.mr.List(ctx, subscription.ID)
+	if err != nil {
+		return nil, domain.ErrInternal
+	}
+
+	return members, nil
+}
+
+func (ms *MemberService) Remove(
+	ctx context.Context,
+	userID, subscriptionID, memberID string,
+) (domain.SubscriptionMember, error) {
+	var member domain.SubscriptionMember
+
+	// the subscription stays locked while the member is removed, so an invitation being accepted
+	// meanwhile is either removed afterwards or not accepted at all
+	err := ms.uow.Do(ctx, func(ctx context.Context) error {
+		subscription, err := ms.lockOwnSubscription(ctx, userID, subscriptionID)
+		if err != nil {
+			return err
+		}
+
+		member, err = ms.mr.Get(ctx, memberID)
+		if err != nil {
+			return err
+		}
+		if member.SubscriptionID != subscription.ID {
+			return &domain.ErrDataNotFound{DataType: "member"}
+		}
+
+		if member.Status == domain.MemberRemoved {
+			return nil
+		}
+
+		now := time.Now()
+		member.Status = domain.MemberRemoved
+		member.RemoveDate = &now
+
+		toUpdate := domain.ToUpdate{
+			repositories.MemberStatus:     member.Status,
+			repositories.MemberRemoveDate: member.RemoveDate,
+		}
+
+		member, err = ms.mr.Update(ctx, member, toUpdate)
+		return err
+	})
+	if err != nil {
+		return domain.SubscriptionMember{}, domainError(err)
+	}
+
+	return member, nil
+}
+
+// Accept binds an invitation to the user it was sent to, identified by email.
+func (ms *MemberService) Accept(ctx context.Context, userID, memberID string) (domain.SubscriptionMember, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	member, err := ms.fetchMember(ctx, memberID)
+	if err != nil {
+		return domain.SubscriptionMember{}, err
+	}
+
+	user, err := ms.ur.Get(ctx, userID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.SubscriptionMember{}, err
+		}
+		return domain.SubscriptionMember{}, domain.ErrInternal
+	}
+	if !strings.EqualFold(user.Email, member.Email) {
+		return domain.SubscriptionMember{}, &domain.ErrDataNotFound{DataType: "member"}
+	}
+
+	err = ms.uow.Do(ctx, func(ctx context.Context) error {
+		subscription, err := ms.sr.GetForUpdate(ctx, member.SubscriptionID)
+		if err != nil {
+			return domain.ErrInternal
+		}
+
+		// the member is read again under the lock of its subscription, as it may have been
+		// removed or accepted meanwhile
+		member, err = ms.mr.Get(ctx, member.ID)
+		if err != nil {
+			return err
+		}
+
+		switch member.Status {
+		case domain.MemberActive:
+			return nil
+		case domain.MemberRemoved:
+			return domain.ErrForbidden
+		}
+
+		if !subscription.IsActive {
+			return domain.ErrForbidden
+		}
+
+		members, err := ms.mr.List(ctx, subscription.ID)
+		if err != nil {
+			return err
+		}
+
+		// the invitation must still fit in the seats of the subscription
+		if takenSeats(members, member.ID) >= subscription.Seats {
+			return domain.ErrForbidden
+		}
+
+		now := time.Now()
+		member.UserID = user.ID
+		member.Status = domain.MemberActive
+		member.AcceptDate = &now
+
+		toUpdate := domain.ToUpdate{
+			repositories.MemberUserID:     member.UserID,
+			repositories.MemberStatus:     member.Status,
+			repositories.MemberAcceptDate: member.AcceptDate,
+		}
+
+		member, err = ms.mr.Update(ctx, member, toUpdate)
+		return err
+	})
+	if err != nil {
+		return domain.SubscriptionMember{}, domainError(err)
+	}
+
+	return member, nil
+}
+
+// Memberships returns the active memberships of the user in subscriptions owned by others.
+func (ms *MemberService) Memberships(ctx context.Context, userID string) ([]domain.SubscriptionMember, error) {
+	members, err := ms.mr.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, domain.ErrInternal
+	}
+
+	return members, nil
+}
+
+func (ms *MemberService) fetchOwnSubscription(
+	ctx context.Context,
+	userID, subscriptionID string,
+) (domain.Subscription, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	subscription, err := ms.sr.Get(ctx, subscriptionID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.Subscription{}, err
+		}
+		return domain.Subscription{}, domain.ErrInternal
+	}
+	if subscription.UserID != userID {
+		return domain.Subscription{}, &domain.ErrDataNotFound{DataType: "subscription"}
+	}
+
+	return subscription, nil
+}
+
+func (ms *MemberService) lockOwnSubscription(
+	ctx context.Context,
+	userID, subscriptionID string,
+) (domain.Subscription, error) {
+	subscription, err := ms.sr.GetForUpdate(ctx, subscriptionID)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+	if subscription.UserID != userID {
+		return domain.Subscription{}, &domain.ErrDataNotFound{DataType: "subscription"}
+	}
+
+	return subscription, nil
+}
+
+func (ms *MemberService) fetchMember(ctx context.Context, memberID string) (domain.SubscriptionMember, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	member, err := ms.mr.Get(ctx, memberID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.SubscriptionMember{}, err
+		}
+		return domain.SubscriptionMember{}, domain.ErrInternal
+	}
+
+	return member, nil
+}
+
+// takenSeats counts the seats taken in a subscription by its owner and the members that weren't
+// removed, leaving out the member with the given ID.
+func takenSeats(members []domain.SubscriptionMember, exceptID string) int {
+	taken := 1
+	for _, m := range members {
+		if m.Status != domain.MemberRemoved && m.ID != exceptID {
+			taken++
+		}
+	}
+
+	return taken
+}
@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/dnawand/go-membershipapi/pkg/repositories"
+)
+
+var (
+	// NotificationMaxAttempts is how many times a notification is attempted before giving up.
+	NotificationMaxAttempts = 5
+	// NotificationRetryBackoff is the delay before the first retry of a notification, doubled for each next one.
+	NotificationRetryBackoff = 5 * time.Minute
+	// NotificationRetention is how long notifications are kept once sent or failed.
+	NotificationRetention = 30 * 24 * time.Hour
+)
+
+// notificationBatch is how many due notifications are sent at once.
+const notificationBatch = 100
+
+// notificationKinds are the notifications of the events users are told about.
+var notificationKinds = map[domain.EventType]domain.NotificationKind{
+	domain.EventSubscriptionCreated: domain.NotificationSubscribed,
+	domain.EventTrialEnding:         domain.NotificationTrialEnding,
+	domain.EventResumed:             domain.NotificationResumed,
+}
+
+type NotificationService struct {
+	nr       domain.NotificationRepository
+	ur       domain.UserRepository
+	sr       domain.SubscriptionRepository
+	renderer domain.NotificationRenderer
+	notifier domain.Notifier
+}
+
+func NewNotificationService(
+	nr domain.NotificationRepository,
+	ur domain.UserRepository,
+	sr domain.SubscriptionRepository,
+	renderer domain.NotificationRenderer,
+	notifier domain.Notifier,
+) *NotificationService {
+	return &NotificationService{nr: nr, ur: ur, sr: sr, renderer: renderer, notifier: notifier}
+}
+
+// Deliver queues the notification of the event for the owner of the subscription, making the service a sink
+// of the event relay. Events users are not told about are ignored, and so are deleted users. The
+// notifications are sent by Dispatch.
+func (ns *NotificationService) Deliver(ctx context.Context, event domain.Event) error {
+	kind, ok := notificationKinds[event.Type]
+	if !ok {
+		return nil
+	}
+
+	// the relay delivers an event again when another sink failed to take it
+	queued, err := ns.nr.Exists(ctx, event.ID)
+	if err != nil {
+		return err
+	}
+	if queued {
+		return nil
+	}
+
+	var dataNotFoundErr *domain.ErrDataNotFound
+	user, err := ns.ur.Get(ctx, event.UserID)
+	if errors.As(err, &dataNotFoundErr) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	subscription, err := ns.eventSubscription(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = ns.nr.Save(ctx, domain.Notification{
+		EventID:       event.ID,
+		UserID:        user.ID,
+		Kind:          kind,
+		Email:         user.Email,
+		Name:          user.Name,
+		Locale:        user.Locale,
+		Subscription:  subscription,
+		Status:        domain.DeliveryPending,
+		NextAttemptAt: &now,
+	})
+
+	return err
+}
+
+// Dispatch sends the notifications due at now, and returns how many were sent. Failed notifications are
+// retried with an exponential backoff until NotificationMaxAttempts. Notifications that can't be written
+// are not retried.
+func (ns *NotificationService) Dispatch(ctx context.Context, now time.Time) (int, error) {
+	notifications, err := ns.nr.ListDue(ctx, now, notificationBatch)
+	if err != nil {
+		return 0, domain.ErrInternal
+	}
+
+	sent := 0
+	for _, notification := range notifications {
+		message, err := ns.renderer.Render(notification)
+		rendered := err == nil
+		if rendered {
+			err = ns.notifier.Notify(ctx, message)
+		}
+
+		notification.Attempts++
+		notification.LastError = ""
+		notification.NextAttemptAt = nil
+
+		switch {
+		case err == nil:
+			notification.Status = domain.DeliverySucceeded
+			notification.SentAt = &now
+			sent++
+		case !rendered || notification.Attempts >= NotificationMaxAttempts:
+			notification.Status = domain.DeliveryFailed
+			notification.LastError = err.Error()
+		default:
+			next := now.Add(retryDelay(NotificationRetryBackoff, notification.Attempts))
+			notification.NextAttemptAt = &next
+			notification.LastError = err.Error()
+		}
+
+		toUpdate := domain.ToUpdate{
+			repositories.DeliveryStatus:        notification.Status,
+			repositories.DeliveryAttempts:      notification.Attempts,
+			repositories.DeliveryLastError:     notification.LastError,
+			repositories.DeliveryNextAttemptAt: notification.NextAttemptAt,
+			repositories.NotificationSentAt:    notification.SentAt,
+		}
+		if _, err := ns.nr.Update(ctx, notification, toUpdate); err != nil {
+			// the user was erased meanwhile, along with its notifications
+			var dataNotFoundErr *domain.ErrDataNotFound
+			if errors.As(err, &dataNotFoundErr) {
+				continue
+			}
+			return sent, domain.ErrInternal
+		}
+	}
+
+	return sent, nil
+}
+
+// Purge deletes the notifications sent or failed more than NotificationRetention before now, returning how
+// many were deleted.
+func (ns *NotificationService) Purge(ctx context.Context, now time.Time) (int64, error) {
+	return ns.nr.DeleteFinished(ctx, now.Add(-NotificationRetention))
+}
+
+// eventSubscription returns the subscription of the event, with the product it is to, which events of
+// changes made without loading the product lack.
+func (ns *NotificationService) eventSubscription(ctx context.Context, event domain.Event) (json.RawMessage, error) {
+	var subscription domain.Subscription
+
+	if err := json.Unmarshal(event.Data, &subscription); err != nil {
+		return nil, fmt.Errorf("could not decode subscription of event: %w", err)
+	}
+	if subscription.Product.Name != "" {
+		return event.Data, nil
+	}
+
+	current, err := ns.sr.Get(ctx, event.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	subscription.Product = current.Product
+
+	return json.Marshal(subscription)
+}
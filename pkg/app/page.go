@@ -0,0 +1,35 @@
+package app
+
+import "github.com/dnawand/go-membershipapi/pkg/domain"
+
+// validatePage checks the page of a list requested by a caller, defaulting its limit.
+func validatePage(page domain.Page) (domain.Page, error) {
+	if page.Limit == 0 {
+		page.Limit = domain.DefaultPageLimit
+	}
+	if page.Limit < 0 || page.Limit > domain.MaxPageLimit {
+		return domain.Page{}, &domain.ErrInvalidArgument{Argument: "limit", Msg: "limit"}
+	}
+
+	return page, nil
+}
+
+// validateIntervalFilter checks the plan length lists are filtered by, a zero count matching any.
+func validateIntervalFilter(interval domain.Interval) error {
+	if interval == (domain.Interval{}) {
+		return nil
+	}
+	if interval.Count < 0 || !(domain.Interval{Unit: interval.Unit, Count: 1}).IsValid() {
+		return &domain.ErrInvalidArgument{Argument: "interval", Msg: "interval"}
+	}
+
+	return nil
+}
+
+func validateSubscriptionFilter(filter domain.SubscriptionFilter) error {
+	if filter.Status != "" && !filter.Status.IsValid() {
+		return &domain.ErrInvalidArgument{Argument: "status", Msg: "status"}
+	}
+
+	return validateIntervalFilter(filter.Interval)
+}
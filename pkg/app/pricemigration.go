@@ -0,0 +1,370 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/dnawand/go-membershipapi/internal/storage"
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/dnawand/go-membershipapi/pkg/repositories"
+)
+
+type PriceMigrationService struct {
+	pmr            domain.PriceMigrationRepository
+	sr             domain.SubscriptionRepository
+	pr             domain.ProductRepository
+	voucherStorage *storage.Store
+	ds             domain.DiscountService
+	uow            domain.UnitOfWork
+}
+
+func NewPriceMigrationService(
+	pmr domain.PriceMigrationRepository,
+	sr domain.SubscriptionRepository,
+	pr domain.ProductRepository,
+	vs *storage.Store,
+	ds domain.DiscountService,
+	uow domain.UnitOfWork,
+) *PriceMigrationService {
+	return &PriceMigrationService{pmr: pmr, sr: sr, pr: pr, voucherStorage: vs, ds: ds, uow: uow}
+}
+
+func (pms *PriceMigrationService) Schedule(
+	ctx context.Context,
+	migration domain.PriceMigration,
+) (domain.PriceMigration, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	if migration.NoticeDays < 0 {
+		return domain.PriceMigration{}, &domain.ErrInvalidArgument{Argument: "noticeDays", Msg: "noticeDays"}
+	}
+
+	noticeEnd := time.Now().AddDate(0, 0, migration.NoticeDays)
+	if migration.EffectiveDate.Before(noticeEnd) {
+		return domain.PriceMigration{}, &domain.ErrInvalidArgument{
+			Argument: "effectiveDate",
+			Msg:      "effective date must respect the notice period",
+		}
+	}
+
+	plan, err := pms.pr.GetPlan(ctx, migration.ProductID, migration.ProductPlanID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.PriceMigration{}, err
+		}
+		return domain.PriceMigration{}, domain.ErrInternal
+	}
+
+	if migration.TargetTax == (domain.Money{}) {
+		migration.TargetTax = plan.Tax
+	}
+	if _, err := currency.NewAmount(migration.TargetPrice.Number, string(migration.TargetPrice.Code)); err != nil {
+		return domain.PriceMigration{}, &domain.ErrInvalidArgument{Argument: "targetPrice", Msg: "targetPrice"}
+	}
+	if _, err := currency.NewAmount(migration.TargetTax.Number, string(migration.TargetTax.Code)); err != nil {
+		return domain.PriceMigration{}, &domain.ErrInvalidArgument{Argument: "targetTax", Msg: "targetTax"}
+	}
+
+	// subscriptions are charged in the currency of their plan
+	if migration.TargetPrice.Code != plan.Price.Code {
+		return domain.PriceMigration{}, &domain.ErrInvalidArgument{
+			Argument: "targetPrice",
+			Msg:      "currency must be the one of the plan",
+		}
+	}
+	if migration.TargetTax.Code != plan.Price.Code {
+		return domain.PriceMigration{}, &domain.ErrInvalidArgument{
+			Argument: "targetTax",
+			Msg:      "currency must be the one of the plan",
+		}
+	}
+
+	migration.IsCanceled = false
+
+	migration, err = pms.pmr.Save(ctx, migration)
+	if err != nil {
+		return domain.PriceMigration{}, domain.ErrInternal
+	}
+
+	return migration, nil
+}
+
+func (pms *PriceMigrationService) Fetch(ctx context.Context, migrationID string) (domain.PriceMigration, error) {
+	return pms.pmr.Get(ctx, migrationID)
+}
+
+func (pms *PriceMigrationService) Preview(
+	ctx context.Context,
+	migrationID string,
+) ([]domain.MigrationCandidate, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	migration, err := pms.pmr.Get(ctx, migrationID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return nil, err
+		}
+		return nil, domain.ErrInternal
+	}
+
+	subscriptions, err := pms.sr.ListByProductPlan(ctx, migration.ProductPlanID)
+	if err != nil {
+		return nil, domain.ErrInternal
+	}
+
+	candidates := make([]domain.MigrationCandidate, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		candidate, ok, err := pms.candidate(ctx, migration, subscription)
+		if err != nil {
+			return nil, domainError(err)
+		}
+		if ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	return candidates, nil
+}
+
+// Cancel stops a migration from being applied. A complete migration can't be canceled anymore.
+func (pms *PriceMigrationService) Cancel(ctx context.Context, migrationID string) (domain.PriceMigration, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	migration, err := pms.pmr.Get(ctx, migrationID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.PriceMigration{}, err
+		}
+		return domain.PriceMigration{}, domain.ErrInternal
+	}
+
+	if migration.IsCanceled {
+		return migration, nil
+	}
+	if migration.CompleteDate != nil {
+		return domain.PriceMigration{}, domain.ErrForbidden
+	}
+
+	migration.IsCanceled = true
+
+	toUpdate := domain.ToUpdate{
+		repositories.IsCanceled: migration.IsCanceled,
+	}
+
+	migration, err = pms.pmr.Update(ctx, migration, toUpdate)
+	if err != nil {
+		if !errors.As(err, &dataNotFoundErr) {
+			return domain.PriceMigration{}, domain.ErrInternal
+		}
+
+		// the migration was canceled or completed meanwhile
+		migration, err = pms.pmr.Get(ctx, migrationID)
+		if err != nil {
+			return domain.PriceMigration{}, domain.ErrInternal
+		}
+		if !migration.IsCanceled {
+			return domain.PriceMigration{}, domain.ErrForbidden
+		}
+	}
+
+	return migration, nil
+}
+
+// Apply sets the target price on every subscription whose migration date is not after now.
+// It is meant to be run periodically and is safe to run again, migrated subscriptions are skipped and
+// migrations are completed once no subscription is left to migrate. The latest migrations are applied
+// first, so subscriptions behind several migrations move straight to the latest price.
+func (pms *PriceMigrationService) Apply(ctx context.Context, now time.Time) (migrated int, err error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	migrations, err := pms.pmr.ListDue(ctx, now)
+	if err != nil {
+		return 0, domain.ErrInternal
+	}
+
+	for _, migration := range migrations {
+		subscriptions, err := pms.sr.ListByProductPlan(ctx, migration.ProductPlanID)
+		if err != nil {
+			return migrated, domain.ErrInternal
+		}
+
+		pending := 0
+		for _, subscription := range subscriptions {
+			var isPending, isMigrated bool
+
+			err := pms.uow.Do(ctx, func(ctx context.Context) error {
+				subscription, err := pms.sr.GetForUpdate(ctx, subscription.ID)
+				if err != nil {
+					return err
+				}
+				if !subscription.IsActive {
+					return nil
+				}
+
+				candidate, ok, err := pms.candidate(ctx, migration, subscription)
+				if err != nil || !ok {
+					return err
+				}
+				if candidate.IsGrandfathered || candidate.IsMigrated {
+					return nil
+				}
+				if candidate.MigrationDate == nil || candidate.MigrationDate.After(now) {
+					isPending = true
+					return nil
+				}
+
+				toUpdate := domain.ToUpdate{
+					repositories.Price:            candidate.TargetPrice,
+					repositories.Tax:              candidate.TargetTax,
+					repositories.PriceMigrationID: migration.ID,
+				}
+
+				_, err = pms.sr.UpdatePlan(ctx, subscription.SubscriptionPlan, toUpdate)
+				isMigrated = err == nil
+				return err
+			})
+			if err != nil {
+				return migrated, domainError(err)
+			}
+
+			if isPending {
+				pending++
+			}
+			if isMigrated {
+				migrated++
+			}
+		}
+
+		if pending > 0 {
+			continue
+		}
+
+		completeDate := now
+		migration.CompleteDate = &completeDate
+
+		toUpdate := domain.ToUpdate{
+			repositories.CompleteDate: migration.CompleteDate,
+		}
+
+		// a migration canceled meanwhile is left canceled
+		if _, err := pms.pmr.Update(ctx, migration, toUpdate); err != nil && !errors.As(err, &dataNotFoundErr) {
+			return migrated, domain.ErrInternal
+		}
+	}
+
+	return migrated, nil
+}
+
+// candidate tells how the migration affects the subscription, or false when the subscription started after
+// the effective date and the migration doesn't move it.
+func (pms *PriceMigrationService) candidate(
+	ctx context.Context,
+	migration domain.PriceMigration,
+	subscription domain.Subscription,
+) (domain.MigrationCandidate, bool, error) {
+	if subscription.StartDate.After(migration.EffectiveDate) {
+		return domain.MigrationCandidate{}, false, nil
+	}
+
+	isMigrated, err := pms.isMigrated(ctx, migration, subscription)
+	if err != nil {
+		return domain.MigrationCandidate{}, false, err
+	}
+
+	voucher := domain.Voucher{Type: domain.VoucherFixedAmount}
+	if subscription.SubscriptionPlan.Voucher != nil {
+		voucher = *subscription.SubscriptionPlan.Voucher
+	}
+
+	// group subscriptions keep paying their extra seats on top of the new price
+	target := domain.Plan{Price: migration.TargetPrice}
+	if subscription.SubscriptionPlan.Plan != nil {
+		target.SeatPrice = subscription.SubscriptionPlan.SeatPrice
+	}
+	basePrice, err := seatsPrice(target, subscription.Seats)
+	if err != nil {
+		return domain.MigrationCandidate{}, false, err
+	}
+
+	price, err := pms.ds.ApplyDiscountOnPrice(basePrice, voucher)
+	if err != nil {
+		return domain.MigrationCandidate{}, false, err
+	}
+	tax, err := pms.ds.ApplyDiscountOnTax(basePrice, migration.TargetTax, voucher)
+	if err != nil {
+		return domain.MigrationCandidate{}, false, err
+	}
+
+	candidate := domain.MigrationCandidate{
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		CurrentPrice:   subscription.SubscriptionPlan.Price,
+		TargetPrice:    price,
+		TargetTax:      tax,
+		IsMigrated:     isMigrated,
+	}
+
+	if migration.GrandfatheredUntil != nil && !subscription.StartDate.After(*migration.GrandfatheredUntil) {
+		candidate.IsGrandfathered = true
+		return candidate, true, nil
+	}
+
+	if renewal, ok := nextRenewal(subscription, migration.EffectiveDate); ok {
+		candidate.MigrationDate = &renewal
+	}
+
+	return candidate, true, nil
+}
+
+// isMigrated tells whether the subscription pays the price of the migration, or of a later one on the same plan.
+func (pms *PriceMigrationService) isMigrated(
+	ctx context.Context,
+	migration domain.PriceMigration,
+	subscription domain.Subscription,
+) (bool, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	migrationID := subscription.SubscriptionPlan.PriceMigrationID
+	if migrationID == "" {
+		return false, nil
+	}
+	if migrationID == migration.ID {
+		return true, nil
+	}
+
+	applied, err := pms.pmr.Get(ctx, migrationID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if applied.EffectiveDate.Equal(migration.EffectiveDate) {
+		return applied.CreatedAt.After(migration.CreatedAt), nil
+	}
+
+	return applied.EffectiveDate.After(migration.EffectiveDate), nil
+}
+
+// nextRenewal returns the first renewal of the subscription not before the given date. Renewals are counted
+// from the renewal anchor, so the date doesn't move as the subscription is renewed, and the end of the trial
+// is not one. Paused subscriptions have no renewal until they are resumed.
+func nextRenewal(subscription domain.Subscription, from time.Time) (time.Time, bool) {
+	if subscription.EndDate == nil || subscription.SubscriptionPlan.Plan == nil {
+		return time.Time{}, false
+	}
+	if !subscription.SubscriptionPlan.Interval.IsValid() {
+		return time.Time{}, false
+	}
+
+	anchor := renewalAnchor(subscription)
+	renewal := anchor
+	for n := 1; renewal.Before(from) || !renewal.After(subscription.TrialDate); n++ {
+		renewal = addInterval(anchor, subscription.SubscriptionPlan.Interval, n)
+	}
+
+	return renewal, true
+}
@@ -1,27 +1,495 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bojanz/currency"
 	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/dnawand/go-membershipapi/pkg/repositories"
 )
 
 type ProductService struct {
-	pr domain.ProductRepository
+	pr  domain.ProductRepository
+	uow domain.UnitOfWork
 }
 
-func NewProductService(pr domain.ProductRepository) *ProductService {
+func NewProductService(pr domain.ProductRepository, uow domain.UnitOfWork) *ProductService {
 	return &ProductService{
-		pr: pr,
+		pr:  pr,
+		uow: uow,
+	}
+}
+
+func (ps *ProductService) Create(ctx context.Context, product domain.Product) (domain.Product, error) {
+	for _, plan := range product.ProductPlans {
+		if plan.Plan == nil {
+			return domain.Product{}, &domain.ErrInvalidArgument{Msg: "plan is required"}
+		}
+		if err := validatePlan(*plan.Plan); err != nil {
+			return domain.Product{}, err
+		}
+	}
+	for _, addOn := range product.AddOns {
+		if err := validateAddOn(addOn); err != nil {
+			return domain.Product{}, err
+		}
+	}
+	for _, entitlement := range product.Entitlements {
+		if err := validateEntitlement(entitlement); err != nil {
+			return domain.Product{}, err
+		}
+	}
+	if err := validateCurrency(product); err != nil {
+		return domain.Product{}, err
+	}
+	for i, bundled := range product.Bundle {
+		p, err := ps.fetchProduct(ctx, bundled.ID)
+		if err != nil {
+			return domain.Product{}, err
+		}
+		if len(p.Bundle) > 0 {
+			return domain.Product{}, &domain.ErrInvalidArgument{Argument: "bundle", Msg: "bundles can't be nested"}
+		}
+		if p.IsArchived {
+			return domain.Product{}, &domain.ErrInvalidArgument{Argument: "bundle", Msg: "archived products can't be bundled"}
+		}
+		product.Bundle[i] = p
+	}
+
+	return ps.pr.Save(ctx, product)
+}
+
+func (ps *ProductService) Fetch(ctx context.Context, productID string) (domain.Product, error) {
+	return ps.pr.Get(ctx, productID)
+}
+
+func (ps *ProductService) List(
+	ctx context.Context,
+	filter domain.ProductFilter,
+	page domain.Page,
+) ([]domain.Product, string, error) {
+	page, err := validatePage(page)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := validateIntervalFilter(filter.Interval); err != nil {
+		return nil, "", err
+	}
+
+	return ps.pr.List(ctx, filter, page)
+}
+
+func (ps *ProductService) Update(ctx context.Context, productID, name string, version int) (domain.Product, error) {
+	if name == "" {
+		return domain.Product{}, &domain.ErrInvalidArgument{Argument: "name", Msg: "name"}
+	}
+
+	product, err := ps.fetchProduct(ctx, productID)
+	if err != nil {
+		return domain.Product{}, err
+	}
+
+	if err := checkVersion(product.Version, version); err != nil {
+		return domain.Product{}, err
+	}
+
+	if product.Name == name {
+		return product, nil
+	}
+
+	product.Name = name
+
+	toUpdate := domain.ToUpdate{
+		repositories.Name: product.Name,
+	}
+
+	product, err = ps.pr.Update(ctx, product, toUpdate)
+	if err != nil {
+		return domain.Product{}, domainError(err)
+	}
+
+	return product, nil
+}
+
+// Archive stops offering the product: it is no longer listed nor subscribed, while its subscriptions
+// keep being renewed.
+func (ps *ProductService) Archive(ctx context.Context, productID string, version int) (domain.Product, error) {
+	product, err := ps.fetchProduct(ctx, productID)
+	if err != nil {
+		return domain.Product{}, err
+	}
+
+	if err := checkVersion(product.Version, version); err != nil {
+		return domain.Product{}, err
+	}
+
+	if product.IsArchived {
+		return product, nil
+	}
+
+	now := time.Now()
+	product.IsArchived = true
+	product.ArchiveDate = &now
+
+	toUpdate := domain.ToUpdate{
+		repositories.IsArchived:  product.IsArchived,
+		repositories.ArchiveDate: product.ArchiveDate,
+	}
+
+	product, err = ps.pr.Update(ctx, product, toUpdate)
+	if err != nil {
+		return domain.Product{}, domainError(err)
+	}
+
+	return product, nil
+}
+
+func (ps *ProductService) AddPlan(
+	ctx context.Context,
+	productID string,
+	plan domain.ProductPlan,
+	version int,
+) (domain.ProductPlan, error) {
+	if plan.Plan == nil {
+		return domain.ProductPlan{}, &domain.ErrInvalidArgument{Msg: "plan is required"}
+	}
+	if err := validatePlan(*plan.Plan); err != nil {
+		return domain.ProductPlan{}, err
+	}
+
+	err := ps.change(ctx, productID, version, func(ctx context.Context, product domain.Product) (bool, error) {
+		var err error
+
+		if code, ok := productCurrency(product); ok && plan.Price.Code != code {
+			return false, &domain.ErrInvalidArgument{Argument: "price", Msg: "price must be in the currency of the product"}
+		}
+
+		plan.ProductID = product.ID
+
+		plan, err = ps.pr.SavePlan(ctx, plan)
+		return true, err
+	})
+	if err != nil {
+		return domain.ProductPlan{}, domainError(err)
+	}
+
+	return plan, nil
+}
+
+// UpdatePlan creates a new version of the plan with the given terms, retiring the current one.
+// Zero values in the given plan keep the terms of the current version.
+func (ps *ProductService) UpdatePlan(
+	ctx context.Context,
+	productID, planID string,
+	plan domain.Plan,
+	version int,
+) (nextPlan domain.ProductPlan, err error) {
+	err = ps.change(ctx, productID, version, func(ctx context.Context, product domain.Product) (bool, error) {
+		if code, ok := productCurrency(product); ok && plan.Price.Code != "" && plan.Price.Code != code {
+			return false, &domain.ErrInvalidArgument{Argument: "price", Msg: "price must be in the currency of the product"}
+		}
+
+		current, err := ps.fetchPlan(ctx, productID, planID)
+		if err != nil {
+			return false, err
+		}
+
+		nextPlan, err = ps.nextPlanVersion(ctx, current, plan)
+		if err != nil {
+			return false, err
+		}
+
+		return nextPlan.ID != current.ID, nil
+	})
+	if err != nil {
+		return domain.ProductPlan{}, domainError(err)
+	}
+
+	return nextPlan, nil
+}
+
+// nextPlanVersion saves the version of the current plan with the terms of plan, or returns the current
+// one if the terms are the same.
+func (ps *ProductService) nextPlanVersion(
+	ctx context.Context,
+	current domain.ProductPlan,
+	plan domain.Plan,
+) (domain.ProductPlan, error) {
+	if current.IsRetired {
+		return domain.ProductPlan{}, domain.ErrForbidden
+	}
+
+	next := *current.Plan
+	if plan.Interval != (domain.Interval{}) {
+		next.Interval = plan.Interval
+	}
+	if plan.Price != (domain.Money{}) {
+		next.Price = plan.Price
+	}
+	if plan.Tax != (domain.Money{}) {
+		next.Tax = plan.Tax
+	}
+	if plan.MaxSeats != 0 {
+		next.MaxSeats = plan.MaxSeats
+	}
+	if plan.SeatPrice != nil {
+		next.SeatPrice = plan.SeatPrice
+	}
+
+	if err := validatePlan(next); err != nil {
+		return domain.ProductPlan{}, err
 	}
+
+	if next.Interval == current.Interval &&
+		next.Price == current.Price &&
+		next.Tax == current.Tax &&
+		next.MaxSeats == current.MaxSeats &&
+		sameMoney(next.SeatPrice, current.SeatPrice) {
+		return current, nil
+	}
+
+	nextPlan, err := ps.pr.SavePlanVersion(ctx, current, domain.ProductPlan{Plan: &next})
+	if err != nil {
+		return domain.ProductPlan{}, domain.ErrInternal
+	}
+
+	return nextPlan, nil
+}
+
+func (ps *ProductService) RetirePlan(
+	ctx context.Context,
+	productID, planID string,
+	version int,
+) (plan domain.ProductPlan, err error) {
+	err = ps.change(ctx, productID, version, func(ctx context.Context, _ domain.Product) (bool, error) {
+		var err error
+
+		plan, err = ps.fetchPlan(ctx, productID, planID)
+		if err != nil || plan.IsRetired {
+			return false, err
+		}
+
+		plan, err = ps.pr.RetirePlan(ctx, plan)
+		return true, err
+	})
+	if err != nil {
+		return domain.ProductPlan{}, domainError(err)
+	}
+
+	return plan, nil
+}
+
+func (ps *ProductService) AddAddOn(
+	ctx context.Context,
+	productID string,
+	addOn domain.AddOn,
+	version int,
+) (domain.AddOn, error) {
+	if err := validateAddOn(addOn); err != nil {
+		return domain.AddOn{}, err
+	}
+
+	err := ps.change(ctx, productID, version, func(ctx context.Context, product domain.Product) (bool, error) {
+		var err error
+
+		for _, a := range product.AddOns {
+			if a.Key == addOn.Key {
+				return false, &domain.ErrInvalidArgument{Argument: "key", Msg: "add-on key already in use"}
+			}
+		}
+		if code, ok := productCurrency(product); ok && addOn.UnitPrice.Code != code {
+			return false, &domain.ErrInvalidArgument{
+				Argument: "unitPrice",
+				Msg:      "unit price must be in the currency of the product",
+			}
+		}
+
+		addOn.ProductID = product.ID
+
+		addOn, err = ps.pr.SaveAddOn(ctx, addOn)
+		return true, err
+	})
+	if err != nil {
+		return domain.AddOn{}, domainError(err)
+	}
+
+	return addOn, nil
+}
+
+func (ps *ProductService) AddEntitlement(
+	ctx context.Context,
+	productID string,
+	entitlement domain.Entitlement,
+	version int,
+) (domain.Entitlement, error) {
+	if err := validateEntitlement(entitlement); err != nil {
+		return domain.Entitlement{}, err
+	}
+
+	err := ps.change(ctx, productID, version, func(ctx context.Context, product domain.Product) (bool, error) {
+		var err error
+
+		for _, e := range product.Entitlements {
+			if e.Key == entitlement.Key {
+				return false, &domain.ErrInvalidArgument{Argument: "key", Msg: "entitlement key already in use"}
+			}
+		}
+
+		entitlement.ProductID = product.ID
+
+		entitlement, err = ps.pr.SaveEntitlement(ctx, entitlement)
+		return true, err
+	})
+	if err != nil {
+		return domain.Entitlement{}, domainError(err)
+	}
+
+	return entitlement, nil
+}
+
+// change runs fn on the product in a unit of work. When fn reports a change of the plans, add-ons or
+// entitlements of the product, the version of the product is incremented with it. A non zero version
+// must match the current one of the product.
+func (ps *ProductService) change(
+	ctx context.Context,
+	productID string,
+	version int,
+	fn func(ctx context.Context, product domain.Product) (changed bool, err error),
+) error {
+	return ps.uow.Do(ctx, func(ctx context.Context) error {
+		product, err := ps.fetchProduct(ctx, productID)
+		if err != nil {
+			return err
+		}
+
+		if err := checkVersion(product.Version, version); err != nil {
+			return err
+		}
+
+		changed, err := fn(ctx, product)
+		if err != nil || !changed {
+			return err
+		}
+
+		_, err = ps.pr.Update(ctx, product, domain.ToUpdate{})
+		return err
+	})
+}
+
+func (ps *ProductService) fetchProduct(ctx context.Context, productID string) (domain.Product, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	product, err := ps.pr.Get(ctx, productID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.Product{}, err
+		}
+		return domain.Product{}, domain.ErrInternal
+	}
+
+	return product, nil
+}
+
+func (ps *ProductService) fetchPlan(ctx context.Context, productID, planID string) (domain.ProductPlan, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	plan, err := ps.pr.GetPlan(ctx, productID, planID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.ProductPlan{}, err
+		}
+		return domain.ProductPlan{}, domain.ErrInternal
+	}
+
+	return plan, nil
+}
+
+func validatePlan(plan domain.Plan) error {
+	if !plan.Interval.IsValid() {
+		return &domain.ErrInvalidArgument{Argument: "interval", Msg: "interval"}
+	}
+	if _, err := currency.NewAmount(plan.Price.Number, string(plan.Price.Code)); err != nil {
+		return &domain.ErrInvalidArgument{Argument: "price", Msg: "price"}
+	}
+	if _, err := currency.NewAmount(plan.Tax.Number, string(plan.Tax.Code)); err != nil {
+		return &domain.ErrInvalidArgument{Argument: "tax", Msg: "tax"}
+	}
+	if plan.MaxSeats < 0 {
+		return &domain.ErrInvalidArgument{Argument: "maxSeats", Msg: "maxSeats"}
+	}
+	if plan.SeatPrice != nil {
+		if _, err := currency.NewAmount(plan.SeatPrice.Number, string(plan.SeatPrice.Code)); err != nil {
+			return &domain.ErrInvalidArgument{Argument: "seatPrice", Msg: "seatPrice"}
+		}
+	}
+
+	return nil
+}
+
+func sameMoney(a, b *domain.Money) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
 }
 
-func (ps *ProductService) Create(product domain.Product) (domain.Product, error) {
-	return ps.pr.Save(product)
+func validateAddOn(addOn domain.AddOn) error {
+	if addOn.Key == "" {
+		return &domain.ErrInvalidArgument{Argument: "key", Msg: "key"}
+	}
+	if _, err := currency.NewAmount(addOn.UnitPrice.Number, string(addOn.UnitPrice.Code)); err != nil {
+		return &domain.ErrInvalidArgument{Argument: "unitPrice", Msg: "unitPrice"}
+	}
+
+	return nil
+}
+
+// validateCurrency checks that the plans and add-ons of a new product are priced in the same currency, as
+// the usage of add-ons is totaled in the currency of the subscribed plan.
+func validateCurrency(product domain.Product) error {
+	code, ok := productCurrency(product)
+	if !ok {
+		return nil
+	}
+
+	for _, plan := range product.ProductPlans {
+		if plan.Price.Code != code {
+			return &domain.ErrInvalidArgument{Argument: "price", Msg: "plans and add-ons must have the same currency"}
+		}
+	}
+	for _, addOn := range product.AddOns {
+		if addOn.UnitPrice.Code != code {
+			return &domain.ErrInvalidArgument{Argument: "unitPrice", Msg: "plans and add-ons must have the same currency"}
+		}
+	}
+
+	return nil
 }
 
-func (ps *ProductService) Fetch(productID string) (domain.Product, error) {
-	return ps.pr.Get(productID)
+// productCurrency returns the currency the product is priced in, the one of its first plan or add-on.
+func productCurrency(product domain.Product) (domain.CurrencyCode, bool) {
+	for _, plan := range product.ProductPlans {
+		if plan.Plan != nil {
+			return plan.Price.Code, true
+		}
+	}
+	for _, addOn := range product.AddOns {
+		return addOn.UnitPrice.Code, true
+	}
+
+	return "", false
 }
 
-func (ps *ProductService) List() ([]domain.Product, error) {
-	return ps.pr.List()
+func validateEntitlement(entitlement domain.Entitlement) error {
+	if entitlement.Key == "" {
+		return &domain.ErrInvalidArgument{Argument: "key", Msg: "key"}
+	}
+	if entitlement.Limit != nil && *entitlement.Limit < 0 {
+		return &domain.ErrInvalidArgument{Argument: "limit", Msg: "limit"}
+	}
+
+	return nil
 }
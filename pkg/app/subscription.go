@@ -1,16 +1,24 @@
 package app
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bojanz/currency"
 	"github.com/dnawand/go-membershipapi/internal/storage"
 	"github.com/dnawand/go-membershipapi/pkg/domain"
 	"github.com/dnawand/go-membershipapi/pkg/repositories"
 )
 
-const TrialPeriod = 1
+var TrialPeriod = domain.Interval{Unit: domain.IntervalMonth, Count: 1}
+
+// TrialEndingNotice is how long before the end of a trial the TrialEnding event is recorded.
+var TrialEndingNotice = 3 * 24 * time.Hour
 
 type SubscriptionService struct {
 	sr             domain.SubscriptionRepository
@@ -18,6 +26,7 @@ type SubscriptionService struct {
 	pr             domain.ProductRepository
 	voucherStorage *storage.Store
 	ds             domain.DiscountService
+	uow            domain.UnitOfWork
 }
 
 func NewSubscriptionService(
@@ -26,197 +35,403 @@ func NewSubscriptionService(
 	pr domain.ProductRepository,
 	vs *storage.Store,
 	ds domain.DiscountService,
+	uow domain.UnitOfWork,
 ) *SubscriptionService {
-	return &SubscriptionService{sr: sr, ur: ur, pr: pr, voucherStorage: vs, ds: ds}
+	return &SubscriptionService{sr: sr, ur: ur, pr: pr, voucherStorage: vs, ds: ds, uow: uow}
 }
 
 func (ss *SubscriptionService) Subscribe(
+	ctx context.Context,
 	userID, productID, productPlanID string,
 	voucherID string,
-) (subscription domain.Subscription, err error) {
-	subscription, err = ss.buildSubscription(userID, productID, productPlanID, voucherID)
-	if err != nil {
-		return domain.Subscription{}, err
+	seats int,
+) (subscription domain.Subscription, created bool, err error) {
+	voucher := domain.Voucher{Type: domain.VoucherFixedAmount}
+
+	if seats == 0 {
+		seats = 1
 	}
-	if subscription.ID != "" {
-		return subscription, nil
+	if seats < 0 {
+		return domain.Subscription{}, false, &domain.ErrInvalidArgument{Argument: "seats", Msg: "seats"}
 	}
 
-	user := domain.User{
-		ID:            userID,
-		Subscriptions: []domain.Subscription{subscription},
+	if voucherID != "" {
+		v, ok := ss.validateVoucher(voucherID)
+		if !ok {
+			return domain.Subscription{}, false, &domain.ErrInvalidArgument{Msg: "voucher"}
+		}
+		voucher = v
 	}
 
-	subscription, err = ss.sr.Save(user)
+	err = ss.uow.Do(ctx, func(ctx context.Context) error {
+		created = false
+
+		// locking the user serializes its subscriptions, so that a product is subscribed only once
+		user, err := ss.ur.GetForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		if subscription, ok = getActiveSubscription(user, productID); ok {
+			return nil
+		}
+
+		// a subscription won back is reported as created, the user was not subscribed before the request
+		if subscription, ok = getWinBackSubscription(user, productID, productPlanID, voucherID, seats); ok {
+			subscription, err = ss.reactivate(ctx, subscription)
+			created = err == nil
+			return err
+		}
+
+		subscription, err = ss.buildSubscription(ctx, productID, productPlanID, voucher, seats)
+		if err != nil {
+			return err
+		}
+
+		user = domain.User{
+			ID:            userID,
+			Subscriptions: []domain.Subscription{subscription},
+		}
+		events := []domain.Event{{Type: domain.EventSubscriptionCreated}}
+		if voucher.ID != "" {
+			events = append(events, domain.Event{Type: domain.EventVoucherRedeemed})
+		}
+
+		subscription, err = ss.sr.Save(ctx, user, events...)
+		if err != nil {
+			return err
+		}
+
+		subscription, err = ss.sr.Get(ctx, subscription.ID)
+		created = err == nil
+		return err
+	})
 	if err != nil {
-		return domain.Subscription{}, domain.ErrInternal
+		return domain.Subscription{}, false, domainError(err)
 	}
 
-	subscription, err = ss.sr.Get(subscription.ID)
+	return subscription, created, nil
+}
+
+func (ss *SubscriptionService) Fetch(ctx context.Context, userID, subscriptionID string) (domain.Subscription, error) {
+	return ss.fetchOwnSubscription(ctx, userID, subscriptionID)
+}
+
+func (ss *SubscriptionService) List(
+	ctx context.Context,
+	userID string,
+	filter domain.SubscriptionFilter,
+	page domain.Page,
+) ([]domain.Subscription, string, error) {
+	page, err := validatePage(page)
 	if err != nil {
-		return domain.Subscription{}, domain.ErrInternal
+		return nil, "", err
+	}
+	if err := validateSubscriptionFilter(filter); err != nil {
+		return nil, "", err
 	}
 
-	return subscription, nil
-}
+	filter.UserID = userID
 
-func (ss *SubscriptionService) Fetch(userID, subscriptionID string) (domain.Subscription, error) {
-	return ss.sr.Get(subscriptionID)
+	return ss.sr.List(ctx, filter, page)
 }
 
-func (ss *SubscriptionService) List(userID string) ([]domain.Subscription, error) {
-	return ss.sr.List(userID)
+// Search lists the subscriptions of every user matching the filter, for the staff.
+func (ss *SubscriptionService) Search(
+	ctx context.Context,
+	filter domain.SubscriptionFilter,
+	page domain.Page,
+) ([]domain.Subscription, string, error) {
+	page, err := validatePage(page)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := validateSubscriptionFilter(filter); err != nil {
+		return nil, "", err
+	}
+
+	filter.UserEmail = strings.TrimSpace(filter.UserEmail)
+
+	return ss.sr.List(ctx, filter, page)
 }
 
-func (ss *SubscriptionService) Pause(userID, subscriptionID string) (domain.Subscription, error) {
-	var dataNotFoundErr *domain.ErrDataNotFound
+func (ss *SubscriptionService) Pause(
+	ctx context.Context,
+	userID, subscriptionID string,
+	version int,
+) (domain.Subscription, error) {
+	var subscription domain.Subscription
 
-	subscription, err := ss.sr.Get(subscriptionID)
-	if err != nil {
-		if errors.As(err, &dataNotFoundErr) {
-			return domain.Subscription{}, err
+	err := ss.uow.Do(ctx, func(ctx context.Context) error {
+		var err error
+
+		subscription, err = ss.lockOwnSubscription(ctx, userID, subscriptionID)
+		if err != nil {
+			return err
 		}
-		return domain.Subscription{}, domain.ErrInternal
-	}
 
-	if !subscription.IsActive {
-		return domain.Subscription{}, domain.ErrForbidden
-	}
+		if err := checkVersion(subscription.Version, version); err != nil {
+			return err
+		}
 
-	if subscription.IsPaused {
-		return subscription, nil
-	}
+		if !subscription.IsActive {
+			return domain.ErrForbidden
+		}
 
-	if onTrial(subscription.TrialDate) {
-		return domain.Subscription{}, domain.ErrForbidden
-	}
+		if subscription.IsPaused {
+			return nil
+		}
 
-	now := time.Now()
-	subscription.PauseDate = &now
-	subscription.EndDate = nil
-	subscription.IsPaused = true
+		if onTrial(subscription.TrialDate) {
+			return domain.ErrForbidden
+		}
 
-	toUpdate := domain.ToUpdate{
-		repositories.PauseDate: subscription.PauseDate,
-		repositories.EndDate:   subscription.EndDate,
-		repositories.IsPaused:  subscription.IsPaused,
-	}
+		now := time.Now()
+		subscription.PauseDate = &now
+		subscription.PausedEndDate = subscription.EndDate
+		subscription.EndDate = nil
+		subscription.IsPaused = true
+
+		toUpdate := domain.ToUpdate{
+			repositories.PauseDate:     subscription.PauseDate,
+			repositories.PausedEndDate: subscription.PausedEndDate,
+			repositories.EndDate:       subscription.EndDate,
+			repositories.IsPaused:      subscription.IsPaused,
+		}
 
-	subscription, err = ss.sr.Update(subscription, toUpdate)
+		subscription, err = ss.sr.Update(ctx, subscription, toUpdate, domain.Event{Type: domain.EventPaused})
+		return err
+	})
 	if err != nil {
-		if errors.As(err, &dataNotFoundErr) {
-			return subscription, err
-		}
-		return subscription, domain.ErrForbidden
+		return domain.Subscription{}, domainError(err)
 	}
 
 	return subscription, nil
 }
 
-func (ss *SubscriptionService) Resume(userID, subscriptionID string) (domain.Subscription, error) {
-	var dataNotFoundErr *domain.ErrDataNotFound
+func (ss *SubscriptionService) Resume(
+	ctx context.Context,
+	userID, subscriptionID string,
+	version int,
+) (domain.Subscription, error) {
+	var subscription domain.Subscription
 
-	subscription, err := ss.sr.Get(subscriptionID)
-	if err != nil {
-		if errors.As(err, &dataNotFoundErr) {
-			return domain.Subscription{}, err
-		}
-		return domain.Subscription{}, domain.ErrForbidden
-	}
+	err := ss.uow.Do(ctx, func(ctx context.Context) error {
+		var err error
 
-	if !subscription.IsActive {
-		return domain.Subscription{}, domain.ErrForbidden
-	}
+		subscription, err = ss.lockOwnSubscription(ctx, userID, subscriptionID)
+		if err != nil {
+			return err
+		}
 
-	if !subscription.IsPaused {
-		return subscription, nil
-	}
+		if err := checkVersion(subscription.Version, version); err != nil {
+			return err
+		}
 
-	previousEndDate := addMonths(subscription.StartDate, subscription.SubscriptionPlan.Length)
-	diff := previousEndDate.Sub(*subscription.PauseDate)
-	newEndDate := time.Now().Add(diff)
+		if !subscription.IsActive {
+			return domain.ErrForbidden
+		}
 
-	subscription.PauseDate = nil
-	subscription.EndDate = &newEndDate
-	subscription.IsPaused = false
+		if !subscription.IsPaused {
+			return nil
+		}
 
-	toUpdate := domain.ToUpdate{
-		repositories.PauseDate: subscription.PauseDate,
-		repositories.EndDate:   subscription.EndDate,
-		repositories.IsPaused:  subscription.IsPaused,
-	}
+		// the subscription keeps the time that was left in the period it was paused in, and the
+		// next periods are counted from the new end of that period
+		pausedEndDate := subscription.PausedEndDate
+		if pausedEndDate == nil {
+			endDate := periodEndAfter(
+				renewalAnchor(subscription), subscription.SubscriptionPlan.Interval, *subscription.PauseDate,
+			)
+			pausedEndDate = &endDate
+		}
+		newEndDate := time.Now().Add(pausedEndDate.Sub(*subscription.PauseDate))
+
+		subscription.PauseDate = nil
+		subscription.PausedEndDate = nil
+		subscription.EndDate = &newEndDate
+		subscription.RenewalAnchor = newEndDate
+		subscription.IsPaused = false
+
+		toUpdate := domain.ToUpdate{
+			repositories.PauseDate:     subscription.PauseDate,
+			repositories.PausedEndDate: subscription.PausedEndDate,
+			repositories.EndDate:       subscription.EndDate,
+			repositories.RenewalAnchor: subscription.RenewalAnchor,
+			repositories.IsPaused:      subscription.IsPaused,
+		}
 
-	subscription, err = ss.sr.Update(subscription, toUpdate)
+		subscription, err = ss.sr.Update(ctx, subscription, toUpdate, domain.Event{Type: domain.EventResumed})
+		return err
+	})
 	if err != nil {
-		if errors.As(err, &dataNotFoundErr) {
-			return subscription, err
-		}
-		return subscription, domain.ErrInternal
+		return domain.Subscription{}, domainError(err)
 	}
 
 	return subscription, nil
 }
 
-func (ss *SubscriptionService) Unsubscribe(userID, subscriptionID string) (domain.Subscription, error) {
-	var dataNotFoundErr *domain.ErrDataNotFound
+func (ss *SubscriptionService) Unsubscribe(
+	ctx context.Context,
+	userID, subscriptionID string,
+	version int,
+) (domain.Subscription, error) {
+	var subscription domain.Subscription
 
-	subscription, err := ss.sr.Get(subscriptionID)
-	if err != nil {
-		if errors.As(err, &dataNotFoundErr) {
-			return domain.Subscription{}, err
+	err := ss.uow.Do(ctx, func(ctx context.Context) error {
+		var err error
+
+		subscription, err = ss.lockOwnSubscription(ctx, userID, subscriptionID)
+		if err != nil {
+			return err
 		}
-		return domain.Subscription{}, domain.ErrInternal
-	}
 
-	if !subscription.IsActive {
-		return subscription, nil
-	}
+		if err := checkVersion(subscription.Version, version); err != nil {
+			return err
+		}
 
-	subscription.IsActive = false
+		if !subscription.IsActive {
+			return nil
+		}
 
-	toUpdate := domain.ToUpdate{
-		repositories.IsActive: subscription.IsActive,
-	}
+		now := time.Now()
+		subscription.IsActive = false
+		subscription.CancelDate = &now
 
-	subscription, err = ss.sr.Update(subscription, toUpdate)
-	if err != nil {
-		if errors.As(err, &dataNotFoundErr) {
-			return subscription, err
+		toUpdate := domain.ToUpdate{
+			repositories.IsActive:   subscription.IsActive,
+			repositories.CancelDate: subscription.CancelDate,
 		}
-		return subscription, domain.ErrInternal
+
+		subscription, err = ss.sr.Update(ctx, subscription, toUpdate, domain.Event{Type: domain.EventCanceled})
+		return err
+	})
+	if err != nil {
+		return domain.Subscription{}, domainError(err)
 	}
 
 	return subscription, nil
 }
 
-func (ss *SubscriptionService) buildSubscription(
-	userID, productID, productPlanID, voucherID string,
-) (subscription domain.Subscription, err error) {
-	voucher := domain.Voucher{Type: domain.VoucherFixedAmount}
+// NotifyTrialEnding records the TrialEnding event of the active subscriptions whose trial ends within
+// TrialEndingNotice of now, once for each subscription. Returns how many subscriptions were notified.
+func (ss *SubscriptionService) NotifyTrialEnding(ctx context.Context, now time.Time) (int, error) {
+	filter := domain.SubscriptionFilter{
+		Status:       domain.SubscriptionActive,
+		TrialEndFrom: now,
+		TrialEndTo:   now.Add(TrialEndingNotice),
+	}
 
-	if voucherID != "" {
-		v, ok := ss.validateVoucher(voucherID)
-		if !ok {
-			return domain.Subscription{}, &domain.ErrInvalidArgument{Msg: "voucher"}
+	return ss.updateEach(ctx, filter, func(ctx context.Context, subscription domain.Subscription) (bool, error) {
+		if !subscription.IsActive || subscription.TrialNoticeDate != nil || !subscription.TrialDate.After(now) {
+			return false, nil
 		}
-		voucher = v
+
+		subscription.TrialNoticeDate = &now
+		toUpdate := domain.ToUpdate{
+			repositories.TrialNoticeDate: subscription.TrialNoticeDate,
+		}
+
+		_, err := ss.sr.Update(ctx, subscription, toUpdate, domain.Event{Type: domain.EventTrialEnding})
+		return err == nil, err
+	})
+}
+
+// Renew starts the next period of the active subscriptions whose period ended before now, moving their
+// end date past now. Periods are counted from the renewal anchor of the subscription rather than from its
+// end date, so month ends don't drift. Returns how many subscriptions were renewed.
+func (ss *SubscriptionService) Renew(ctx context.Context, now time.Time) (int, error) {
+	filter := domain.SubscriptionFilter{
+		Status: domain.SubscriptionActive,
+		EndTo:  now,
 	}
 
-	var dataNotFoundErr *domain.ErrDataNotFound
+	return ss.updateEach(ctx, filter, func(ctx context.Context, subscription domain.Subscription) (bool, error) {
+		if !subscription.IsActive || subscription.IsPaused || subscription.EndDate == nil ||
+			!subscription.EndDate.Before(now) || !subscription.SubscriptionPlan.Interval.IsValid() {
+			return false, nil
+		}
 
-	user, err := ss.ur.Get(userID)
-	if err != nil {
-		if errors.As(err, &dataNotFoundErr) {
-			return subscription, err
+		endDate := periodEndAfter(renewalAnchor(subscription), subscription.SubscriptionPlan.Interval, now)
+		subscription.EndDate = &endDate
+		toUpdate := domain.ToUpdate{
+			repositories.EndDate: subscription.EndDate,
+		}
+
+		_, err := ss.sr.Update(ctx, subscription, toUpdate, domain.Event{Type: domain.EventRenewed})
+		return err == nil, err
+	})
+}
+
+// updateEach calls update with every subscription selected by the filter, locked in a unit of work of
+// its own, and returns how many subscriptions update changed. It stops at the first failure.
+func (ss *SubscriptionService) updateEach(
+	ctx context.Context,
+	filter domain.SubscriptionFilter,
+	update func(ctx context.Context, subscription domain.Subscription) (changed bool, err error),
+) (int, error) {
+	updated := 0
+	page := domain.Page{Limit: domain.MaxPageLimit}
+
+	for {
+		subscriptions, next, err := ss.sr.List(ctx, filter, page)
+		if err != nil {
+			return updated, domain.ErrInternal
+		}
+
+		for _, s := range subscriptions {
+			var changed bool
+
+			err := ss.uow.Do(ctx, func(ctx context.Context) error {
+				subscription, err := ss.sr.GetForUpdate(ctx, s.ID)
+				if err != nil {
+					return err
+				}
+
+				changed, err = update(ctx, subscription)
+				return err
+			})
+			if err != nil {
+				return updated, domainError(err)
+			}
+			if changed {
+				updated++
+			}
 		}
-		return subscription, domain.ErrInternal
+
+		if next == "" {
+			return updated, nil
+		}
+		page.Cursor = next
 	}
+}
 
-	if subscription, ok := getSubscription(user, productID); ok {
-		return subscription, nil
+func (ss *SubscriptionService) reactivate(
+	ctx context.Context,
+	subscription domain.Subscription,
+) (domain.Subscription, error) {
+	subscription.IsActive = true
+	subscription.CancelDate = nil
+
+	toUpdate := domain.ToUpdate{
+		repositories.IsActive:   subscription.IsActive,
+		repositories.CancelDate: subscription.CancelDate,
 	}
 
-	product, err := ss.pr.Get(productID)
+	// a subscription won back is resumed rather than created again
+	return ss.sr.Update(ctx, subscription, toUpdate, domain.Event{Type: domain.EventResumed})
+}
+
+func (ss *SubscriptionService) buildSubscription(
+	ctx context.Context,
+	productID, productPlanID string,
+	voucher domain.Voucher,
+	seats int,
+) (subscription domain.Subscription, err error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	product, err := ss.pr.Get(ctx, productID)
 	if err != nil {
 		if errors.As(err, &dataNotFoundErr) {
 			return domain.Subscription{}, err
@@ -224,40 +439,58 @@ func (ss *SubscriptionService) buildSubscription(
 		return domain.Subscription{}, domain.ErrInternal
 	}
 
+	if product.IsArchived {
+		return domain.Subscription{}, domain.ErrForbidden
+	}
+
 	productPlan, ok := getProductPlan(productPlanID, product)
 	if !ok {
 		return subscription, &domain.ErrDataNotFound{DataType: "product plan"}
 	}
 
-	price, err := ss.ds.ApplyDiscountOnPrice(productPlan.Price, voucher)
+	if seats > 1 && seats > productPlan.MaxSeats {
+		return domain.Subscription{}, &domain.ErrInvalidArgument{Argument: "seats", Msg: "seats exceed the plan limit"}
+	}
+
+	basePrice, err := seatsPrice(*productPlan.Plan, seats)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+
+	price, err := ss.ds.ApplyDiscountOnPrice(basePrice, voucher)
 	if err != nil {
 		return domain.Subscription{}, err
 	}
-	tax, err := ss.ds.ApplyDiscountOnTax(productPlan.Price, productPlan.Tax, voucher)
+	tax, err := ss.ds.ApplyDiscountOnTax(basePrice, productPlan.Tax, voucher)
 	if err != nil {
 		return domain.Subscription{}, err
 	}
 
 	subscriptionPlan := domain.SubscriptionPlan{
 		Plan: &domain.Plan{
-			Length: productPlan.Length,
-			Price:  price,
-			Tax:    tax,
+			Interval:  productPlan.Interval,
+			Price:     price,
+			Tax:       tax,
+			MaxSeats:  productPlan.MaxSeats,
+			SeatPrice: productPlan.SeatPrice,
 		},
-		VoucherID: voucherID,
+		VoucherID:     voucher.ID,
+		ProductPlanID: productPlan.ID,
 	}
 	now := time.Now()
-	trialDate := addMonths(now, TrialPeriod)
+	trialDate := addInterval(now, TrialPeriod, 1)
 	startDate := now
-	endDate := addMonths(trialDate, productPlan.Length)
+	endDate := addInterval(trialDate, productPlan.Interval, 1)
 	subscription = domain.Subscription{
 		ProductID:        product.ID,
 		SubscriptionPlan: subscriptionPlan,
 		TrialDate:        trialDate,
 		StartDate:        startDate,
 		EndDate:          &endDate,
+		RenewalAnchor:    trialDate,
 		PauseDate:        nil,
 		IsActive:         true,
+		Seats:            seats,
 	}
 
 	return subscription, err
@@ -291,9 +524,9 @@ func getProductPlan(SubscriptionPlanID string, product domain.Product) (domain.P
 	return domain.ProductPlan{}, false
 }
 
-func getSubscription(user domain.User, productID string) (domain.Subscription, bool) {
+func getActiveSubscription(user domain.User, productID string) (domain.Subscription, bool) {
 	for _, s := range user.Subscriptions {
-		if s.ProductID == productID {
+		if s.ProductID == productID && s.IsActive {
 			return s, true
 		}
 	}
@@ -301,9 +534,88 @@ func getSubscription(user domain.User, productID string) (domain.Subscription, b
 	return domain.Subscription{}, false
 }
 
-func addMonths(t time.Time, months int) time.Time {
-	endDate := t.AddDate(0, months, 0)
-	return endDate
+// getWinBackSubscription returns the most recently canceled subscription to the same product plan
+// that can still be reactivated, i.e. it was canceled within the win-back period and its term is not over.
+func getWinBackSubscription(
+	user domain.User,
+	productID, productPlanID, voucherID string,
+	seats int,
+) (subscription domain.Subscription, ok bool) {
+	period := winBackPeriod()
+	if period == 0 {
+		return domain.Subscription{}, false
+	}
+
+	now := time.Now()
+
+	for _, s := range user.Subscriptions {
+		if s.ProductID != productID || s.IsActive || s.CancelDate == nil || s.Product.IsArchived {
+			continue
+		}
+		if s.SubscriptionPlan.Plan == nil ||
+			s.SubscriptionPlan.ProductPlanID != productPlanID ||
+			s.SubscriptionPlan.VoucherID != voucherID ||
+			s.Seats != seats {
+			continue
+		}
+		if now.Sub(*s.CancelDate) > period || (s.EndDate != nil && s.EndDate.Before(now)) {
+			continue
+		}
+		if ok && !s.CancelDate.After(*subscription.CancelDate) {
+			continue
+		}
+
+		subscription, ok = s, true
+	}
+
+	return subscription, ok
+}
+
+// renewalAnchor returns the date the periods of the subscription are counted from, the end of its trial
+// until it is resumed after a pause.
+func renewalAnchor(subscription domain.Subscription) time.Time {
+	if subscription.RenewalAnchor.IsZero() {
+		return subscription.TrialDate
+	}
+
+	return subscription.RenewalAnchor
+}
+
+// seatsPrice returns the plan price for the given number of seats, each seat after the first
+// costs the plan seat price.
+func seatsPrice(plan domain.Plan, seats int) (domain.Money, error) {
+	if seats <= 1 || plan.SeatPrice == nil {
+		return plan.Price, nil
+	}
+
+	price, err := currency.NewAmount(plan.Price.Number, string(plan.Price.Code))
+	if err != nil {
+		return domain.Money{}, &domain.ErrInvalidArgument{Msg: err.Error()}
+	}
+	seatPrice, err := currency.NewAmount(plan.SeatPrice.Number, string(plan.SeatPrice.Code))
+	if err != nil {
+		return domain.Money{}, &domain.ErrInvalidArgument{Msg: err.Error()}
+	}
+
+	extraSeats, err := seatPrice.Mul(strconv.Itoa(seats - 1))
+	if err != nil {
+		return domain.Money{}, fmt.Errorf("error when calculating extra seats price: %w", err)
+	}
+	total, err := price.Add(extraSeats)
+	if err != nil {
+		return domain.Money{}, fmt.Errorf("error when adding extra seats price: %w", err)
+	}
+
+	return domain.Money{Code: plan.Price.Code, Number: formatCurrency(total).Number()}, nil
+}
+
+func winBackPeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("WIN_BACK_PERIOD_DAYS"))
+	if err != nil || days < 0 {
+		return 0
+	}
+
+	return time.Duration(days) * 24 * time.Hour
 }
 
 func onTrial(trialDate time.Time) bool {
@@ -314,3 +626,42 @@ func onTrial(trialDate time.Time) bool {
 
 	return trialDate.After(time.Now())
 }
+
+// fetchOwnSubscription returns the subscription if it belongs to the user, hiding the subscriptions
+// of other users as not found.
+func (ss *SubscriptionService) fetchOwnSubscription(
+	ctx context.Context,
+	userID, subscriptionID string,
+) (domain.Subscription, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	subscription, err := ss.sr.Get(ctx, subscriptionID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.Subscription{}, err
+		}
+		return domain.Subscription{}, domain.ErrInternal
+	}
+	if subscription.UserID != userID {
+		return domain.Subscription{}, &domain.ErrDataNotFound{DataType: "subscription"}
+	}
+
+	return subscription, nil
+}
+
+// lockOwnSubscription is fetchOwnSubscription locking the subscription until the end of the unit
+// of work running in ctx.
+func (ss *SubscriptionService) lockOwnSubscription(
+	ctx context.Context,
+	userID, subscriptionID string,
+) (domain.Subscription, error) {
+	subscription, err := ss.sr.GetForUpdate(ctx, subscriptionID)
+	if err != nil {
+		return domain.Subscription{}, err
+	}
+	if subscription.UserID != userID {
+		return domain.Subscription{}, &domain.ErrDataNotFound{DataType: "subscription"}
+	}
+
+	return subscription, nil
+}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+)
+
+type UsageService struct {
+	ur domain.UsageRepository
+	sr domain.SubscriptionRepository
+	pr domain.ProductRepository
+}
+
+func NewUsageService(
+	ur domain.UsageRepository,
+	sr domain.SubscriptionRepository,
+	pr domain.ProductRepository,
+) *UsageService {
+	return &UsageService{ur: ur, sr: sr, pr: pr}
+}
+
+func (us *UsageService) Report(
+	ctx context.Context,
+	userID, subscriptionID string,
+	record domain.UsageRecord,
+) (domain.UsageRecord, error) {
+	if record.Quantity <= 0 {
+		return domain.UsageRecord{}, &domain.ErrInvalidArgument{Argument: "quantity", Msg: "quantity"}
+	}
+
+	subscription, product, err := us.fetchSubscription(ctx, userID, subscriptionID)
+	if err != nil {
+		return domain.UsageRecord{}, err
+	}
+
+	if !subscription.IsActive || subscription.IsPaused {
+		return domain.UsageRecord{}, domain.ErrForbidden
+	}
+
+	now := time.Now()
+	if record.UsageDate.IsZero() {
+		record.UsageDate = now
+	}
+	if record.UsageDate.Before(subscription.StartDate) || record.UsageDate.After(now) {
+		return domain.UsageRecord{}, &domain.ErrInvalidArgument{Argument: "usageDate", Msg: "usageDate"}
+	}
+
+	if _, ok := getAddOn(product, record.AddOnID); !ok {
+		return domain.UsageRecord{}, &domain.ErrDataNotFound{DataType: "add-on"}
+	}
+
+	record.SubscriptionID = subscription.ID
+
+	record, err = us.ur.Save(ctx, record)
+	if err != nil {
+		return domain.UsageRecord{}, domain.ErrInternal
+	}
+
+	return record, nil
+}
+
+// Summary aggregates, per add-on, the usage of the billing period that contains the given time.
+func (us *UsageService) Summary(
+	ctx context.Context,
+	userID, subscriptionID string,
+	at time.Time,
+) (domain.UsageSummary, error) {
+	subscription, product, err := us.fetchSubscription(ctx, userID, subscriptionID)
+	if err != nil {
+		return domain.UsageSummary{}, err
+	}
+
+	start, end := billingPeriod(subscription, at)
+
+	records, err := us.ur.List(ctx, subscription.ID, start, end)
+	if err != nil {
+		return domain.UsageSummary{}, domain.ErrInternal
+	}
+
+	quantities := map[string]int{}
+	for _, r := range records {
+		quantities[r.AddOnID] += r.Quantity
+	}
+
+	code := string(domain.CurrencyEUR)
+	if subscription.SubscriptionPlan.Plan != nil {
+		code = string(subscription.SubscriptionPlan.Price.Code)
+	}
+	total, err := currency.NewAmount("0", code)
+	if err != nil {
+		return domain.UsageSummary{}, fmt.Errorf("error when initializing usage total: %w", err)
+	}
+
+	items := []domain.UsageItem{}
+	for _, addOn := range product.AddOns {
+		quantity, ok := quantities[addOn.ID]
+		if !ok {
+			continue
+		}
+
+		unitPrice, err := currency.NewAmount(addOn.UnitPrice.Number, string(addOn.UnitPrice.Code))
+		if err != nil {
+			return domain.UsageSummary{}, fmt.Errorf("error when reading add-on unit price: %w", err)
+		}
+		itemTotal, err := unitPrice.Mul(strconv.Itoa(quantity))
+		if err != nil {
+			return domain.UsageSummary{}, fmt.Errorf("error when calculating add-on total: %w", err)
+		}
+		total, err = total.Add(itemTotal)
+		if err != nil {
+			return domain.UsageSummary{}, fmt.Errorf("error when adding add-on total: %w", err)
+		}
+
+		items = append(items, domain.UsageItem{
+			AddOnID:   addOn.ID,
+			Key:       addOn.Key,
+			Name:      addOn.Name,
+			Quantity:  quantity,
+			UnitPrice: addOn.UnitPrice,
+			Total:     domain.Money{Code: addOn.UnitPrice.Code, Number: formatCurrency(itemTotal).Number()},
+		})
+	}
+
+	return domain.UsageSummary{
+		SubscriptionID: subscription.ID,
+		PeriodStart:    start,
+		PeriodEnd:      end,
+		Items:          items,
+		Total:          domain.Money{Code: domain.CurrencyCode(code), Number: formatCurrency(total).Number()},
+	}, nil
+}
+
+func (us *UsageService) fetchSubscription(
+	ctx context.Context,
+	userID, subscriptionID string,
+) (domain.Subscription, domain.Product, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	subscription, err := us.sr.Get(ctx, subscriptionID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.Subscription{}, domain.Product{}, err
+		}
+		return domain.Subscription{}, domain.Product{}, domain.ErrInternal
+	}
+	if subscription.UserID != userID {
+		return domain.Subscription{}, domain.Product{}, &domain.ErrDataNotFound{DataType: "subscription"}
+	}
+
+	product, err := us.pr.Get(ctx, subscription.ProductID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.Subscription{}, domain.Product{}, err
+		}
+		return domain.Subscription{}, domain.Product{}, domain.ErrInternal
+	}
+
+	return subscription, product, nil
+}
+
+// billingPeriod returns the [start, end) period of the subscription that contains t: the trial period,
+// then one plan interval after another starting when the trial ends. A subscription resumed after a pause
+// starts them again from the end of the period it was resumed in.
+func billingPeriod(subscription domain.Subscription, t time.Time) (start, end time.Time) {
+	if t.Before(subscription.TrialDate) ||
+		subscription.SubscriptionPlan.Plan == nil ||
+		!subscription.SubscriptionPlan.Interval.IsValid() {
+		return subscription.StartDate, subscription.TrialDate
+	}
+
+	interval := subscription.SubscriptionPlan.Interval
+	anchor := renewalAnchor(subscription)
+	from := anchor
+	if t.Before(anchor) {
+		// the periods before the subscription was resumed are counted from the end of the trial
+		from = subscription.TrialDate
+	}
+
+	start = from
+	for n := 1; ; n++ {
+		end = addInterval(from, interval, n)
+		if end.After(t) {
+			break
+		}
+		start = end
+	}
+
+	// the period the subscription was resumed in ends at the anchor
+	if t.Before(anchor) && end.After(anchor) {
+		end = anchor
+	}
+
+	return start, end
+}
+
+func getAddOn(product domain.Product, addOnID string) (domain.AddOn, bool) {
+	for _, a := range product.AddOns {
+		if a.ID == addOnID {
+			return a, true
+		}
+	}
+
+	return domain.AddOn{}, false
+}
@@ -1,23 +1,338 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
 	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/dnawand/go-membershipapi/pkg/repositories"
 )
 
 type UserService struct {
 	userRepository domain.UserRepository
+	sr             domain.SubscriptionRepository
+	mr             domain.MemberRepository
+	usr            domain.UsageRepository
+	nr             domain.NotificationRepository
+	uow            domain.UnitOfWork
 }
 
-func NewUserService(ur domain.UserRepository) *UserService {
+func NewUserService(
+	ur domain.UserRepository,
+	sr domain.SubscriptionRepository,
+	mr domain.MemberRepository,
+	usr domain.UsageRepository,
+	nr domain.NotificationRepository,
+	uow domain.UnitOfWork,
+) *UserService {
 	return &UserService{
 		userRepository: ur,
+		sr:             sr,
+		mr:             mr,
+		usr:            usr,
+		nr:             nr,
+		uow:            uow,
+	}
+}
+
+func (us *UserService) Create(ctx context.Context, user domain.User) (domain.User, error) {
+	var conflictErr *domain.ErrConflict
+
+	user.Name = strings.TrimSpace(user.Name)
+	user.Email = strings.TrimSpace(user.Email)
+	user.Locale = strings.TrimSpace(user.Locale)
+
+	if err := validateName(user.Name); err != nil {
+		return domain.User{}, err
+	}
+	if err := validateEmail(user.Email); err != nil {
+		return domain.User{}, err
+	}
+	if user.Locale != "" {
+		if err := validateLocale(user.Locale); err != nil {
+			return domain.User{}, err
+		}
+	}
+
+	user, err := us.userRepository.Save(ctx, domain.User{Name: user.Name, Email: user.Email, Locale: user.Locale})
+	if err != nil {
+		if errors.As(err, &conflictErr) {
+			return domain.User{}, err
+		}
+		return domain.User{}, domain.ErrInternal
+	}
+
+	return user, nil
+}
+
+func (us *UserService) Fetch(ctx context.Context, userID string) (domain.User, error) {
+	return us.userRepository.Get(ctx, userID)
+}
+
+// Update changes the name, email and locale of the user; empty values are left unchanged.
+// The email must not be in use by another user.
+func (us *UserService) Update(ctx context.Context, userID string, changes domain.User) (domain.User, error) {
+	var conflictErr *domain.ErrConflict
+
+	changes.Name = strings.TrimSpace(changes.Name)
+	changes.Email = strings.TrimSpace(changes.Email)
+	changes.Locale = strings.TrimSpace(changes.Locale)
+
+	if changes.Email != "" {
+		if err := validateEmail(changes.Email); err != nil {
+			return domain.User{}, err
+		}
+	}
+	if changes.Locale != "" {
+		if err := validateLocale(changes.Locale); err != nil {
+			return domain.User{}, err
+		}
+	}
+
+	user, err := us.fetchUser(ctx, userID)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	toUpdate := domain.ToUpdate{}
+
+	if changes.Name != "" && changes.Name != user.Name {
+		if err := validateName(changes.Name); err != nil {
+			return domain.User{}, err
+		}
+		user.Name = changes.Name
+		toUpdate[repositories.Name] = user.Name
+	}
+
+	if changes.Email != "" && !strings.EqualFold(changes.Email, user.Email) {
+		if err := us.checkEmailAvailable(ctx, changes.Email); err != nil {
+			return domain.User{}, err
+		}
+		user.Email = changes.Email
+		toUpdate[repositories.Email] = user.Email
+	}
+
+	if changes.Locale != "" && changes.Locale != user.Locale {
+		user.Locale = changes.Locale
+		toUpdate[repositories.Locale] = user.Locale
+	}
+
+	if len(toUpdate) == 0 {
+		return user, nil
+	}
+
+	user, err = us.userRepository.Update(ctx, user, toUpdate)
+	if err != nil {
+		if errors.As(err, &conflictErr) {
+			return domain.User{}, err
+		}
+		return domain.User{}, domain.ErrInternal
+	}
+
+	return user, nil
+}
+
+// Delete soft deletes the user after canceling its active subscriptions and leaving the
+// group subscriptions it is a member of. Subscriptions are kept as history.
+func (us *UserService) Delete(ctx context.Context, userID string) error {
+	err := us.uow.Do(ctx, func(ctx context.Context) error {
+		user, err := us.userRepository.GetForUpdate(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := us.closeAccount(ctx, user); err != nil {
+			return err
+		}
+
+		return us.userRepository.Delete(ctx, user)
+	})
+	if err != nil {
+		return domainError(err)
+	}
+
+	return nil
+}
+
+// Erase anonymizes the personal data of the user, deleting it first if it's still active.
+// Subscriptions, plans and usage records are financial records and are retained, the notifications
+// of the user are deleted.
+func (us *UserService) Erase(ctx context.Context, userID string) error {
+	err := us.uow.Do(ctx, func(ctx context.Context) error {
+		var dataNotFoundErr *domain.ErrDataNotFound
+
+		// a deleted user is not found, but its personal data is still there to erase
+		user, err := us.userRepository.GetForUpdate(ctx, userID)
+		if err != nil && !errors.As(err, &dataNotFoundErr) {
+			return err
+		}
+
+		if user.ID != "" {
+			if err := us.closeAccount(ctx, user); err != nil {
+				return err
+			}
+		}
+
+		// notifications hold the email and name of the user, and the pending ones must not be sent anymore
+		if err := us.nr.DeleteByUser(ctx, userID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		erased := domain.User{
+			ID:       userID,
+			Email:    fmt.Sprintf("erased-%s", userID),
+			ErasedAt: &now,
+		}
+
+		_, err = us.userRepository.Erase(ctx, erased)
+		return err
+	})
+	if err != nil {
+		return domainError(err)
+	}
+
+	return nil
+}
+
+// Export gathers everything held about the user.
+func (us *UserService) Export(ctx context.Context, userID string) (domain.UserExport, error) {
+	user, err := us.fetchUser(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, err
+	}
+
+	memberships, err := us.mr.ListByUser(ctx, userID)
+	if err != nil {
+		return domain.UserExport{}, domain.ErrInternal
+	}
+
+	now := time.Now()
+	usage := []domain.UsageRecord{}
+	for _, s := range user.Subscriptions {
+		records, err := us.usr.List(ctx, s.ID, time.Time{}, now)
+		if err != nil {
+			return domain.UserExport{}, domain.ErrInternal
+		}
+		usage = append(usage, records...)
+	}
+
+	return domain.UserExport{
+		User:        user,
+		Memberships: memberships,
+		Usage:       usage,
+		ExportDate:  now,
+	}, nil
+}
+
+func (us *UserService) fetchUser(ctx context.Context, userID string) (domain.User, error) {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	user, err := us.userRepository.Get(ctx, userID)
+	if err != nil {
+		if errors.As(err, &dataNotFoundErr) {
+			return domain.User{}, err
+		}
+		return domain.User{}, domain.ErrInternal
+	}
+
+	return user, nil
+}
+
+func (us *UserService) checkEmailAvailable(ctx context.Context, email string) error {
+	var dataNotFoundErr *domain.ErrDataNotFound
+
+	_, err := us.userRepository.GetByEmail(ctx, email)
+	if err == nil {
+		return &domain.ErrConflict{DataType: "user", Field: "email"}
+	}
+	if !errors.As(err, &dataNotFoundErr) {
+		return domain.ErrInternal
 	}
+
+	return nil
+}
+
+// closeAccount cancels the active subscriptions of the user and removes it from the group
+// subscriptions it is a member of. It runs in the unit of work of ctx, and locks each subscription
+// before canceling it, so changes made meanwhile are not overwritten.
+func (us *UserService) closeAccount(ctx context.Context, user domain.User) error {
+	now := time.Now()
+
+	for _, s := range user.Subscriptions {
+		if !s.IsActive {
+			continue
+		}
+
+		subscription, err := us.sr.GetForUpdate(ctx, s.ID)
+		if err != nil {
+			return err
+		}
+		if !subscription.IsActive {
+			continue
+		}
+
+		toUpdate := domain.ToUpdate{
+			repositories.IsActive:   false,
+			repositories.CancelDate: &now,
+		}
+		if _, err := us.sr.Update(ctx, subscription, toUpdate, domain.Event{Type: domain.EventCanceled}); err != nil {
+			return err
+		}
+	}
+
+	memberships, err := us.mr.ListByUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range memberships {
+		toUpdate := domain.ToUpdate{
+			repositories.MemberStatus:     domain.MemberRemoved,
+			repositories.MemberRemoveDate: &now,
+		}
+		if _, err := us.mr.Update(ctx, m, toUpdate); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (us *UserService) Create(user domain.User) (domain.User, error) {
-	return us.userRepository.Save(user)
+const maxNameLength = 100
+
+// localePattern matches BCP 47 language tags made of a language and optional subtags, e.g. pt-BR.
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+func validateName(name string) error {
+	if name == "" || len([]rune(name)) > maxNameLength {
+		return &domain.ErrInvalidArgument{Argument: "name", Msg: "name"}
+	}
+
+	return nil
 }
 
-func (us *UserService) Fetch(userID string) (domain.User, error) {
-	return us.userRepository.Get(userID)
+// validateEmail accepts a bare address, e.g. user@email.com, rejecting display names.
+func validateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return &domain.ErrInvalidArgument{Argument: "email", Msg: "email"}
+	}
+
+	return nil
+}
+
+// validateLocale accepts language tags, e.g. en or pt-BR. Notifications are written in the default language
+// when there are no templates for the locale.
+func validateLocale(locale string) error {
+	if !localePattern.MatchString(locale) {
+		return &domain.ErrInvalidArgument{Argument: "locale", Msg: "locale"}
+	}
+
+	return nil
 }
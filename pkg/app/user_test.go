@@ -0,0 +1,45 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateUser(t *testing.T) {
+	var errInvalidArgument *domain.ErrInvalidArgument
+
+	t.Run("test valid name and email", func(t *testing.T) {
+		assert.NoError(t, validateName("Tester"))
+		assert.NoError(t, validateEmail("tester@email.com"))
+	})
+
+	t.Run("test invalid names", func(t *testing.T) {
+		for _, name := range []string{"", strings.Repeat("a", maxNameLength+1)} {
+			err := validateName(name)
+			assert.ErrorAs(t, err, &errInvalidArgument)
+			assert.Equal(t, "name", errInvalidArgument.Argument)
+		}
+	})
+
+	t.Run("test invalid emails", func(t *testing.T) {
+		for _, email := range []string{"", "tester", "tester@", "Tester <tester@email.com>"} {
+			err := validateEmail(email)
+			assert.ErrorAs(t, err, &errInvalidArgument)
+			assert.Equal(t, "email", errInvalidArgument.Argument)
+		}
+	})
+
+	t.Run("test locales", func(t *testing.T) {
+		for _, locale := range []string{"en", "pt-BR", "zh-Hant-TW"} {
+			assert.NoError(t, validateLocale(locale))
+		}
+		for _, locale := range []string{"e", "english", "pt_BR", "pt-", "../en"} {
+			err := validateLocale(locale)
+			assert.ErrorAs(t, err, &errInvalidArgument)
+			assert.Equal(t, "locale", errInvalidArgument.Argument)
+		}
+	})
+}
@@ -0,0 +1,400 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/dnawand/go-membershipapi/pkg/repositories"
+)
+
+var (
+	// WebhookMaxAttempts is how many times a delivery is attempted before giving up.
+	WebhookMaxAttempts = 8
+	// WebhookRetryBackoff is the delay before the first retry of a delivery, doubled for each next one.
+	WebhookRetryBackoff = time.Minute
+	// WebhookDisableAfter is how many attempts in a row may fail before the endpoint is disabled.
+	WebhookDisableAfter = 20
+)
+
+// webhookBatch is how many due deliveries are sent at once.
+const webhookBatch = 100
+
+type WebhookService struct {
+	wr     domain.WebhookRepository
+	dr     domain.WebhookDeliveryRepository
+	sender domain.WebhookSender
+}
+
+func NewWebhookService(
+	wr domain.WebhookRepository,
+	dr domain.WebhookDeliveryRepository,
+	sender domain.WebhookSender,
+) *WebhookService {
+	return &WebhookService{wr: wr, dr: dr, sender: sender}
+}
+
+// Create registers an enabled endpoint, with a new secret to check the signatures of the deliveries.
+func (ws *WebhookService) Create(ctx context.Context, endpoint domain.WebhookEndpoint) (domain.WebhookEndpoint, error) {
+	endpoint.URL = strings.TrimSpace(endpoint.URL)
+	if err := validateWebhookURL(endpoint.URL); err != nil {
+		return domain.WebhookEndpoint{}, err
+	}
+	if err := validateEventTypes(endpoint.EventTypes); err != nil {
+		return domain.WebhookEndpoint{}, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return domain.WebhookEndpoint{}, domain.ErrInternal
+	}
+
+	endpoint.Secret = secret
+	endpoint.IsEnabled = true
+	endpoint.Failures = 0
+	endpoint.DisableDate = nil
+
+	endpoint, err = ws.wr.Save(ctx, endpoint)
+	if err != nil {
+		return domain.WebhookEndpoint{}, domainError(err)
+	}
+
+	return endpoint, nil
+}
+
+func (ws *WebhookService) Fetch(ctx context.Context, endpointID string) (domain.WebhookEndpoint, error) {
+	endpoint, err := ws.wr.Get(ctx, endpointID)
+	if err != nil {
+		return domain.WebhookEndpoint{}, domainError(err)
+	}
+
+	return endpoint, nil
+}
+
+func (ws *WebhookService) List(ctx context.Context) ([]domain.WebhookEndpoint, error) {
+	endpoints, err := ws.wr.List(ctx)
+	if err != nil {
+		return nil, domain.ErrInternal
+	}
+
+	return endpoints, nil
+}
+
+func (ws *WebhookService) Update(
+	ctx context.Context,
+	endpointID string,
+	changes domain.WebhookChanges,
+) (domain.WebhookEndpoint, error) {
+	endpoint, err := ws.Fetch(ctx, endpointID)
+	if err != nil {
+		return domain.WebhookEndpoint{}, err
+	}
+
+	toUpdate := domain.ToUpdate{}
+
+	if changes.URL = strings.TrimSpace(changes.URL); changes.URL != "" && changes.URL != endpoint.URL {
+		if err := validateWebhookURL(changes.URL); err != nil {
+			return domain.WebhookEndpoint{}, err
+		}
+		endpoint.URL = changes.URL
+		toUpdate[repositories.WebhookURL] = endpoint.URL
+	}
+
+	if changes.EventTypes != nil {
+		if err := validateEventTypes(changes.EventTypes); err != nil {
+			return domain.WebhookEndpoint{}, err
+		}
+		endpoint.EventTypes = changes.EventTypes
+		toUpdate[repositories.WebhookEventTypes] = endpoint.EventTypes
+	}
+
+	if changes.IsEnabled != nil && *changes.IsEnabled != endpoint.IsEnabled {
+		endpoint.IsEnabled = *changes.IsEnabled
+		toUpdate[repositories.WebhookIsEnabled] = endpoint.IsEnabled
+		if endpoint.IsEnabled {
+			endpoint.Failures = 0
+			endpoint.DisableDate = nil
+			toUpdate[repositories.WebhookFailures] = endpoint.Failures
+			toUpdate[repositories.WebhookDisableDate] = endpoint.DisableDate
+		}
+	}
+
+	if len(toUpdate) == 0 {
+		return endpoint, nil
+	}
+
+	endpoint, err = ws.wr.Update(ctx, endpoint, toUpdate)
+	if err != nil {
+		return domain.WebhookEndpoint{}, domainError(err)
+	}
+
+	return endpoint, nil
+}
+
+// Delete removes the endpoint, its pending deliveries being dropped with it.
+func (ws *WebhookService) Delete(ctx context.Context, endpointID string) error {
+	endpoint, err := ws.Fetch(ctx, endpointID)
+	if err != nil {
+		return err
+	}
+
+	if err := ws.wr.Delete(ctx, endpoint); err != nil {
+		return domain.ErrInternal
+	}
+
+	return nil
+}
+
+// Deliveries returns a page of the log of the deliveries to the endpoint.
+func (ws *WebhookService) Deliveries(
+	ctx context.Context,
+	endpointID string,
+	page domain.Page,
+) ([]domain.WebhookDelivery, string, error) {
+	page, err := validatePage(page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := ws.Fetch(ctx, endpointID); err != nil {
+		return nil, "", err
+	}
+
+	deliveries, next, err := ws.dr.List(ctx, endpointID, page)
+	if err != nil {
+		return nil, "", domainError(err)
+	}
+
+	return deliveries, next, nil
+}
+
+// Replay queues the event of a past delivery to the endpoint again, as a new delivery.
+func (ws *WebhookService) Replay(ctx context.Context, endpointID, deliveryID string) (domain.WebhookDelivery, error) {
+	if _, err := ws.Fetch(ctx, endpointID); err != nil {
+		return domain.WebhookDelivery{}, err
+	}
+
+	delivery, err := ws.dr.Get(ctx, deliveryID)
+	if err != nil {
+		return domain.WebhookDelivery{}, domainError(err)
+	}
+	if delivery.EndpointID != endpointID {
+		return domain.WebhookDelivery{}, &domain.ErrDataNotFound{DataType: "delivery"}
+	}
+
+	now := time.Now()
+	replay, err := ws.dr.Save(ctx, domain.WebhookDelivery{
+		EndpointID:    delivery.EndpointID,
+		EventID:       delivery.EventID,
+		EventType:     delivery.EventType,
+		Payload:       delivery.Payload,
+		IsReplay:      true,
+		Status:        domain.DeliveryPending,
+		NextAttemptAt: &now,
+	})
+	if err != nil {
+		return domain.WebhookDelivery{}, domainError(err)
+	}
+
+	return replay, nil
+}
+
+// Deliver queues the event for every enabled endpoint taking its type, once for each endpoint, making the
+// service a sink of the event relay. The deliveries are sent by Dispatch.
+func (ws *WebhookService) Deliver(ctx context.Context, event domain.Event) error {
+	endpoints, err := ws.wr.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("could not encode event: %w", err)
+	}
+
+	now := time.Now()
+	for _, endpoint := range endpoints {
+		if !endpoint.IsEnabled || !endpoint.EventTypes.Includes(event.Type) {
+			continue
+		}
+
+		// the relay delivers an event again when another sink failed to take it
+		queued, err := ws.dr.Exists(ctx, endpoint.ID, event.ID)
+		if err != nil {
+			return err
+		}
+		if queued {
+			continue
+		}
+
+		_, err = ws.dr.Save(ctx, domain.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        domain.DeliveryPending,
+			NextAttemptAt: &now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Dispatch sends the deliveries due at now, and returns how many succeeded. Failed deliveries are retried
+// with an exponential backoff until WebhookMaxAttempts, and endpoints failing WebhookDisableAfter attempts
+// in a row are disabled.
+func (ws *WebhookService) Dispatch(ctx context.Context, now time.Time) (int, error) {
+	deliveries, err := ws.dr.ListDue(ctx, now, webhookBatch)
+	if err != nil {
+		return 0, domain.ErrInternal
+	}
+
+	var dataNotFoundErr *domain.ErrDataNotFound
+	sent := 0
+	endpoints := map[string]domain.WebhookEndpoint{}
+
+	for _, delivery := range deliveries {
+		endpoint, ok := endpoints[delivery.EndpointID]
+		if !ok {
+			endpoint, err = ws.wr.Get(ctx, delivery.EndpointID)
+			if errors.As(err, &dataNotFoundErr) {
+				continue
+			}
+			if err != nil {
+				return sent, domain.ErrInternal
+			}
+		}
+		if !endpoint.IsEnabled {
+			continue
+		}
+
+		var succeeded bool
+		endpoint, succeeded, err = ws.send(ctx, endpoint, delivery, now)
+		if err != nil {
+			return sent, err
+		}
+		endpoints[endpoint.ID] = endpoint
+		if succeeded {
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+// send attempts the delivery, recording the outcome on the delivery and the endpoint.
+func (ws *WebhookService) send(
+	ctx context.Context,
+	endpoint domain.WebhookEndpoint,
+	delivery domain.WebhookDelivery,
+	now time.Time,
+) (domain.WebhookEndpoint, bool, error) {
+	status, err := ws.sender.Send(ctx, endpoint, delivery)
+	if err == nil && (status < http.StatusOK || status >= http.StatusMultipleChoices) {
+		err = fmt.Errorf("endpoint responded with status %d", status)
+	}
+
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	delivery.LastError = ""
+	delivery.NextAttemptAt = nil
+
+	switch {
+	case err == nil:
+		delivery.Status = domain.DeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= WebhookMaxAttempts:
+		delivery.Status = domain.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		next := now.Add(retryDelay(WebhookRetryBackoff, delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		delivery.LastError = err.Error()
+	}
+
+	toUpdate := domain.ToUpdate{
+		repositories.DeliveryStatus:         delivery.Status,
+		repositories.DeliveryAttempts:       delivery.Attempts,
+		repositories.DeliveryResponseStatus: delivery.ResponseStatus,
+		repositories.DeliveryLastError:      delivery.LastError,
+		repositories.DeliveryNextAttemptAt:  delivery.NextAttemptAt,
+		repositories.DeliveryDeliveredAt:    delivery.DeliveredAt,
+	}
+	if _, err := ws.dr.Update(ctx, delivery, toUpdate); err != nil {
+		return endpoint, false, domain.ErrInternal
+	}
+
+	failures := 0
+	if err != nil {
+		failures = endpoint.Failures + 1
+	}
+	if failures == endpoint.Failures {
+		return endpoint, err == nil, nil
+	}
+
+	endpoint.Failures = failures
+	endpointUpdate := domain.ToUpdate{
+		repositories.WebhookFailures: endpoint.Failures,
+	}
+	if endpoint.Failures >= WebhookDisableAfter {
+		endpoint.IsEnabled = false
+		endpoint.DisableDate = &now
+		endpointUpdate[repositories.WebhookIsEnabled] = endpoint.IsEnabled
+		endpointUpdate[repositories.WebhookDisableDate] = endpoint.DisableDate
+	}
+
+	var dataNotFoundErr *domain.ErrDataNotFound
+	// the endpoint may have been deleted while its delivery was sent
+	if _, updateErr := ws.wr.Update(ctx, endpoint, endpointUpdate); updateErr != nil &&
+		!errors.As(updateErr, &dataNotFoundErr) {
+		return endpoint, false, domain.ErrInternal
+	}
+
+	return endpoint, err == nil, nil
+}
+
+// retryDelay is the delay before the next attempt of a delivery attempted the given number of times, the
+// backoff doubled for each attempt after the first one.
+func retryDelay(backoff time.Duration, attempts int) time.Duration {
+	return backoff << (attempts - 1)
+}
+
+// validateWebhookURL accepts absolute http and https URLs.
+func validateWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &domain.ErrInvalidArgument{Argument: "url", Msg: "url"}
+	}
+
+	return nil
+}
+
+func validateEventTypes(types domain.EventTypes) error {
+	for _, t := range types {
+		if !t.IsValid() {
+			return &domain.ErrInvalidArgument{Argument: "eventTypes", Msg: "eventTypes"}
+		}
+	}
+
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
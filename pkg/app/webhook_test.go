@@ -0,0 +1,25 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	t.Run("test delay doubles with each attempt", func(t *testing.T) {
+		assert.Equal(t, WebhookRetryBackoff, retryDelay(WebhookRetryBackoff, 1))
+		assert.Equal(t, 2*WebhookRetryBackoff, retryDelay(WebhookRetryBackoff, 2))
+		assert.Equal(t, 64*WebhookRetryBackoff, retryDelay(WebhookRetryBackoff, 7))
+		assert.Equal(t, 4*NotificationRetryBackoff, retryDelay(NotificationRetryBackoff, 3))
+	})
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	for _, valid := range []string{"https://partner.com/hooks", "http://localhost:8080"} {
+		assert.NoError(t, validateWebhookURL(valid), valid)
+	}
+	for _, invalid := range []string{"", "partner.com/hooks", "ftp://partner.com", "https://", "://partner.com"} {
+		assert.Error(t, validateWebhookURL(invalid), invalid)
+	}
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Entitlement is a feature granted by a product to its subscribers, with an optional usage limit.
+type Entitlement struct {
+	ID             string         `json:"id" gorm:"type:uuid;uniqueIndex"`
+	Key            string         `json:"key"`
+	Limit          *int           `json:"limit,omitempty"` // unlimited when absent
+	ExcludeOnTrial bool           `json:"excludeOnTrial"`
+	ProductID      string         `json:"-" gorm:"type:uuid"`
+	CreatedAt      time.Time      `json:"-"`
+	UpdatedAt      time.Time      `json:"-"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// EffectiveEntitlement is an entitlement of a user merged from all the subscriptions granting it.
+type EffectiveEntitlement struct {
+	Key     string              `json:"key"`
+	Limit   *int                `json:"limit,omitempty"`
+	Sources []EntitlementSource `json:"sources"`
+}
+
+type EntitlementSource struct {
+	SubscriptionID string `json:"subscriptionId"`
+	ProductID      string `json:"productId"`
+	OnTrial        bool   `json:"onTrial"`
+	IsMember       bool   `json:"member"`
+}
@@ -7,6 +7,14 @@ import (
 
 var ErrInternal = errors.New("interal server error")
 var ErrForbidden = errors.New("forbidden")
+var ErrUnauthenticated = errors.New("unauthenticated")
+var ErrPermissionDenied = errors.New("permission denied")
+
+// ErrPreconditionFailed is returned when data changed since the version the caller based its change on.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with another request.
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused for another request")
 
 type ErrDataNotFound struct {
 	DataType string
@@ -27,3 +35,14 @@ func (e *ErrInvalidArgument) Error() string {
 	}
 	return e.Msg
 }
+
+// ErrConflict is returned when data can't be stored because it clashes with existing data,
+// e.g. an email address already in use.
+type ErrConflict struct {
+	DataType string
+	Field    string
+}
+
+func (e *ErrConflict) Error() string {
+	return fmt.Sprintf("%s with this %s already exists", e.DataType, e.Field)
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventSubscriptionCreated EventType = "SubscriptionCreated"
+	EventTrialEnding         EventType = "TrialEnding"
+	EventPaused              EventType = "Paused"
+	EventResumed             EventType = "Resumed"
+	EventCanceled            EventType = "Canceled"
+	EventRenewed             EventType = "Renewed"
+	EventVoucherRedeemed     EventType = "VoucherRedeemed"
+)
+
+func (t EventType) IsValid() bool {
+	switch t {
+	case EventSubscriptionCreated, EventTrialEnding, EventPaused, EventResumed, EventCanceled, EventRenewed,
+		EventVoucherRedeemed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Event is a change in the lifecycle of a subscription. Events are recorded in the outbox by the
+// transaction changing the subscription, and relayed to the sinks once it's committed.
+type Event struct {
+	Sequence       int64           `json:"-" gorm:"primaryKey;autoIncrement"` // order in which events were recorded
+	ID             string          `json:"id" gorm:"type:uuid;uniqueIndex"`
+	Type           EventType       `json:"type"`
+	SubscriptionID string          `json:"subscriptionId" gorm:"type:uuid"`
+	UserID         string          `json:"userId" gorm:"type:uuid"`
+	Data           json.RawMessage `json:"data"` // the subscription once changed
+	OccurredAt     time.Time       `json:"occurredAt"`
+	Attempts       int             `json:"-"` // failed deliveries
+	LastError      string          `json:"-"`
+	PublishedAt    *time.Time      `json:"-" gorm:"index"` // nil until delivered to every sink
+}
+
+// EventSink delivers events outside the service. Events are delivered at least once, in the order they
+// occurred, so sinks may receive an event again and should discard the ids they already know.
+type EventSink interface {
+	Deliver(ctx context.Context, event Event) error
+}
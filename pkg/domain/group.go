@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type MemberStatus string
+
+const (
+	MemberInvited MemberStatus = "invited"
+	MemberActive  MemberStatus = "active"
+	MemberRemoved MemberStatus = "removed"
+)
+
+// SubscriptionMember is a user that shares a group subscription paid by its owner.
+// Invitations are sent by email and bound to a user when accepted.
+type SubscriptionMember struct {
+	ID             string         `json:"id" gorm:"type:uuid;uniqueIndex"`
+	SubscriptionID string         `json:"subscriptionId" gorm:"type:uuid;index"`
+	UserID         string         `json:"userId,omitempty" gorm:"index"` // empty until the invitation is accepted
+	Email          string         `json:"email"`
+	Status         MemberStatus   `json:"status"`
+	InviteDate     time.Time      `json:"inviteDate"`
+	AcceptDate     *time.Time     `json:"acceptDate,omitempty"`
+	RemoveDate     *time.Time     `json:"removeDate,omitempty"`
+	CreatedAt      time.Time      `json:"-"`
+	UpdatedAt      time.Time      `json:"-"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// IdempotencyKey is a request made with an Idempotency-Key header. Once the request is handled, its
+// response is stored to be replayed to the repeats of the request until the key expires.
+type IdempotencyKey struct {
+	Key         string `gorm:"primaryKey"` // scoped to the caller that sent it
+	Fingerprint string // hash of the request, repeats must have the same
+	Status      int    // zero while the request is handled
+	ContentType string
+	ETag        string `gorm:"column:etag"`
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+// IsHandled reports whether the response of the request is stored.
+func (k IdempotencyKey) IsHandled() bool {
+	return k.Status != 0
+}
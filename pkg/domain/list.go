@@ -0,0 +1,58 @@
+package domain
+
+import "time"
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// Page selects Limit items of a list sorted by SortBy, the ones following the item that Cursor was
+// returned for. Lists are sorted by creation date when SortBy is empty.
+type Page struct {
+	Limit  int
+	Cursor string // empty for the first page
+	SortBy string
+	Desc   bool
+}
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionActive   SubscriptionStatus = "active"
+	SubscriptionPaused   SubscriptionStatus = "paused"
+	SubscriptionCanceled SubscriptionStatus = "canceled"
+)
+
+func (s SubscriptionStatus) IsValid() bool {
+	switch s {
+	case SubscriptionActive, SubscriptionPaused, SubscriptionCanceled:
+		return true
+	default:
+		return false
+	}
+}
+
+// ProductFilter selects products of a list, zero values selecting every product.
+type ProductFilter struct {
+	CreatedFrom time.Time // inclusive
+	CreatedTo   time.Time // exclusive
+	Interval    Interval  // of one of the current plans, a zero count matching any
+}
+
+// SubscriptionFilter selects subscriptions of a list, zero values selecting every subscription.
+type SubscriptionFilter struct {
+	UserID       string
+	UserEmail    string
+	Status       SubscriptionStatus
+	ProductID    string
+	PlanID       string // product plan subscribed to
+	VoucherID    string
+	CreatedFrom  time.Time // inclusive
+	CreatedTo    time.Time // exclusive
+	TrialEndFrom time.Time // inclusive
+	TrialEndTo   time.Time // exclusive
+	EndFrom      time.Time // inclusive, selecting only subscriptions with an end date
+	EndTo        time.Time // exclusive, selecting only subscriptions with an end date
+	Interval     Interval  // of the subscribed plan, a zero count matching any
+}
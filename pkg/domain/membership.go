@@ -13,10 +13,41 @@ const (
 	VoucherPercentage  VoucherType = "Percentage"
 )
 
+// IntervalUnit is the unit of a plan billing interval.
+type IntervalUnit string
+
+const (
+	IntervalDay   IntervalUnit = "day"
+	IntervalWeek  IntervalUnit = "week"
+	IntervalMonth IntervalUnit = "month"
+	IntervalYear  IntervalUnit = "year"
+)
+
+// Interval is a billing period of Count units, e.g. 10 days or 1 year.
+type Interval struct {
+	Unit  IntervalUnit `json:"unit"`
+	Count int          `json:"count"`
+}
+
+func (i Interval) IsValid() bool {
+	switch i.Unit {
+	case IntervalDay, IntervalWeek, IntervalMonth, IntervalYear:
+		return i.Count > 0
+	default:
+		return false
+	}
+}
+
 type Product struct {
 	ID           string         `json:"id" gorm:"type:uuid;uniqueIndex"`
 	Name         string         `json:"name"`
 	ProductPlans []ProductPlan  `json:"plans,omitempty"`
+	AddOns       []AddOn        `json:"addOns,omitempty"`
+	Entitlements []Entitlement  `json:"entitlements,omitempty"`
+	Bundle       []Product      `json:"bundle,omitempty" gorm:"many2many:product_bundles"`
+	IsArchived   bool           `json:"archived"` // archived products are no longer listed nor subscribed
+	ArchiveDate  *time.Time     `json:"archiveDate,omitempty"`
+	Version      int            `json:"-" gorm:"not null;default:1"` // also incremented by changes of its plans, add-ons...
 	CreatedAt    time.Time      `json:"-"`
 	UpdatedAt    time.Time      `json:"-"`
 	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
@@ -31,9 +62,15 @@ type Subscription struct {
 	StartDate        time.Time        `json:"startDate"`
 	EndDate          *time.Time       `json:"endDate,omitempty"`
 	PauseDate        *time.Time       `json:"pauseDate,omitempty"`
+	PausedEndDate    *time.Time       `json:"-"` // end of the period the subscription was paused in
+	RenewalAnchor    time.Time        `json:"-"` // periods are counted from it, the end of the trial until the subscription is resumed
+	CancelDate       *time.Time       `json:"cancelDate,omitempty"`
+	TrialNoticeDate  *time.Time       `json:"-"` // when the end of the trial was announced
 	IsPaused         bool             `json:"paused"`
 	IsActive         bool             `json:"active"`
+	Seats            int              `json:"seats"`
 	UserID           string           `json:"-" gorm:"type:uuid"`
+	Version          int              `json:"-" gorm:"not null;default:1"` // incremented on every change, sent as ETag
 	CreatedAt        time.Time        `json:"-"`
 	UpdatedAt        time.Time        `json:"-"`
 	DeletedAt        gorm.DeletedAt   `json:"-" gorm:"index"`
@@ -41,24 +78,34 @@ type Subscription struct {
 
 type Plan struct {
 	ID        string         `json:"id" gorm:"type:uuid;uniqueIndex"`
-	Length    int            `json:"length"`
-	Price     Money          `json:"price" gorm:"type:string"`
-	Tax       Money          `json:"tax" gorm:"type:string"`
+	Interval  Interval       `json:"interval" gorm:"embedded;embeddedPrefix:interval_"`
+	Price     Money          `json:"price" gorm:"type:text"`
+	Tax       Money          `json:"tax" gorm:"type:text"`
+	MaxSeats  int            `json:"maxSeats,omitempty"`                   // group plans have more than one seat
+	SeatPrice *Money         `json:"seatPrice,omitempty" gorm:"type:text"` // charged for each seat after the first
 	CreatedAt time.Time      `json:"-"`
 	UpdatedAt time.Time      `json:"-"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// ProductPlan is immutable once offered: changing its terms retires it and creates a new version,
+// so subscriptions keep pointing at the version they signed up for.
 type ProductPlan struct {
 	*Plan
-	ProductID string `json:"-" gorm:"type:uuid"`
+	Version        int        `json:"version"`
+	PreviousPlanID string     `json:"previousPlanId,omitempty"` // empty for the first version
+	IsRetired      bool       `json:"retired"`
+	RetireDate     *time.Time `json:"retireDate,omitempty"`
+	ProductID      string     `json:"-" gorm:"type:uuid"`
 }
 
 type SubscriptionPlan struct {
 	*Plan
-	Voucher        *Voucher `json:"voucher,omitempty" gorm:"-:all"`
-	VoucherID      string   `json:"-"`
-	SubscriptionID string   `json:"-" gorm:"type:uuid"`
+	Voucher          *Voucher `json:"voucher,omitempty" gorm:"-:all"`
+	VoucherID        string   `json:"-"`
+	ProductPlanID    string   `json:"-" gorm:"type:uuid"`
+	PriceMigrationID string   `json:"-"` // empty unless migrated to a new price
+	SubscriptionID   string   `json:"-" gorm:"type:uuid"`
 }
 
 type Voucher struct {
@@ -20,8 +20,13 @@ type Money struct {
 }
 
 func (m *Money) Scan(value interface{}) error {
-	b, ok := value.([]byte) // SQLite stores string as bytes
-	if !ok {
+	var b []byte
+	switch v := value.(type) {
+	case []byte: // SQLite returns text as bytes
+		b = v
+	case string: // PostgreSQL returns text as string
+		b = []byte(v)
+	default:
 		log.Println("could not convert value from db into bytes")
 		return fmt.Errorf("could not convert value from db into bytes")
 	}
@@ -45,5 +50,5 @@ func (m Money) Value() (driver.Value, error) {
 		return nil, fmt.Errorf("could not convert Money into json")
 	}
 
-	return json, nil
+	return string(json), nil
 }
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// NotificationKind is the template a notification is written with.
+type NotificationKind string
+
+const (
+	NotificationSubscribed  NotificationKind = "subscribed"
+	NotificationTrialEnding NotificationKind = "trial_ending"
+	NotificationResumed     NotificationKind = "resumed" // the end of a pause, or a win-back
+)
+
+// Notification is an email to a user about its subscription, sent until it succeeds or runs out of attempts.
+// The recipient is copied when the notification is queued, in case the user changes meanwhile. The
+// notifications of a user are deleted when the user is erased.
+type Notification struct {
+	ID            string `gorm:"type:uuid;uniqueIndex"`
+	EventID       string `gorm:"type:uuid;index"`
+	UserID        string `gorm:"type:uuid"`
+	Kind          NotificationKind
+	Email         string
+	Name          string
+	Locale        string          // of the user, the default one when empty
+	Subscription  json.RawMessage // as of the event
+	Status        DeliveryStatus
+	Attempts      int
+	LastError     string
+	NextAttemptAt *time.Time `gorm:"index"` // nil once sent or failed
+	SentAt        *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Message is a notification written in the language of its recipient, as plain text and HTML.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PriceMigration moves the subscribers of a product plan to a new price at their next renewal
+// after the effective date. Subscriptions started up to GrandfatheredUntil keep their price, and the ones
+// started after the effective date are not moved. The migration is complete once every subscription it
+// moves is migrated.
+type PriceMigration struct {
+	ID                 string         `json:"id" gorm:"type:uuid;uniqueIndex"`
+	ProductID          string         `json:"productId" gorm:"type:uuid"`
+	ProductPlanID      string         `json:"planId" gorm:"type:uuid;index"`
+	TargetPrice        Money          `json:"targetPrice" gorm:"type:text"`
+	TargetTax          Money          `json:"targetTax" gorm:"type:text"`
+	NoticeDays         int            `json:"noticeDays"`
+	EffectiveDate      time.Time      `json:"effectiveDate"`
+	GrandfatheredUntil *time.Time     `json:"grandfatheredUntil,omitempty"`
+	IsCanceled         bool           `json:"canceled"`
+	CompleteDate       *time.Time     `json:"completeDate,omitempty"`
+	CreatedAt          time.Time      `json:"createdAt"`
+	UpdatedAt          time.Time      `json:"-"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// MigrationCandidate is a subscription on the migrated plan and how the migration affects it.
+type MigrationCandidate struct {
+	SubscriptionID  string     `json:"subscriptionId"`
+	UserID          string     `json:"userId"`
+	CurrentPrice    Money      `json:"currentPrice"`
+	TargetPrice     Money      `json:"targetPrice"`
+	TargetTax       Money      `json:"targetTax"`
+	MigrationDate   *time.Time `json:"migrationDate,omitempty"`
+	IsGrandfathered bool       `json:"grandfathered"`
+	IsMigrated      bool       `json:"migrated"`
+}
@@ -1,22 +1,109 @@
 package domain
 
+import (
+	"context"
+	"time"
+)
+
 type Column string
 type ToUpdate map[Column]interface{}
 
+// UnitOfWork runs fn in a transaction, that the repositories called with the context given to fn
+// take part in.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type UserRepository interface {
-	Save(User) (User, error)
-	Get(userID string) (User, error)
+	Save(ctx context.Context, user User) (User, error)
+	Get(ctx context.Context, userID string) (User, error)
+	GetForUpdate(ctx context.Context, userID string) (User, error)
+	GetByEmail(ctx context.Context, email string) (User, error)
+	Update(ctx context.Context, user User, updates ToUpdate) (User, error)
+	Delete(ctx context.Context, user User) error
+	Erase(ctx context.Context, user User) (User, error)
 }
 
 type ProductRepository interface {
-	Save(Product) (Product, error)
-	Get(productID string) (Product, error)
-	List() ([]Product, error)
+	Save(ctx context.Context, product Product) (Product, error)
+	Get(ctx context.Context, productID string) (Product, error)
+	List(ctx context.Context, filter ProductFilter, page Page) ([]Product, string, error)
+	Update(ctx context.Context, product Product, updates ToUpdate) (Product, error)
+	SavePlan(ctx context.Context, plan ProductPlan) (ProductPlan, error)
+	GetPlan(ctx context.Context, productID, planID string) (ProductPlan, error)
+	SavePlanVersion(ctx context.Context, previous ProductPlan, next ProductPlan) (ProductPlan, error)
+	RetirePlan(ctx context.Context, plan ProductPlan) (ProductPlan, error)
+	SaveAddOn(ctx context.Context, addOn AddOn) (AddOn, error)
+	SaveEntitlement(ctx context.Context, entitlement Entitlement) (Entitlement, error)
 }
 
 type SubscriptionRepository interface {
-	Save(User) (Subscription, error)
-	Get(subscriptionID string) (Subscription, error)
-	List(userID string) ([]Subscription, error)
-	Update(Subscription, ToUpdate) (Subscription, error)
+	Save(ctx context.Context, user User, events ...Event) (Subscription, error)
+	Get(ctx context.Context, subscriptionID string) (Subscription, error)
+	GetForUpdate(ctx context.Context, subscriptionID string) (Subscription, error)
+	List(ctx context.Context, filter SubscriptionFilter, page Page) ([]Subscription, string, error)
+	Update(ctx context.Context, subscription Subscription, updates ToUpdate, events ...Event) (Subscription, error)
+	ListByProductPlan(ctx context.Context, productPlanID string) ([]Subscription, error)
+	UpdatePlan(ctx context.Context, plan SubscriptionPlan, updates ToUpdate) (SubscriptionPlan, error)
+}
+
+type MemberRepository interface {
+	Save(ctx context.Context, member SubscriptionMember) (SubscriptionMember, error)
+	Get(ctx context.Context, memberID string) (SubscriptionMember, error)
+	List(ctx context.Context, subscriptionID string) ([]SubscriptionMember, error)
+	ListByUser(ctx context.Context, userID string) ([]SubscriptionMember, error)
+	Update(ctx context.Context, member SubscriptionMember, updates ToUpdate) (SubscriptionMember, error)
+}
+
+type UsageRepository interface {
+	Save(ctx context.Context, record UsageRecord) (UsageRecord, error)
+	List(ctx context.Context, subscriptionID string, from, to time.Time) ([]UsageRecord, error)
+}
+
+type PriceMigrationRepository interface {
+	Save(ctx context.Context, migration PriceMigration) (PriceMigration, error)
+	Get(ctx context.Context, migrationID string) (PriceMigration, error)
+	ListDue(ctx context.Context, now time.Time) ([]PriceMigration, error)
+	Update(ctx context.Context, migration PriceMigration, updates ToUpdate) (PriceMigration, error)
+}
+
+type IdempotencyRepository interface {
+	Save(ctx context.Context, key IdempotencyKey) (IdempotencyKey, error)
+	Get(ctx context.Context, key string) (IdempotencyKey, error)
+	Update(ctx context.Context, key IdempotencyKey, updates ToUpdate) (IdempotencyKey, error)
+	Delete(ctx context.Context, key string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type OutboxRepository interface {
+	ListPending(ctx context.Context, limit int) ([]Event, error)
+	MarkPublished(ctx context.Context, event Event, at time.Time) error
+	MarkFailed(ctx context.Context, event Event, reason string) error
+	DeletePublished(ctx context.Context, before time.Time) (int64, error)
+}
+
+type WebhookRepository interface {
+	Save(ctx context.Context, endpoint WebhookEndpoint) (WebhookEndpoint, error)
+	Get(ctx context.Context, endpointID string) (WebhookEndpoint, error)
+	List(ctx context.Context) ([]WebhookEndpoint, error)
+	Update(ctx context.Context, endpoint WebhookEndpoint, updates ToUpdate) (WebhookEndpoint, error)
+	Delete(ctx context.Context, endpoint WebhookEndpoint) error
+}
+
+type WebhookDeliveryRepository interface {
+	Save(ctx context.Context, delivery WebhookDelivery) (WebhookDelivery, error)
+	Get(ctx context.Context, deliveryID string) (WebhookDelivery, error)
+	Exists(ctx context.Context, endpointID, eventID string) (bool, error)
+	List(ctx context.Context, endpointID string, page Page) ([]WebhookDelivery, string, error)
+	ListDue(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+	Update(ctx context.Context, delivery WebhookDelivery, updates ToUpdate) (WebhookDelivery, error)
+}
+
+type NotificationRepository interface {
+	Save(ctx context.Context, notification Notification) (Notification, error)
+	Exists(ctx context.Context, eventID string) (bool, error)
+	ListDue(ctx context.Context, now time.Time, limit int) ([]Notification, error)
+	Update(ctx context.Context, notification Notification, updates ToUpdate) (Notification, error)
+	DeleteByUser(ctx context.Context, userID string) error
+	DeleteFinished(ctx context.Context, before time.Time) (int64, error)
 }
@@ -1,26 +1,110 @@
 package domain
 
+import (
+	"context"
+	"time"
+)
+
 type UserService interface {
-	Create(User) (User, error)
-	Fetch(userID string) (User, error)
+	Create(ctx context.Context, user User) (User, error)
+	Fetch(ctx context.Context, userID string) (User, error)
+	Update(ctx context.Context, userID string, user User) (User, error)
+	Delete(ctx context.Context, userID string) error
+	Erase(ctx context.Context, userID string) error
+	Export(ctx context.Context, userID string) (UserExport, error)
 }
 
 type ProductService interface {
-	Create(Product) (Product, error)
-	Fetch(productID string) (Product, error)
-	List() ([]Product, error)
+	Create(ctx context.Context, product Product) (Product, error)
+	Fetch(ctx context.Context, productID string) (Product, error)
+	List(ctx context.Context, filter ProductFilter, page Page) ([]Product, string, error)
+	Update(ctx context.Context, productID, name string, version int) (Product, error)
+	Archive(ctx context.Context, productID string, version int) (Product, error)
+	AddPlan(ctx context.Context, productID string, plan ProductPlan, version int) (ProductPlan, error)
+	UpdatePlan(ctx context.Context, productID, planID string, plan Plan, version int) (ProductPlan, error)
+	RetirePlan(ctx context.Context, productID, planID string, version int) (ProductPlan, error)
+	AddAddOn(ctx context.Context, productID string, addOn AddOn, version int) (AddOn, error)
+	AddEntitlement(ctx context.Context, productID string, entitlement Entitlement, version int) (Entitlement, error)
 }
 
 type SubscriptionService interface {
-	Subscribe(userID, productID, productPlanID string, voucherID string) (Subscription, error)
-	Fetch(userID, subscriptionID string) (Subscription, error)
-	List(userID string) ([]Subscription, error)
-	Pause(userID, subscriptionID string) (Subscription, error)
-	Resume(userID, subscriptionID string) (Subscription, error)
-	Unsubscribe(userID, subscriptionID string) (Subscription, error)
+	// Subscribe reports created unless the user was already subscribed to the product, reactivated
+	// subscriptions being reported as created.
+	Subscribe(ctx context.Context, userID, productID, productPlanID string, voucherID string, seats int) (s Subscription, created bool, err error)
+	Fetch(ctx context.Context, userID, subscriptionID string) (Subscription, error)
+	List(ctx context.Context, userID string, filter SubscriptionFilter, page Page) ([]Subscription, string, error)
+	Search(ctx context.Context, filter SubscriptionFilter, page Page) ([]Subscription, string, error)
+	NotifyTrialEnding(ctx context.Context, now time.Time) (notified int, err error)
+	Renew(ctx context.Context, now time.Time) (renewed int, err error)
+	Pause(ctx context.Context, userID, subscriptionID string, version int) (Subscription, error)
+	Resume(ctx context.Context, userID, subscriptionID string, version int) (Subscription, error)
+	Unsubscribe(ctx context.Context, userID, subscriptionID string, version int) (Subscription, error)
+}
+
+type MemberService interface {
+	Invite(ctx context.Context, userID, subscriptionID, email string) (SubscriptionMember, error)
+	List(ctx context.Context, userID, subscriptionID string) ([]SubscriptionMember, error)
+	Remove(ctx context.Context, userID, subscriptionID, memberID string) (SubscriptionMember, error)
+	Accept(ctx context.Context, userID, memberID string) (SubscriptionMember, error)
+	Memberships(ctx context.Context, userID string) ([]SubscriptionMember, error)
+}
+
+type EntitlementService interface {
+	Resolve(ctx context.Context, userID string) ([]EffectiveEntitlement, error)
+}
+
+type UsageService interface {
+	Report(ctx context.Context, userID, subscriptionID string, record UsageRecord) (UsageRecord, error)
+	Summary(ctx context.Context, userID, subscriptionID string, at time.Time) (UsageSummary, error)
+}
+
+type PriceMigrationService interface {
+	Schedule(ctx context.Context, migration PriceMigration) (PriceMigration, error)
+	Fetch(ctx context.Context, migrationID string) (PriceMigration, error)
+	Preview(ctx context.Context, migrationID string) ([]MigrationCandidate, error)
+	Cancel(ctx context.Context, migrationID string) (PriceMigration, error)
+	Apply(ctx context.Context, now time.Time) (migrated int, err error)
 }
 
 type DiscountService interface {
 	ApplyDiscountOnPrice(price Money, v Voucher) (Money, error)
 	ApplyDiscountOnTax(price Money, tax Money, v Voucher) (Money, error)
 }
+
+type IdempotencyService interface {
+	Start(ctx context.Context, key, fingerprint string) (stored IdempotencyKey, started bool, err error)
+	Complete(ctx context.Context, key IdempotencyKey) error
+	Abort(ctx context.Context, key string) error
+	Purge(ctx context.Context, now time.Time) (int64, error)
+}
+
+type EventRelay interface {
+	Relay(ctx context.Context) (delivered int, err error)
+	Purge(ctx context.Context, now time.Time) (int64, error)
+}
+
+type WebhookService interface {
+	Create(ctx context.Context, endpoint WebhookEndpoint) (WebhookEndpoint, error)
+	Fetch(ctx context.Context, endpointID string) (WebhookEndpoint, error)
+	List(ctx context.Context) ([]WebhookEndpoint, error)
+	Update(ctx context.Context, endpointID string, changes WebhookChanges) (WebhookEndpoint, error)
+	Delete(ctx context.Context, endpointID string) error
+	Deliveries(ctx context.Context, endpointID string, page Page) ([]WebhookDelivery, string, error)
+	Replay(ctx context.Context, endpointID, deliveryID string) (WebhookDelivery, error)
+	Dispatch(ctx context.Context, now time.Time) (sent int, err error)
+}
+
+// WebhookSender posts a delivery to a webhook endpoint, returning the status of the response.
+type WebhookSender interface {
+	Send(ctx context.Context, endpoint WebhookEndpoint, delivery WebhookDelivery) (status int, err error)
+}
+
+// NotificationRenderer writes a notification with the templates of the locale of its recipient.
+type NotificationRenderer interface {
+	Render(notification Notification) (Message, error)
+}
+
+// Notifier sends messages to users, by email or any other mean.
+type Notifier interface {
+	Notify(ctx context.Context, message Message) error
+}
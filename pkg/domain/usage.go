@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AddOn is a metered item sold on top of a product plan, charged per unit used.
+type AddOn struct {
+	ID        string         `json:"id" gorm:"type:uuid;uniqueIndex"`
+	Key       string         `json:"key"`
+	Name      string         `json:"name"`
+	UnitPrice Money          `json:"unitPrice" gorm:"type:text"`
+	ProductID string         `json:"-" gorm:"type:uuid"`
+	CreatedAt time.Time      `json:"-"`
+	UpdatedAt time.Time      `json:"-"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// UsageRecord is a quantity of an add-on used by a subscription at a given time.
+type UsageRecord struct {
+	ID             string    `json:"id" gorm:"type:uuid;uniqueIndex"`
+	SubscriptionID string    `json:"subscriptionId" gorm:"type:uuid;index"`
+	AddOnID        string    `json:"addOnId" gorm:"type:uuid"`
+	Quantity       int       `json:"quantity"`
+	UsageDate      time.Time `json:"usageDate" gorm:"index"`
+	CreatedAt      time.Time `json:"-"`
+}
+
+// UsageSummary aggregates the usage of a subscription within one billing period.
+type UsageSummary struct {
+	SubscriptionID string      `json:"subscriptionId"`
+	PeriodStart    time.Time   `json:"periodStart"`
+	PeriodEnd      time.Time   `json:"periodEnd"`
+	Items          []UsageItem `json:"items"`
+	Total          Money       `json:"total"`
+}
+
+type UsageItem struct {
+	AddOnID   string `json:"addOnId"`
+	Key       string `json:"key"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice Money  `json:"unitPrice"`
+	Total     Money  `json:"total"`
+}
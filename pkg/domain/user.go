@@ -10,8 +10,18 @@ type User struct {
 	ID            string         `json:"id" gorm:"type:uuid;uniqueIndex"`
 	Name          string         `json:"name"`
 	Email         string         `json:"email" gorm:"uniqueIndex"`
+	Locale        string         `json:"locale,omitempty"` // language of the notifications, e.g. en or pt-BR
 	Subscriptions []Subscription `json:"subscriptions,omitempty"`
+	ErasedAt      *time.Time     `json:"-"` // set when the personal data was anonymized
 	CreatedAt     time.Time      `json:"-"`
 	UpdatedAt     time.Time      `json:"-"`
 	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
 }
+
+// UserExport is all the data held about a user, including subscriptions, memberships and usage.
+type UserExport struct {
+	User        User                 `json:"user"`
+	Memberships []SubscriptionMember `json:"memberships"`
+	Usage       []UsageRecord        `json:"usage"`
+	ExportDate  time.Time            `json:"exportDate"`
+}
@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed" // given up after the last attempt
+)
+
+// EventTypes are the types of the events sent to a webhook endpoint, every type when empty.
+type EventTypes []EventType
+
+// Includes reports whether events of type t are sent.
+func (ts EventTypes) Includes(t EventType) bool {
+	if len(ts) == 0 {
+		return true
+	}
+	for _, included := range ts {
+		if included == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (ts *EventTypes) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case []byte: // SQLite returns text as bytes
+		b = v
+	case string: // PostgreSQL returns text as string
+		b = []byte(v)
+	default:
+		return fmt.Errorf("could not convert value from db into bytes")
+	}
+
+	types := EventTypes{}
+	if err := json.Unmarshal(b, &types); err != nil {
+		return fmt.Errorf("could not json into EventTypes")
+	}
+
+	*ts = types
+
+	return nil
+}
+
+func (ts EventTypes) Value() (driver.Value, error) {
+	if ts == nil {
+		ts = EventTypes{}
+	}
+
+	json, err := json.Marshal(ts)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert EventTypes into json")
+	}
+
+	return string(json), nil
+}
+
+// WebhookEndpoint is a URL of a partner the subscription events are posted to, signed with its secret.
+type WebhookEndpoint struct {
+	ID          string         `json:"id" gorm:"type:uuid;uniqueIndex"`
+	URL         string         `json:"url"`
+	EventTypes  EventTypes     `json:"eventTypes" gorm:"type:text"`
+	Secret      string         `json:"-"`
+	IsEnabled   bool           `json:"enabled"`
+	Failures    int            `json:"failures"`              // failed attempts since the last successful one
+	DisableDate *time.Time     `json:"disableDate,omitempty"` // when it was disabled for failing too often
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"-"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// WebhookChanges are the changes of a webhook endpoint, zero values leaving the endpoint unchanged.
+// Enabling an endpoint clears its failures.
+type WebhookChanges struct {
+	URL        string
+	EventTypes EventTypes
+	IsEnabled  *bool
+}
+
+// WebhookDelivery is the posting of an event to a webhook endpoint, retried until it succeeds or runs
+// out of attempts. Deliveries are kept as the log of the endpoint.
+type WebhookDelivery struct {
+	ID             string          `json:"id" gorm:"type:uuid;uniqueIndex"`
+	EndpointID     string          `json:"endpointId" gorm:"type:uuid"`
+	EventID        string          `json:"eventId" gorm:"type:uuid"`
+	EventType      EventType       `json:"eventType"`
+	Payload        json.RawMessage `json:"payload"`
+	IsReplay       bool            `json:"replay"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"responseStatus,omitempty"` // of the last attempt
+	LastError      string          `json:"lastError,omitempty"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty" gorm:"index"` // nil once succeeded or failed
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	UpdatedAt      time.Time       `json:"-"`
+}
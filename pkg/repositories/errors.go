@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"gorm.io/gorm"
+)
+
+// isUniqueViolation reports whether err was caused by a unique constraint, for SQLite and PostgreSQL.
+func isUniqueViolation(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") ||
+		strings.Contains(msg, "duplicate key value violates unique constraint") ||
+		strings.Contains(msg, "SQLSTATE 23505")
+}
+
+// isNotFound reports whether err means the queried record does not exist. PostgreSQL rejects ids that are
+// not valid uuids instead of finding nothing, so such ids are reported as not found as well.
+func isNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound) ||
+		strings.Contains(err.Error(), "invalid input syntax for type uuid")
+}
+
+// isSerializationFailure reports whether err was caused by a concurrent transaction: a serialization
+// failure or a deadlock in PostgreSQL, a busy database in SQLite.
+func isSerializationFailure(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "SQLSTATE 40001") ||
+		strings.Contains(msg, "SQLSTATE 40P01") ||
+		strings.Contains(msg, "database is locked")
+}
+
+// notUpdated explains why a conditional update of the model with the given id changed no row: either
+// the row does not exist or its version changed since it was read.
+func notUpdated(db *gorm.DB, model interface{}, id, dataType string) error {
+	var count int64
+
+	if tx := db.Model(model).Where("id = ?", id).Count(&count); tx.Error != nil && !isNotFound(tx.Error) {
+		return fmt.Errorf("error when querying %s: %w", dataType, tx.Error)
+	}
+	if count == 0 {
+		return &domain.ErrDataNotFound{DataType: dataType}
+	}
+
+	return domain.ErrPreconditionFailed
+}
@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"gorm.io/gorm"
+)
+
+const (
+	ResponseStatus      domain.Column = "status"
+	ResponseContentType domain.Column = "content_type"
+	ResponseETag        domain.Column = "etag"
+	ResponseBody        domain.Column = "body"
+)
+
+type IdempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		db: db,
+	}
+}
+
+func (ir *IdempotencyRepository) Save(ctx context.Context, key domain.IdempotencyKey) (domain.IdempotencyKey, error) {
+	key.CreatedAt = time.Now()
+
+	if tx := conn(ctx, ir.db).Create(&key); tx.Error != nil {
+		if isUniqueViolation(tx.Error) {
+			return domain.IdempotencyKey{}, &domain.ErrConflict{DataType: "request", Field: "Idempotency-Key"}
+		}
+		return domain.IdempotencyKey{}, fmt.Errorf("could not save new idempotency key: %w", tx.Error)
+	}
+
+	return key, nil
+}
+
+func (ir *IdempotencyRepository) Get(ctx context.Context, key string) (domain.IdempotencyKey, error) {
+	var idempotencyKey domain.IdempotencyKey
+
+	if tx := conn(ctx, ir.db).First(&idempotencyKey, "key = ?", key); tx.Error != nil {
+		if isNotFound(tx.Error) {
+			return domain.IdempotencyKey{}, &domain.ErrDataNotFound{DataType: "idempotency key"}
+		}
+		return domain.IdempotencyKey{}, fmt.Errorf("error when querying idempotency key: %w", tx.Error)
+	}
+
+	return idempotencyKey, nil
+}
+
+func (ir *IdempotencyRepository) Update(
+	ctx context.Context,
+	key domain.IdempotencyKey,
+	updates domain.ToUpdate,
+) (domain.IdempotencyKey, error) {
+	colAndVal := map[string]interface{}{}
+
+	for k, v := range updates {
+		colAndVal[string(k)] = v
+	}
+
+	tx := conn(ctx, ir.db).Model(&key).Select("*").Updates(colAndVal)
+	if tx.Error != nil {
+		return domain.IdempotencyKey{}, fmt.Errorf("error when updating idempotency key: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return domain.IdempotencyKey{}, &domain.ErrDataNotFound{DataType: "idempotency key"}
+	}
+
+	return key, nil
+}
+
+func (ir *IdempotencyRepository) Delete(ctx context.Context, key string) error {
+	if tx := conn(ctx, ir.db).Delete(&domain.IdempotencyKey{}, "key = ?", key); tx.Error != nil {
+		return fmt.Errorf("error when deleting idempotency key: %w", tx.Error)
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes the keys expired at now, returning how many were deleted.
+func (ir *IdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	tx := conn(ctx, ir.db).Where("expires_at <= ?", now).Delete(&domain.IdempotencyKey{})
+	if tx.Error != nil {
+		return 0, fmt.Errorf("error when deleting expired idempotency keys: %w", tx.Error)
+	}
+
+	return tx.RowsAffected, nil
+}
@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	MemberUserID     domain.Column = "user_id"
+	MemberStatus     domain.Column = "status"
+	MemberAcceptDate domain.Column = "accept_date"
+	MemberRemoveDate domain.Column = "remove_date"
+)
+
+type MemberRepository struct {
+	db *gorm.DB
+}
+
+func NewMemberRepository(db *gorm.DB) *MemberRepository {
+	return &MemberRepository{
+		db: db,
+	}
+}
+
+func (mr *MemberRepository) Save(
+	ctx context.Context,
+	member domain.SubscriptionMember,
+) (domain.SubscriptionMember, error) {
+	memberID, err := uuid.NewRandom()
+	if err != nil {
+		return domain.SubscriptionMember{}, fmt.Errorf("error when generating id for member: %w", err)
+	}
+
+	now := time.Now()
+	member.ID = memberID.String()
+	member.CreatedAt = now
+	member.UpdatedAt = now
+
+	if tx := conn(ctx, mr.db).Create(&member); tx.Error != nil {
+		return domain.SubscriptionMember{}, fmt.Errorf("could not save new member: %w", tx.Error)
+	}
+
+	return member, nil
+}
+
+func (mr *MemberRepository) Get(ctx context.Context, memberID string) (domain.SubscriptionMember, error) {
+	var member domain.SubscriptionMember
+
+	if tx := conn(ctx, mr.db).First(&member, "id = ?", memberID); tx.Error != nil {
+		if isNotFound(tx.Error) {
+			return domain.SubscriptionMember{}, &domain.ErrDataNotFound{DataType: "member"}
+		}
+		return domain.SubscriptionMember{}, fmt.Errorf("error when querying member: %w", tx.Error)
+	}
+
+	return member, nil
+}
+
+func (mr *MemberRepository) List(ctx context.Context, subscriptionID string) ([]domain.SubscriptionMember, error) {
+	var members = []domain.SubscriptionMember{}
+
+	tx := conn(ctx, mr.db).
+		Where("subscription_id = ?", subscriptionID).
+		Order("invite_date").
+		Find(&members)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("error when querying members: %w", tx.Error)
+	}
+
+	return members, nil
+}
+
+// ListByUser returns the active memberships of the user in subscriptions paid by others.
+func (mr *MemberRepository) ListByUser(ctx context.Context, userID string) ([]domain.SubscriptionMember, error) {
+	var members = []domain.SubscriptionMember{}
+
+	tx := conn(ctx, mr.db).
+		Where("user_id = ? AND status = ?", userID, domain.MemberActive).
+		Order("accept_date").
+		Find(&members)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("error when querying memberships: %w", tx.Error)
+	}
+
+	return members, nil
+}
+
+func (mr *MemberRepository) Update(
+	ctx context.Context,
+	member domain.SubscriptionMember,
+	updates domain.ToUpdate,
+) (domain.SubscriptionMember, error) {
+	colAndVal := map[string]interface{}{}
+
+	for k, v := range updates {
+		colAndVal[string(k)] = v
+	}
+
+	tx := conn(ctx, mr.db).Model(&member).Select("*").Updates(colAndVal)
+	if tx.Error != nil {
+		return domain.SubscriptionMember{}, fmt.Errorf("error when updating member: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return domain.SubscriptionMember{}, &domain.ErrDataNotFound{DataType: "member"}
+	}
+
+	return member, nil
+}
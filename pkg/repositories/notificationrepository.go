@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NotificationSentAt is the column of the time a notification was sent. Its other columns are named as the
+// ones of webhook deliveries, e.g. DeliveryStatus.
+const NotificationSentAt domain.Column = "sent_at"
+
+type NotificationRepository struct {
+	db *gorm.DB
+}
+
+func NewNotificationRepository(db *gorm.DB) *NotificationRepository {
+	return &NotificationRepository{
+		db: db,
+	}
+}
+
+func (nr *NotificationRepository) Save(
+	ctx context.Context,
+	notification domain.Notification,
+) (domain.Notification, error) {
+	notificationID, err := uuid.NewRandom()
+	if err != nil {
+		return domain.Notification{}, fmt.Errorf("error when generating id for notification: %w", err)
+	}
+
+	now := time.Now()
+	notification.ID = notificationID.String()
+	notification.CreatedAt = now
+	notification.UpdatedAt = now
+
+	if tx := conn(ctx, nr.db).Create(&notification); tx.Error != nil {
+		return domain.Notification{}, fmt.Errorf("could not save new notification: %w", tx.Error)
+	}
+
+	return notification, nil
+}
+
+// Exists reports whether a notification was already queued for the event.
+func (nr *NotificationRepository) Exists(ctx context.Context, eventID string) (bool, error) {
+	var count int64
+
+	tx := conn(ctx, nr.db).Model(&domain.Notification{}).Where("event_id = ?", eventID).Count(&count)
+	if tx.Error != nil {
+		return false, fmt.Errorf("error when querying notifications: %w", tx.Error)
+	}
+
+	return count > 0, nil
+}
+
+// ListDue returns up to limit notifications whose next attempt is due at now, the oldest first.
+func (nr *NotificationRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]domain.Notification, error) {
+	var notifications = []domain.Notification{}
+
+	tx := conn(ctx, nr.db).
+		Where("next_attempt_at <= ?", now).
+		Order("next_attempt_at").
+		Order("created_at").
+		Limit(limit).
+		Find(&notifications)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("error when querying due notifications: %w", tx.Error)
+	}
+
+	return notifications, nil
+}
+
+func (nr *NotificationRepository) Update(
+	ctx context.Context,
+	notification domain.Notification,
+	updates domain.ToUpdate,
+) (domain.Notification, error) {
+	colAndVal := map[string]interface{}{}
+
+	for k, v := range updates {
+		colAndVal[string(k)] = v
+	}
+
+	tx := conn(ctx, nr.db).Model(&notification).Select("*").Updates(colAndVal)
+	if tx.Error != nil {
+		return domain.Notification{}, fmt.Errorf("error when updating notification: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return domain.Notification{}, &domain.ErrDataNotFound{DataType: "notification"}
+	}
+
+	return notification, nil
+}
+
+// DeleteByUser deletes the notifications of the user, sent or not.
+func (nr *NotificationRepository) DeleteByUser(ctx context.Context, userID string) error {
+	tx := conn(ctx, nr.db).Where("user_id = ?", userID).Delete(&domain.Notification{})
+	if tx.Error != nil {
+		return fmt.Errorf("error when deleting notifications of user: %w", tx.Error)
+	}
+
+	return nil
+}
+
+// DeleteFinished deletes the notifications sent or failed before the given time, returning how many were deleted.
+func (nr *NotificationRepository) DeleteFinished(ctx context.Context, before time.Time) (int64, error) {
+	tx := conn(ctx, nr.db).
+		Where("next_attempt_at IS NULL AND updated_at < ?", before).
+		Delete(&domain.Notification{})
+	if tx.Error != nil {
+		return 0, fmt.Errorf("error when deleting finished notifications: %w", tx.Error)
+	}
+
+	return tx.RowsAffected, nil
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OutboxRepository reads the events recorded by the changes of subscriptions, for them to be relayed.
+type OutboxRepository struct {
+	db *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) *OutboxRepository {
+	return &OutboxRepository{
+		db: db,
+	}
+}
+
+// ListPending returns up to limit events not published yet, in the order they were recorded.
+func (or *OutboxRepository) ListPending(ctx context.Context, limit int) ([]domain.Event, error) {
+	var events = []domain.Event{}
+
+	tx := conn(ctx, or.db).Where("published_at IS NULL").Order("sequence").Limit(limit).Find(&events)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("error when querying pending events: %w", tx.Error)
+	}
+
+	return events, nil
+}
+
+func (or *OutboxRepository) MarkPublished(ctx context.Context, event domain.Event, at time.Time) error {
+	tx := conn(ctx, or.db).Model(&event).Update("published_at", at)
+	if tx.Error != nil {
+		return fmt.Errorf("error when marking event as published: %w", tx.Error)
+	}
+
+	return nil
+}
+
+func (or *OutboxRepository) MarkFailed(ctx context.Context, event domain.Event, reason string) error {
+	tx := conn(ctx, or.db).Model(&event).Updates(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": reason,
+	})
+	if tx.Error != nil {
+		return fmt.Errorf("error when marking event as failed: %w", tx.Error)
+	}
+
+	return nil
+}
+
+// DeletePublished deletes the events published before the given time, returning how many were deleted.
+func (or *OutboxRepository) DeletePublished(ctx context.Context, before time.Time) (int64, error) {
+	tx := conn(ctx, or.db).Where("published_at < ?", before).Delete(&domain.Event{})
+	if tx.Error != nil {
+		return 0, fmt.Errorf("error when deleting published events: %w", tx.Error)
+	}
+
+	return tx.RowsAffected, nil
+}
+
+// recordEvents adds the events of a change of the subscription to the outbox, in the transaction of
+// the change. The subscription as changed is the data of every event.
+func recordEvents(tx *gorm.DB, subscription domain.Subscription, events []domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(subscription)
+	if err != nil {
+		return fmt.Errorf("error when encoding event data: %w", err)
+	}
+
+	now := time.Now()
+	for i := range events {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return fmt.Errorf("error when generating id for event: %w", err)
+		}
+
+		events[i].ID = id.String()
+		events[i].SubscriptionID = subscription.ID
+		events[i].UserID = subscription.UserID
+		events[i].Data = data
+		events[i].OccurredAt = now
+	}
+
+	if err := tx.Create(&events).Error; err != nil {
+		return fmt.Errorf("error when recording events: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"gorm.io/gorm"
+)
+
+const createdAtSort = "createdAt"
+
+// sortKey is a column lists can be sorted by.
+type sortKey struct {
+	column string
+	isTime bool
+}
+
+// cursor is the position of a page in a sorted list: the sort value and id of the item before the page.
+type cursor struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d,omitempty"`
+	Value  string `json:"v"`
+	ID     string `json:"id"`
+}
+
+// paginate restricts db to the page of a list of the table, sorted by one of the keys. One more item than
+// the limit is queried, to know whether a page follows.
+func paginate(db *gorm.DB, table string, keys map[string]sortKey, page domain.Page) (*gorm.DB, error) {
+	sortBy := page.SortBy
+	if sortBy == "" {
+		sortBy = createdAtSort
+	}
+
+	key, ok := keys[sortBy]
+	if !ok {
+		return nil, &domain.ErrInvalidArgument{Argument: "sort", Msg: "sort"}
+	}
+
+	order, after := "ASC", ">"
+	if page.Desc {
+		order, after = "DESC", "<"
+	}
+
+	if page.Cursor != "" {
+		c, value, err := decodeCursor(page, key)
+		if err != nil {
+			return nil, err
+		}
+
+		db = db.Where(
+			fmt.Sprintf("(%s %s ? OR (%s = ? AND %s.id %s ?))", key.column, after, key.column, table, after),
+			value, value, c.ID,
+		)
+	}
+
+	return db.
+		Order(fmt.Sprintf("%s %s, %s.id %s", key.column, order, table, order)).
+		Limit(page.Limit + 1), nil
+}
+
+// nextCursor returns the cursor of the page following the item with the given sort value and id.
+func nextCursor(page domain.Page, value interface{}, id string) string {
+	c := cursor{SortBy: page.SortBy, Desc: page.Desc, ID: id}
+
+	switch v := value.(type) {
+	case time.Time:
+		c.Value = v.Format(time.RFC3339Nano)
+	default:
+		c.Value = fmt.Sprint(v)
+	}
+
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(page domain.Page, key sortKey) (cursor, interface{}, error) {
+	errInvalidCursor := &domain.ErrInvalidArgument{Argument: "cursor", Msg: "cursor"}
+	var c cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+	if err != nil {
+		return cursor{}, nil, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return cursor{}, nil, errInvalidCursor
+	}
+	// cursors are only valid in the order they were returned for
+	if c.SortBy != page.SortBy || c.Desc != page.Desc {
+		return cursor{}, nil, errInvalidCursor
+	}
+
+	if !key.isTime {
+		return c, c.Value, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, c.Value)
+	if err != nil {
+		return cursor{}, nil, errInvalidCursor
+	}
+
+	return c, t, nil
+}
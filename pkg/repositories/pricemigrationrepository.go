@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	IsCanceled   domain.Column = "is_canceled"
+	CompleteDate domain.Column = "complete_date"
+)
+
+type PriceMigrationRepository struct {
+	db *gorm.DB
+}
+
+func NewPriceMigrationRepository(db *gorm.DB) *PriceMigrationRepository {
+	return &PriceMigrationRepository{
+		db: db,
+	}
+}
+
+func (pmr *PriceMigrationRepository) Save(
+	ctx context.Context,
+	migration domain.PriceMigration,
+) (domain.PriceMigration, error) {
+	migrationID, err := uuid.NewRandom()
+	if err != nil {
+		return domain.PriceMigration{}, fmt.Errorf("error when generating id for price migration: %w", err)
+	}
+
+	now := time.Now()
+	migration.ID = migrationID.String()
+	migration.CreatedAt = now
+	migration.UpdatedAt = now
+
+	if tx := conn(ctx, pmr.db).Create(&migration); tx.Error != nil {
+		return domain.PriceMigration{}, fmt.Errorf("could not save new price migration: %w", tx.Error)
+	}
+
+	return migration, nil
+}
+
+func (pmr *PriceMigrationRepository) Get(ctx context.Context, migrationID string) (domain.PriceMigration, error) {
+	var migration domain.PriceMigration
+
+	if tx := conn(ctx, pmr.db).First(&migration, "id = ?", migrationID); tx.Error != nil {
+		if isNotFound(tx.Error) {
+			return domain.PriceMigration{}, &domain.ErrDataNotFound{DataType: "price migration"}
+		}
+		return domain.PriceMigration{}, fmt.Errorf("error when querying price migration: %w", tx.Error)
+	}
+
+	return migration, nil
+}
+
+// ListDue returns the migrations neither canceled nor complete whose effective date is not after now,
+// the latest first.
+func (pmr *PriceMigrationRepository) ListDue(ctx context.Context, now time.Time) ([]domain.PriceMigration, error) {
+	var migrations = []domain.PriceMigration{}
+
+	tx := conn(ctx, pmr.db).
+		Where("is_canceled = ? AND complete_date IS NULL AND effective_date <= ?", false, now).
+		Order("effective_date DESC, created_at DESC").
+		Find(&migrations)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("error when querying due price migrations: %w", tx.Error)
+	}
+
+	return migrations, nil
+}
+
+// Update changes a migration that is neither canceled nor complete, so a migration being canceled and
+// completed at the same time ends up as either one, not both. ErrDataNotFound is returned otherwise.
+func (pmr *PriceMigrationRepository) Update(
+	ctx context.Context,
+	migration domain.PriceMigration,
+	updates domain.ToUpdate,
+) (domain.PriceMigration, error) {
+	colAndVal := map[string]interface{}{}
+
+	for k, v := range updates {
+		colAndVal[string(k)] = v
+	}
+
+	tx := conn(ctx, pmr.db).
+		Model(&migration).
+		Where("is_canceled = ? AND complete_date IS NULL", false).
+		Select("*").
+		Updates(colAndVal)
+	if tx.Error != nil {
+		return domain.PriceMigration{}, fmt.Errorf("error when updating price migration: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return domain.PriceMigration{}, &domain.ErrDataNotFound{DataType: "price migration"}
+	}
+
+	return migration, nil
+}
@@ -1,7 +1,7 @@
 package repositories
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"time"
 
@@ -10,6 +10,19 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	Name        domain.Column = "name"
+	IsRetired   domain.Column = "is_retired"
+	RetireDate  domain.Column = "retire_date"
+	IsArchived  domain.Column = "is_archived"
+	ArchiveDate domain.Column = "archive_date"
+)
+
+var productSortKeys = map[string]sortKey{
+	createdAtSort: {column: "products.created_at", isTime: true},
+	"name":        {column: "products.name"},
+}
+
 type ProductRepository struct {
 	db *gorm.DB
 }
@@ -20,7 +33,7 @@ func NewProductRepository(db *gorm.DB) *ProductRepository {
 	}
 }
 
-func (pr *ProductRepository) Save(product domain.Product) (domain.Product, error) {
+func (pr *ProductRepository) Save(ctx context.Context, product domain.Product) (domain.Product, error) {
 	now := time.Now()
 	productID, err := uuid.NewRandom()
 	if err != nil {
@@ -29,6 +42,9 @@ func (pr *ProductRepository) Save(product domain.Product) (domain.Product, error
 	product.ID = productID.String()
 	product.CreatedAt = now
 	product.UpdatedAt = now
+	product.Version = 1
+	product.IsArchived = false
+	product.ArchiveDate = nil
 
 	for i := range product.ProductPlans {
 		id, err := uuid.NewRandom()
@@ -39,20 +55,52 @@ func (pr *ProductRepository) Save(product domain.Product) (domain.Product, error
 		product.ProductPlans[i].CreatedAt = now
 		product.ProductPlans[i].UpdatedAt = now
 		product.ProductPlans[i].ProductID = product.ID
+		product.ProductPlans[i].Version = 1
+		product.ProductPlans[i].PreviousPlanID = ""
+		product.ProductPlans[i].IsRetired = false
+		product.ProductPlans[i].RetireDate = nil
 	}
 
-	if tx := pr.db.Create(product); tx.Error != nil {
+	for i := range product.AddOns {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return domain.Product{}, fmt.Errorf("error when generating id for add-on: %w", err)
+		}
+		product.AddOns[i].ID = id.String()
+		product.AddOns[i].CreatedAt = now
+		product.AddOns[i].UpdatedAt = now
+		product.AddOns[i].ProductID = product.ID
+	}
+
+	for i := range product.Entitlements {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return domain.Product{}, fmt.Errorf("error when generating id for entitlement: %w", err)
+		}
+		product.Entitlements[i].ID = id.String()
+		product.Entitlements[i].CreatedAt = now
+		product.Entitlements[i].UpdatedAt = now
+		product.Entitlements[i].ProductID = product.ID
+	}
+
+	if tx := conn(ctx, pr.db).Omit("Bundle.*").Create(product); tx.Error != nil {
 		return domain.Product{}, fmt.Errorf("could not save new product: %w", tx.Error)
 	}
 
 	return product, nil
 }
 
-func (pr *ProductRepository) Get(productID string) (domain.Product, error) {
+func (pr *ProductRepository) Get(ctx context.Context, productID string) (domain.Product, error) {
 	var product domain.Product
 
-	if tx := pr.db.Preload("ProductPlans").Find(&product, "id = ?", productID); tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+	tx := conn(ctx, pr.db).
+		Preload("ProductPlans", currentPlans).
+		Preload("AddOns").
+		Preload("Entitlements").
+		Preload("Bundle").
+		First(&product, "id = ?", productID)
+	if tx.Error != nil {
+		if isNotFound(tx.Error) {
 			return domain.Product{}, &domain.ErrDataNotFound{DataType: "product"}
 		}
 		return domain.Product{}, fmt.Errorf("error when querying product: %w", tx.Error)
@@ -61,15 +109,234 @@ func (pr *ProductRepository) Get(productID string) (domain.Product, error) {
 	return product, nil
 }
 
-func (pr *ProductRepository) List() ([]domain.Product, error) {
+// List returns a page of the products selected by the filter, and the cursor of the next page, empty for
+// the last one. Archived products are left out.
+func (pr *ProductRepository) List(
+	ctx context.Context,
+	filter domain.ProductFilter,
+	page domain.Page,
+) ([]domain.Product, string, error) {
 	var products = []domain.Product{}
 
-	if tx := pr.db.Preload("ProductPlans").Find(&products); tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrRecordNotFound) || len(products) == 0 {
-			return products, &domain.ErrDataNotFound{DataType: "product list"}
+	db := conn(ctx, pr.db).Model(&domain.Product{}).Where("products.is_archived = ?", false)
+	if !filter.CreatedFrom.IsZero() {
+		db = db.Where("products.created_at >= ?", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		db = db.Where("products.created_at < ?", filter.CreatedTo)
+	}
+	if filter.Interval.Unit != "" {
+		plans := currentPlans(conn(ctx, pr.db).Model(&domain.ProductPlan{})).
+			Select("product_id").
+			Where("interval_unit = ?", filter.Interval.Unit)
+		if filter.Interval.Count != 0 {
+			plans = plans.Where("interval_count = ?", filter.Interval.Count)
+		}
+		db = db.Where("products.id IN (?)", plans)
+	}
+
+	db, err := paginate(db, "products", productSortKeys, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tx := db.
+		Preload("ProductPlans", currentPlans).
+		Preload("AddOns").
+		Preload("Entitlements").
+		Preload("Bundle").
+		Find(&products)
+	if tx.Error != nil {
+		return nil, "", fmt.Errorf("error when querying products: %w", tx.Error)
+	}
+
+	next := ""
+	if len(products) > page.Limit {
+		products = products[:page.Limit]
+		last := products[len(products)-1]
+		next = nextCursor(page, productSortValue(last, page.SortBy), last.ID)
+	}
+
+	return products, next, nil
+}
+
+func (pr *ProductRepository) Update(
+	ctx context.Context,
+	product domain.Product,
+	updates domain.ToUpdate,
+) (domain.Product, error) {
+	colAndVal := map[string]interface{}{}
+
+	for k, v := range updates {
+		colAndVal[string(k)] = v
+	}
+
+	version := product.Version
+	colAndVal[string(Version)] = version + 1
+
+	tx := conn(ctx, pr.db).Model(&product).Where("version = ?", version).Select("*").Updates(colAndVal)
+	if tx.Error != nil {
+		return domain.Product{}, fmt.Errorf("error when updating product: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return domain.Product{}, notUpdated(conn(ctx, pr.db), &domain.Product{}, product.ID, "product")
+	}
+	product.Version = version + 1
+
+	return product, nil
+}
+
+func (pr *ProductRepository) SavePlan(ctx context.Context, plan domain.ProductPlan) (domain.ProductPlan, error) {
+	plan, err := newPlanVersion(plan, 1, "")
+	if err != nil {
+		return domain.ProductPlan{}, err
+	}
+
+	if tx := conn(ctx, pr.db).Create(&plan); tx.Error != nil {
+		return domain.ProductPlan{}, fmt.Errorf("could not save new product plan: %w", tx.Error)
+	}
+
+	return plan, nil
+}
+
+func (pr *ProductRepository) GetPlan(ctx context.Context, productID, planID string) (domain.ProductPlan, error) {
+	plan := domain.ProductPlan{Plan: &domain.Plan{}}
+
+	if tx := conn(ctx, pr.db).First(&plan, "id = ? AND product_id = ?", planID, productID); tx.Error != nil {
+		if isNotFound(tx.Error) {
+			return domain.ProductPlan{}, &domain.ErrDataNotFound{DataType: "product plan"}
+		}
+		return domain.ProductPlan{}, fmt.Errorf("error when querying product plan: %w", tx.Error)
+	}
+
+	return plan, nil
+}
+
+func (pr *ProductRepository) SavePlanVersion(
+	ctx context.Context,
+	previous domain.ProductPlan,
+	next domain.ProductPlan,
+) (domain.ProductPlan, error) {
+	next.ProductID = previous.ProductID
+	next, err := newPlanVersion(next, previous.Version+1, previous.ID)
+	if err != nil {
+		return domain.ProductPlan{}, err
+	}
+
+	err = conn(ctx, pr.db).Transaction(func(tx *gorm.DB) error {
+		if txErr := retirePlan(tx, previous, next.CreatedAt); txErr != nil {
+			return txErr
 		}
-		return nil, fmt.Errorf("error when querying products: %w", tx.Error)
+
+		return tx.Create(&next).Error
+	})
+	if err != nil {
+		return domain.ProductPlan{}, fmt.Errorf("error when saving product plan version: %w", err)
+	}
+
+	return next, nil
+}
+
+func (pr *ProductRepository) RetirePlan(ctx context.Context, plan domain.ProductPlan) (domain.ProductPlan, error) {
+	now := time.Now()
+
+	if err := retirePlan(conn(ctx, pr.db), plan, now); err != nil {
+		return domain.ProductPlan{}, fmt.Errorf("error when retiring product plan: %w", err)
+	}
+
+	plan.IsRetired = true
+	plan.RetireDate = &now
+
+	return plan, nil
+}
+
+func (pr *ProductRepository) SaveAddOn(ctx context.Context, addOn domain.AddOn) (domain.AddOn, error) {
+	addOnID, err := uuid.NewRandom()
+	if err != nil {
+		return domain.AddOn{}, fmt.Errorf("error when generating id for add-on: %w", err)
+	}
+
+	now := time.Now()
+	addOn.ID = addOnID.String()
+	addOn.CreatedAt = now
+	addOn.UpdatedAt = now
+
+	if tx := conn(ctx, pr.db).Create(&addOn); tx.Error != nil {
+		return domain.AddOn{}, fmt.Errorf("could not save new add-on: %w", tx.Error)
+	}
+
+	return addOn, nil
+}
+
+func (pr *ProductRepository) SaveEntitlement(
+	ctx context.Context,
+	entitlement domain.Entitlement,
+) (domain.Entitlement, error) {
+	entitlementID, err := uuid.NewRandom()
+	if err != nil {
+		return domain.Entitlement{}, fmt.Errorf("error when generating id for entitlement: %w", err)
+	}
+
+	now := time.Now()
+	entitlement.ID = entitlementID.String()
+	entitlement.CreatedAt = now
+	entitlement.UpdatedAt = now
+
+	if tx := conn(ctx, pr.db).Create(&entitlement); tx.Error != nil {
+		return domain.Entitlement{}, fmt.Errorf("could not save new entitlement: %w", tx.Error)
+	}
+
+	return entitlement, nil
+}
+
+func retirePlan(db *gorm.DB, plan domain.ProductPlan, retireDate time.Time) error {
+	tx := db.Model(&plan).Select("*").Updates(map[string]interface{}{
+		string(IsRetired):  true,
+		string(RetireDate): retireDate,
+	})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return &domain.ErrDataNotFound{DataType: "product plan"}
+	}
+
+	return nil
+}
+
+func newPlanVersion(plan domain.ProductPlan, version int, previousPlanID string) (domain.ProductPlan, error) {
+	planID, err := uuid.NewRandom()
+	if err != nil {
+		return domain.ProductPlan{}, fmt.Errorf("error when generating id for product plan: %w", err)
+	}
+
+	now := time.Now()
+	plan.Plan = &domain.Plan{
+		ID:        planID.String(),
+		Interval:  plan.Interval,
+		Price:     plan.Price,
+		Tax:       plan.Tax,
+		MaxSeats:  plan.MaxSeats,
+		SeatPrice: plan.SeatPrice,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	plan.Version = version
+	plan.PreviousPlanID = previousPlanID
+	plan.IsRetired = false
+	plan.RetireDate = nil
+
+	return plan, nil
+}
+
+func currentPlans(db *gorm.DB) *gorm.DB {
+	return db.Where("is_retired = ?", false)
+}
+
+func productSortValue(product domain.Product, sortBy string) interface{} {
+	if sortBy == "name" {
+		return product.Name
 	}
 
-	return products, nil
+	return product.CreatedAt
 }
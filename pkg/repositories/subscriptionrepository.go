@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -9,15 +10,30 @@ import (
 	"github.com/dnawand/go-membershipapi/pkg/domain"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const (
-	EndDate   domain.Column = "end_date"
-	PauseDate domain.Column = "pause_date"
-	IsPaused  domain.Column = "is_paused"
-	IsActive  domain.Column = "is_active"
+	EndDate         domain.Column = "end_date"
+	PauseDate       domain.Column = "pause_date"
+	PausedEndDate   domain.Column = "paused_end_date"
+	RenewalAnchor   domain.Column = "renewal_anchor"
+	CancelDate      domain.Column = "cancel_date"
+	TrialNoticeDate domain.Column = "trial_notice_date"
+	IsPaused        domain.Column = "is_paused"
+	IsActive        domain.Column = "is_active"
+	Version         domain.Column = "version"
+
+	Price            domain.Column = "price"
+	Tax              domain.Column = "tax"
+	PriceMigrationID domain.Column = "price_migration_id"
 )
 
+var subscriptionSortKeys = map[string]sortKey{
+	createdAtSort: {column: "subscriptions.created_at", isTime: true},
+	"startDate":   {column: "subscriptions.start_date", isTime: true},
+}
+
 type SubscriptionRepository struct {
 	db             *gorm.DB
 	voucherStorage *storage.Store
@@ -30,7 +46,13 @@ func NewSubscriptionRepository(db *gorm.DB, vs *storage.Store) *SubscriptionRepo
 	}
 }
 
-func (sr *SubscriptionRepository) Save(user domain.User) (domain.Subscription, error) {
+// Save saves the only subscription of the user, and records the events of its creation in the same
+// transaction.
+func (sr *SubscriptionRepository) Save(
+	ctx context.Context,
+	user domain.User,
+	events ...domain.Event,
+) (domain.Subscription, error) {
 	if len(user.Subscriptions) != 1 {
 		return domain.Subscription{}, &domain.ErrInvalidArgument{Msg: "user must have at least one subscription"}
 	}
@@ -45,11 +67,12 @@ func (sr *SubscriptionRepository) Save(user domain.User) (domain.Subscription, e
 	user.Subscriptions[subscriptionIndex].ID = subscriptionID
 	user.Subscriptions[subscriptionIndex].CreatedAt = now
 	user.Subscriptions[subscriptionIndex].UpdatedAt = now
+	user.Subscriptions[subscriptionIndex].Version = 1
 	user.Subscriptions[subscriptionIndex].SubscriptionPlan.ID = subscriptionPlanID
 	userSubscription := user.Subscriptions[subscriptionIndex]
 	userSubscription.SubscriptionPlan.SubscriptionID = userSubscription.ID
 
-	err = sr.db.Transaction(func(tx *gorm.DB) error {
+	err = conn(ctx, sr.db).Transaction(func(tx *gorm.DB) error {
 		txErr := tx.Model(&user).Association("Subscriptions").Append(&userSubscription)
 		if txErr != nil {
 			return txErr
@@ -60,7 +83,7 @@ func (sr *SubscriptionRepository) Save(user domain.User) (domain.Subscription, e
 			return txErr
 		}
 
-		return nil
+		return recordEvents(tx, userSubscription, events)
 	})
 	if err != nil {
 		return domain.Subscription{}, fmt.Errorf("error when saving subscription: %w", err)
@@ -69,65 +92,243 @@ func (sr *SubscriptionRepository) Save(user domain.User) (domain.Subscription, e
 	return user.Subscriptions[subscriptionIndex], nil
 }
 
-func (sr *SubscriptionRepository) Get(subscriptionID string) (domain.Subscription, error) {
+func (sr *SubscriptionRepository) Get(ctx context.Context, subscriptionID string) (domain.Subscription, error) {
+	return sr.get(conn(ctx, sr.db), subscriptionID)
+}
+
+// GetForUpdate gets the subscription and locks it until the end of the unit of work running in ctx.
+func (sr *SubscriptionRepository) GetForUpdate(ctx context.Context, subscriptionID string) (domain.Subscription, error) {
+	return sr.get(conn(ctx, sr.db).Clauses(clause.Locking{Strength: "UPDATE"}), subscriptionID)
+}
+
+func (sr *SubscriptionRepository) get(db *gorm.DB, subscriptionID string) (domain.Subscription, error) {
 	var subscription domain.Subscription
 
-	tx := sr.db.
+	tx := db.
 		Preload("Product").
 		Preload("SubscriptionPlan").
-		Find(&subscription, "id = ?", subscriptionID)
+		First(&subscription, "id = ?", subscriptionID)
 	if tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
-			return domain.Subscription{}, &domain.ErrDataNotFound{DataType: "product"}
+		if isNotFound(tx.Error) {
+			return domain.Subscription{}, &domain.ErrDataNotFound{DataType: "subscription"}
 		}
 		return domain.Subscription{}, fmt.Errorf("error when getting subscription from db: %w", tx.Error)
 	}
 
-	data, ok := sr.voucherStorage.Load(subscription.SubscriptionPlan.VoucherID)
-	if ok {
-		voucher, _ := data.(domain.Voucher)
-		subscription.SubscriptionPlan.Voucher = &voucher
-	}
+	sr.loadVoucher(&subscription)
 
 	return subscription, nil
 }
 
-func (sr *SubscriptionRepository) List(userID string) ([]domain.Subscription, error) {
+// List returns a page of the subscriptions selected by the filter, and the cursor of the next page, empty
+// for the last one. Listing the subscriptions of a user that does not exist fails with ErrDataNotFound.
+func (sr *SubscriptionRepository) List(
+	ctx context.Context,
+	filter domain.SubscriptionFilter,
+	page domain.Page,
+) ([]domain.Subscription, string, error) {
 	var subscriptions = []domain.Subscription{}
 
-	tx := sr.db.
+	db := conn(ctx, sr.db).Model(&domain.Subscription{})
+	if filter.UserID != "" {
+		if tx := conn(ctx, sr.db).Select("id").First(&domain.User{}, "id = ?", filter.UserID); tx.Error != nil {
+			if isNotFound(tx.Error) {
+				return nil, "", &domain.ErrDataNotFound{DataType: "user"}
+			}
+			return nil, "", fmt.Errorf("error when querying subscriptions owner: %w", tx.Error)
+		}
+		db = db.Where("subscriptions.user_id = ?", filter.UserID)
+	}
+	switch filter.Status {
+	case domain.SubscriptionActive:
+		db = db.Where("subscriptions.is_active = ? AND subscriptions.is_paused = ?", true, false)
+	case domain.SubscriptionPaused:
+		db = db.Where("subscriptions.is_active = ? AND subscriptions.is_paused = ?", true, true)
+	case domain.SubscriptionCanceled:
+		db = db.Where("subscriptions.is_active = ?", false)
+	}
+	if filter.UserEmail != "" {
+		users := conn(ctx, sr.db).Model(&domain.User{}).Select("id").Where("email = ?", filter.UserEmail)
+		db = db.Where("subscriptions.user_id IN (?)", users)
+	}
+	if filter.ProductID != "" {
+		db = db.Where("subscriptions.product_id = ?", filter.ProductID)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		db = db.Where("subscriptions.created_at >= ?", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		db = db.Where("subscriptions.created_at < ?", filter.CreatedTo)
+	}
+	if !filter.TrialEndFrom.IsZero() {
+		db = db.Where("subscriptions.trial_date >= ?", filter.TrialEndFrom)
+	}
+	if !filter.TrialEndTo.IsZero() {
+		db = db.Where("subscriptions.trial_date < ?", filter.TrialEndTo)
+	}
+	if !filter.EndFrom.IsZero() {
+		db = db.Where("subscriptions.end_date >= ?", filter.EndFrom)
+	}
+	if !filter.EndTo.IsZero() {
+		db = db.Where("subscriptions.end_date < ?", filter.EndTo)
+	}
+	if filter.PlanID != "" || filter.VoucherID != "" || filter.Interval.Unit != "" {
+		plans := conn(ctx, sr.db).Model(&domain.SubscriptionPlan{}).Select("subscription_id")
+		if filter.PlanID != "" {
+			plans = plans.Where("product_plan_id = ?", filter.PlanID)
+		}
+		if filter.VoucherID != "" {
+			plans = plans.Where("voucher_id = ?", filter.VoucherID)
+		}
+		if filter.Interval.Unit != "" {
+			plans = plans.Where("interval_unit = ?", filter.Interval.Unit)
+		}
+		if filter.Interval.Count != 0 {
+			plans = plans.Where("interval_count = ?", filter.Interval.Count)
+		}
+		db = db.Where("subscriptions.id IN (?)", plans)
+	}
+
+	db, err := paginate(db, "subscriptions", subscriptionSortKeys, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tx := db.
 		Preload("Product").
 		Preload("SubscriptionPlan").
-		Joins("right join users on users.id = subscriptions.user_id").
-		Where("user_id = ?", userID).
 		Find(&subscriptions)
 	if tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrRecordNotFound) || len(subscriptions) == 0 {
-			return subscriptions, &domain.ErrDataNotFound{DataType: "subscription list"}
+		// ids that PostgreSQL can't compare to its uuids select nothing
+		if isNotFound(tx.Error) {
+			return []domain.Subscription{}, "", nil
 		}
-		return nil, fmt.Errorf("error when querying subscriptions: %w", tx.Error)
+		return nil, "", fmt.Errorf("error when querying subscriptions: %w", tx.Error)
 	}
 
-	return subscriptions, nil
+	next := ""
+	if len(subscriptions) > page.Limit {
+		subscriptions = subscriptions[:page.Limit]
+		last := subscriptions[len(subscriptions)-1]
+		next = nextCursor(page, subscriptionSortValue(last, page.SortBy), last.ID)
+	}
+
+	for i := range subscriptions {
+		sr.loadVoucher(&subscriptions[i])
+	}
+
+	return subscriptions, next, nil
 }
 
-func (sr *SubscriptionRepository) Update(subscription domain.Subscription, updates domain.ToUpdate) (domain.Subscription, error) {
+// Update applies the updates to the subscription if it's still at the version read, and records the
+// events of the change in the same transaction.
+func (sr *SubscriptionRepository) Update(
+	ctx context.Context,
+	subscription domain.Subscription,
+	updates domain.ToUpdate,
+	events ...domain.Event,
+) (domain.Subscription, error) {
 	colAndVal := map[string]interface{}{}
 
 	for k, v := range updates {
 		colAndVal[string(k)] = v
 	}
 
-	if tx := sr.db.Model(&subscription).Select("*").Updates(colAndVal); tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
-			return domain.Subscription{}, &domain.ErrDataNotFound{DataType: "subscription"}
+	version := subscription.Version
+	colAndVal[string(Version)] = version + 1
+
+	err := conn(ctx, sr.db).Transaction(func(tx *gorm.DB) error {
+		// the update only applies to the version read, so that concurrent changes can't overwrite each other
+		result := tx.Model(&subscription).Where("version = ?", version).Select("*").Updates(colAndVal)
+		if result.Error != nil {
+			return fmt.Errorf("error when updating subscription: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return notUpdated(tx, &domain.Subscription{}, subscription.ID, "subscription")
 		}
-		return domain.Subscription{}, fmt.Errorf("error when updating subscription: %w", tx.Error)
+		subscription.Version = version + 1
+
+		return recordEvents(tx, subscription, events)
+	})
+	if err != nil {
+		return domain.Subscription{}, err
 	}
 
 	return subscription, nil
 }
 
+func (sr *SubscriptionRepository) ListByProductPlan(
+	ctx context.Context,
+	productPlanID string,
+) ([]domain.Subscription, error) {
+	var subscriptions = []domain.Subscription{}
+
+	subscriptionIDs := conn(ctx, sr.db).
+		Model(&domain.SubscriptionPlan{}).
+		Select("subscription_id").
+		Where("product_plan_id = ?", productPlanID)
+
+	tx := conn(ctx, sr.db).
+		Preload("Product").
+		Preload("SubscriptionPlan").
+		Where("is_active = ? AND id IN (?)", true, subscriptionIDs).
+		Find(&subscriptions)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("error when querying subscriptions by product plan: %w", tx.Error)
+	}
+
+	for i := range subscriptions {
+		sr.loadVoucher(&subscriptions[i])
+	}
+
+	return subscriptions, nil
+}
+
+func (sr *SubscriptionRepository) UpdatePlan(
+	ctx context.Context,
+	plan domain.SubscriptionPlan,
+	updates domain.ToUpdate,
+) (domain.SubscriptionPlan, error) {
+	colAndVal := map[string]interface{}{}
+
+	for k, v := range updates {
+		colAndVal[string(k)] = v
+	}
+
+	// the plan is part of the subscription, so its version changes as well
+	err := conn(ctx, sr.db).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&plan).Select("*").Updates(colAndVal)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &domain.ErrDataNotFound{DataType: "subscription plan"}
+		}
+
+		return tx.Model(&domain.Subscription{}).
+			Where("id = ?", plan.SubscriptionID).
+			UpdateColumn(string(Version), gorm.Expr("version + 1")).
+			Error
+	})
+	if err != nil {
+		var errDataNotFound *domain.ErrDataNotFound
+		if errors.As(err, &errDataNotFound) {
+			return domain.SubscriptionPlan{}, err
+		}
+		return domain.SubscriptionPlan{}, fmt.Errorf("error when updating subscription plan: %w", err)
+	}
+
+	return plan, nil
+}
+
+func (sr *SubscriptionRepository) loadVoucher(subscription *domain.Subscription) {
+	data, ok := sr.voucherStorage.Load(subscription.SubscriptionPlan.VoucherID)
+	if ok {
+		voucher, _ := data.(domain.Voucher)
+		subscription.SubscriptionPlan.Voucher = &voucher
+	}
+}
+
 func generateIDs() (string, string, error) {
 	subscriptionUUID, err := uuid.NewRandom()
 	if err != nil {
@@ -141,3 +342,11 @@ func generateIDs() (string, string, error) {
 
 	return subscriptionUUID.String(), subscriptionPlanUUID.String(), nil
 }
+
+func subscriptionSortValue(subscription domain.Subscription, sortBy string) interface{} {
+	if sortBy == "startDate" {
+		return subscription.StartDate
+	}
+
+	return subscription.CreatedAt
+}
@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	maxAttempts  = 3
+	retryBackoff = 20 * time.Millisecond
+)
+
+type txKey struct{}
+
+// UnitOfWork runs functions in a database transaction carried by their context, so that every
+// repository called with that context takes part in it.
+type UnitOfWork struct {
+	db *gorm.DB
+}
+
+func NewUnitOfWork(db *gorm.DB) *UnitOfWork {
+	return &UnitOfWork{
+		db: db,
+	}
+}
+
+// Do runs fn in a transaction, committed when fn returns nil and rolled back otherwise. Transactions
+// failing because of a concurrent one are retried, so fn must not have effects outside the database.
+// Called within another unit of work, fn joins its transaction.
+func (uow *UnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := uow.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(context.WithValue(ctx, txKey{}, tx))
+		})
+		if err == nil || attempt == maxAttempts || !isSerializationFailure(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		}
+	}
+}
+
+// conn returns the transaction of the unit of work running in ctx, or db outside of one.
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+
+	return db.WithContext(ctx)
+}
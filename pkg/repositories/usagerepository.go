@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type UsageRepository struct {
+	db *gorm.DB
+}
+
+func NewUsageRepository(db *gorm.DB) *UsageRepository {
+	return &UsageRepository{
+		db: db,
+	}
+}
+
+func (ur *UsageRepository) Save(ctx context.Context, record domain.UsageRecord) (domain.UsageRecord, error) {
+	recordID, err := uuid.NewRandom()
+	if err != nil {
+		return domain.UsageRecord{}, fmt.Errorf("error when generating id for usage record: %w", err)
+	}
+
+	record.ID = recordID.String()
+	record.CreatedAt = time.Now()
+
+	if tx := conn(ctx, ur.db).Create(&record); tx.Error != nil {
+		return domain.UsageRecord{}, fmt.Errorf("could not save new usage record: %w", tx.Error)
+	}
+
+	return record, nil
+}
+
+// List returns the usage records of the subscription with a usage date in [from, to).
+func (ur *UsageRepository) List(
+	ctx context.Context,
+	subscriptionID string,
+	from, to time.Time,
+) ([]domain.UsageRecord, error) {
+	var records = []domain.UsageRecord{}
+
+	tx := conn(ctx, ur.db).
+		Where("subscription_id = ? AND usage_date >= ? AND usage_date < ?", subscriptionID, from, to).
+		Order("usage_date").
+		Find(&records)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("error when querying usage records: %w", tx.Error)
+	}
+
+	return records, nil
+}
@@ -1,7 +1,7 @@
 package repositories
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"log"
 	"time"
@@ -9,6 +9,13 @@ import (
 	"github.com/dnawand/go-membershipapi/pkg/domain"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	Email    domain.Column = "email"
+	ErasedAt domain.Column = "erased_at"
+	Locale   domain.Column = "locale"
 )
 
 type UserRepository struct {
@@ -21,7 +28,7 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	}
 }
 
-func (ur *UserRepository) Save(user domain.User) (domain.User, error) {
+func (ur *UserRepository) Save(ctx context.Context, user domain.User) (domain.User, error) {
 	newUUID, err := uuid.NewRandom()
 	if err != nil {
 		log.Printf("error when generating id for user: %s\n", err.Error())
@@ -33,20 +40,34 @@ func (ur *UserRepository) Save(user domain.User) (domain.User, error) {
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
-	ur.db.Create(&user)
+	if tx := conn(ctx, ur.db).Create(&user); tx.Error != nil {
+		if isUniqueViolation(tx.Error) {
+			return domain.User{}, &domain.ErrConflict{DataType: "user", Field: "email"}
+		}
+		return domain.User{}, fmt.Errorf("could not save new user: %w", tx.Error)
+	}
 
 	return user, nil
 }
 
-func (ur *UserRepository) Get(userID string) (domain.User, error) {
+func (ur *UserRepository) Get(ctx context.Context, userID string) (domain.User, error) {
+	return ur.get(conn(ctx, ur.db), userID)
+}
+
+// GetForUpdate gets the user and locks it until the end of the unit of work running in ctx.
+func (ur *UserRepository) GetForUpdate(ctx context.Context, userID string) (domain.User, error) {
+	return ur.get(conn(ctx, ur.db).Clauses(clause.Locking{Strength: "UPDATE"}), userID)
+}
+
+func (ur *UserRepository) get(db *gorm.DB, userID string) (domain.User, error) {
 	var user domain.User
 
-	tx := ur.db.
+	tx := db.
 		Preload("Subscriptions.Product").
 		Preload("Subscriptions.SubscriptionPlan").
-		Find(&user, "id = ?", userID)
+		First(&user, "id = ?", userID)
 	if tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		if isNotFound(tx.Error) {
 			return domain.User{}, &domain.ErrDataNotFound{DataType: "user"}
 		}
 		return domain.User{}, fmt.Errorf("error when querying user: %w", tx.Error)
@@ -54,3 +75,94 @@ func (ur *UserRepository) Get(userID string) (domain.User, error) {
 
 	return user, nil
 }
+
+func (ur *UserRepository) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	var user domain.User
+
+	if tx := conn(ctx, ur.db).First(&user, "email = ?", email); tx.Error != nil {
+		if isNotFound(tx.Error) {
+			return domain.User{}, &domain.ErrDataNotFound{DataType: "user"}
+		}
+		return domain.User{}, fmt.Errorf("error when querying user by email: %w", tx.Error)
+	}
+
+	return user, nil
+}
+
+func (ur *UserRepository) Update(ctx context.Context, user domain.User, updates domain.ToUpdate) (domain.User, error) {
+	colAndVal := map[string]interface{}{}
+
+	for k, v := range updates {
+		colAndVal[string(k)] = v
+	}
+
+	tx := conn(ctx, ur.db).Model(&user).Select("*").Updates(colAndVal)
+	if tx.Error != nil {
+		if isUniqueViolation(tx.Error) {
+			return domain.User{}, &domain.ErrConflict{DataType: "user", Field: "email"}
+		}
+		return domain.User{}, fmt.Errorf("error when updating user: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return domain.User{}, &domain.ErrDataNotFound{DataType: "user"}
+	}
+
+	return user, nil
+}
+
+// Delete soft deletes the user, keeping its subscriptions as history.
+func (ur *UserRepository) Delete(ctx context.Context, user domain.User) error {
+	if tx := conn(ctx, ur.db).Delete(&user); tx.Error != nil {
+		return fmt.Errorf("error when deleting user: %w", tx.Error)
+	}
+
+	return nil
+}
+
+// Erase overwrites the personal data of a user, deleted or not, with the anonymized values of the
+// given user and soft deletes it. The memberships and invitations of the user in group subscriptions
+// get the anonymized email as well.
+func (ur *UserRepository) Erase(ctx context.Context, user domain.User) (domain.User, error) {
+	db := conn(ctx, ur.db)
+
+	var current domain.User
+	if tx := db.Unscoped().Select("email").First(&current, "id = ?", user.ID); tx.Error != nil {
+		if isNotFound(tx.Error) {
+			return domain.User{}, &domain.ErrDataNotFound{DataType: "user"}
+		}
+		return domain.User{}, fmt.Errorf("error when getting user to erase: %w", tx.Error)
+	}
+
+	tx := db.
+		Unscoped().
+		Model(&domain.SubscriptionMember{}).
+		Where("user_id = ? OR LOWER(email) = LOWER(?)", user.ID, current.Email).
+		Updates(map[string]interface{}{
+			"email":      user.Email,
+			"updated_at": time.Now(),
+		})
+	if tx.Error != nil {
+		return domain.User{}, fmt.Errorf("error when erasing memberships of user: %w", tx.Error)
+	}
+
+	tx = db.
+		Unscoped().
+		Model(&domain.User{}).
+		Where("id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"name":       user.Name,
+			"email":      user.Email,
+			"locale":     user.Locale,
+			"erased_at":  user.ErasedAt,
+			"deleted_at": gorm.Expr("COALESCE(deleted_at, ?)", user.ErasedAt),
+			"updated_at": time.Now(),
+		})
+	if tx.Error != nil {
+		return domain.User{}, fmt.Errorf("error when erasing user: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return domain.User{}, &domain.ErrDataNotFound{DataType: "user"}
+	}
+
+	return user, nil
+}
@@ -0,0 +1,162 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DeliveryStatus         domain.Column = "status"
+	DeliveryAttempts       domain.Column = "attempts"
+	DeliveryResponseStatus domain.Column = "response_status"
+	DeliveryLastError      domain.Column = "last_error"
+	DeliveryNextAttemptAt  domain.Column = "next_attempt_at"
+	DeliveryDeliveredAt    domain.Column = "delivered_at"
+)
+
+var deliverySortKeys = map[string]sortKey{
+	createdAtSort: {column: "webhook_deliveries.created_at", isTime: true},
+}
+
+type WebhookDeliveryRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookDeliveryRepository(db *gorm.DB) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{
+		db: db,
+	}
+}
+
+func (dr *WebhookDeliveryRepository) Save(
+	ctx context.Context,
+	delivery domain.WebhookDelivery,
+) (domain.WebhookDelivery, error) {
+	deliveryID, err := uuid.NewRandom()
+	if err != nil {
+		return domain.WebhookDelivery{}, fmt.Errorf("error when generating id for webhook delivery: %w", err)
+	}
+
+	now := time.Now()
+	delivery.ID = deliveryID.String()
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+
+	if tx := conn(ctx, dr.db).Create(&delivery); tx.Error != nil {
+		return domain.WebhookDelivery{}, fmt.Errorf("could not save new webhook delivery: %w", tx.Error)
+	}
+
+	return delivery, nil
+}
+
+func (dr *WebhookDeliveryRepository) Get(ctx context.Context, deliveryID string) (domain.WebhookDelivery, error) {
+	var delivery domain.WebhookDelivery
+
+	if tx := conn(ctx, dr.db).First(&delivery, "id = ?", deliveryID); tx.Error != nil {
+		if isNotFound(tx.Error) {
+			return domain.WebhookDelivery{}, &domain.ErrDataNotFound{DataType: "delivery"}
+		}
+		return domain.WebhookDelivery{}, fmt.Errorf("error when querying webhook delivery: %w", tx.Error)
+	}
+
+	return delivery, nil
+}
+
+// Exists reports whether the event was already queued for the endpoint, replays aside.
+func (dr *WebhookDeliveryRepository) Exists(ctx context.Context, endpointID, eventID string) (bool, error) {
+	var count int64
+
+	tx := conn(ctx, dr.db).
+		Model(&domain.WebhookDelivery{}).
+		Where("endpoint_id = ? AND event_id = ? AND is_replay = ?", endpointID, eventID, false).
+		Count(&count)
+	if tx.Error != nil {
+		return false, fmt.Errorf("error when querying webhook deliveries: %w", tx.Error)
+	}
+
+	return count > 0, nil
+}
+
+// List returns a page of the deliveries to the endpoint, and the cursor of the next page, empty for the
+// last one.
+func (dr *WebhookDeliveryRepository) List(
+	ctx context.Context,
+	endpointID string,
+	page domain.Page,
+) ([]domain.WebhookDelivery, string, error) {
+	var deliveries = []domain.WebhookDelivery{}
+
+	db := conn(ctx, dr.db).Model(&domain.WebhookDelivery{}).Where("webhook_deliveries.endpoint_id = ?", endpointID)
+
+	db, err := paginate(db, "webhook_deliveries", deliverySortKeys, page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if tx := db.Find(&deliveries); tx.Error != nil {
+		if isNotFound(tx.Error) {
+			return []domain.WebhookDelivery{}, "", nil
+		}
+		return nil, "", fmt.Errorf("error when querying webhook deliveries: %w", tx.Error)
+	}
+
+	next := ""
+	if len(deliveries) > page.Limit {
+		deliveries = deliveries[:page.Limit]
+		last := deliveries[len(deliveries)-1]
+		next = nextCursor(page, last.CreatedAt, last.ID)
+	}
+
+	return deliveries, next, nil
+}
+
+// ListDue returns up to limit deliveries to enabled endpoints whose next attempt is due at now, the
+// oldest first.
+func (dr *WebhookDeliveryRepository) ListDue(
+	ctx context.Context,
+	now time.Time,
+	limit int,
+) ([]domain.WebhookDelivery, error) {
+	var deliveries = []domain.WebhookDelivery{}
+
+	endpoints := conn(ctx, dr.db).Model(&domain.WebhookEndpoint{}).Select("id").Where("is_enabled = ?", true)
+
+	tx := conn(ctx, dr.db).
+		Where("next_attempt_at <= ? AND endpoint_id IN (?)", now, endpoints).
+		Order("next_attempt_at").
+		Order("created_at").
+		Limit(limit).
+		Find(&deliveries)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("error when querying due webhook deliveries: %w", tx.Error)
+	}
+
+	return deliveries, nil
+}
+
+func (dr *WebhookDeliveryRepository) Update(
+	ctx context.Context,
+	delivery domain.WebhookDelivery,
+	updates domain.ToUpdate,
+) (domain.WebhookDelivery, error) {
+	colAndVal := map[string]interface{}{}
+
+	for k, v := range updates {
+		colAndVal[string(k)] = v
+	}
+
+	tx := conn(ctx, dr.db).Model(&delivery).Select("*").Updates(colAndVal)
+	if tx.Error != nil {
+		return domain.WebhookDelivery{}, fmt.Errorf("error when updating webhook delivery: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return domain.WebhookDelivery{}, &domain.ErrDataNotFound{DataType: "delivery"}
+	}
+
+	return delivery, nil
+}
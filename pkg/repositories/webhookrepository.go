@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dnawand/go-membershipapi/pkg/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	WebhookURL         domain.Column = "url"
+	WebhookEventTypes  domain.Column = "event_types"
+	WebhookIsEnabled   domain.Column = "is_enabled"
+	WebhookFailures    domain.Column = "failures"
+	WebhookDisableDate domain.Column = "disable_date"
+)
+
+type WebhookRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{
+		db: db,
+	}
+}
+
+func (wr *WebhookRepository) Save(ctx context.Context, endpoint domain.WebhookEndpoint) (domain.WebhookEndpoint, error) {
+	endpointID, err := uuid.NewRandom()
+	if err != nil {
+		return domain.WebhookEndpoint{}, fmt.Errorf("error when generating id for webhook endpoint: %w", err)
+	}
+
+	now := time.Now()
+	endpoint.ID = endpointID.String()
+	endpoint.CreatedAt = now
+	endpoint.UpdatedAt = now
+
+	if tx := conn(ctx, wr.db).Create(&endpoint); tx.Error != nil {
+		return domain.WebhookEndpoint{}, fmt.Errorf("could not save new webhook endpoint: %w", tx.Error)
+	}
+
+	return endpoint, nil
+}
+
+func (wr *WebhookRepository) Get(ctx context.Context, endpointID string) (domain.WebhookEndpoint, error) {
+	var endpoint domain.WebhookEndpoint
+
+	if tx := conn(ctx, wr.db).First(&endpoint, "id = ?", endpointID); tx.Error != nil {
+		if isNotFound(tx.Error) {
+			return domain.WebhookEndpoint{}, &domain.ErrDataNotFound{DataType: "webhook"}
+		}
+		return domain.WebhookEndpoint{}, fmt.Errorf("error when querying webhook endpoint: %w", tx.Error)
+	}
+
+	return endpoint, nil
+}
+
+func (wr *WebhookRepository) List(ctx context.Context) ([]domain.WebhookEndpoint, error) {
+	var endpoints = []domain.WebhookEndpoint{}
+
+	if tx := conn(ctx, wr.db).Order("created_at").Find(&endpoints); tx.Error != nil {
+		return nil, fmt.Errorf("error when querying webhook endpoints: %w", tx.Error)
+	}
+
+	return endpoints, nil
+}
+
+func (wr *WebhookRepository) Update(
+	ctx context.Context,
+	endpoint domain.WebhookEndpoint,
+	updates domain.ToUpdate,
+) (domain.WebhookEndpoint, error) {
+	colAndVal := map[string]interface{}{}
+
+	for k, v := range updates {
+		colAndVal[string(k)] = v
+	}
+
+	tx := conn(ctx, wr.db).Model(&endpoint).Select("*").Updates(colAndVal)
+	if tx.Error != nil {
+		return domain.WebhookEndpoint{}, fmt.Errorf("error when updating webhook endpoint: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return domain.WebhookEndpoint{}, &domain.ErrDataNotFound{DataType: "webhook"}
+	}
+
+	return endpoint, nil
+}
+
+func (wr *WebhookRepository) Delete(ctx context.Context, endpoint domain.WebhookEndpoint) error {
+	if tx := conn(ctx, wr.db).Delete(&endpoint); tx.Error != nil {
+		return fmt.Errorf("error when deleting webhook endpoint: %w", tx.Error)
+	}
+
+	return nil
+}